@@ -4,6 +4,7 @@ import (
 	"github.com/256dpi/xo"
 
 	"github.com/256dpi/fire"
+	"github.com/256dpi/fire/stick"
 )
 
 // A is a short-hand function to construct an authorizer. It will also add tracing
@@ -16,6 +17,7 @@ func A(name string, m fire.Matcher, h Handler) *Authorizer {
 
 	// construct and return authorizer
 	return &Authorizer{
+		Name:    name,
 		Matcher: m,
 		Handler: func(ctx *fire.Context) ([]*Enforcer, error) {
 			// trace
@@ -45,18 +47,26 @@ type Handler func(*fire.Context) ([]*Enforcer, error)
 // authorizer should return a non zero set of enforcers that will enforce the
 // authorization.
 type Authorizer struct {
+	// The name of the authorizer.
+	Name string
+
 	// The matcher that decides whether the authorizer can be run.
 	Matcher fire.Matcher
 
 	// The handler handler that gets executed with the context.
 	Handler Handler
+
+	// the referenced fields and properties
+	fields     []string
+	properties []string
 }
 
 // And will match and run both authorizers and return immediately if one does not
 // return a set of enforcers. The two successfully returned enforcer sets are
 // merged into one and returned.
 func And(a, b *Authorizer) *Authorizer {
-	return A("ash/And", func(ctx *fire.Context) bool {
+	// create authorizer
+	authorizer := A("ash/And", func(ctx *fire.Context) bool {
 		return a.Matcher(ctx) && b.Matcher(ctx)
 	}, func(ctx *fire.Context) ([]*Enforcer, error) {
 		// run first callback
@@ -82,6 +92,11 @@ func And(a, b *Authorizer) *Authorizer {
 
 		return enforcers, nil
 	})
+
+	// inherit references
+	authorizer.inherit(a, b)
+
+	return authorizer
 }
 
 // And will run And() with the current and specified authorizer.
@@ -93,7 +108,8 @@ func (a *Authorizer) And(b *Authorizer) *Authorizer {
 // If no enforcers are returned it will match and run the second authorizer and
 // return its enforcers on success.
 func Or(a, b *Authorizer) *Authorizer {
-	return A("ash/Or", func(ctx *fire.Context) bool {
+	// create authorizer
+	authorizer := A("ash/Or", func(ctx *fire.Context) bool {
 		return a.Matcher(ctx) || b.Matcher(ctx)
 	}, func(ctx *fire.Context) ([]*Enforcer, error) {
 		// check first authorizer
@@ -126,9 +142,21 @@ func Or(a, b *Authorizer) *Authorizer {
 
 		return nil, nil
 	})
+
+	// inherit references
+	authorizer.inherit(a, b)
+
+	return authorizer
 }
 
 // Or will run Or() with the current and specified authorizer.
 func (a *Authorizer) Or(b *Authorizer) *Authorizer {
 	return Or(a, b)
 }
+
+func (a *Authorizer) inherit(authorizers ...*Authorizer) {
+	for _, authorizer := range authorizers {
+		a.fields = stick.Union(a.fields, authorizer.fields)
+		a.properties = stick.Union(a.properties, authorizer.properties)
+	}
+}
@@ -0,0 +1,233 @@
+package ash
+
+import (
+	"github.com/256dpi/lungo/bsonkit"
+	"github.com/256dpi/lungo/mongokit"
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire"
+	"github.com/256dpi/fire/coal"
+)
+
+// Dynamic is a condition value that is resolved using the context when the
+// condition is compiled.
+type Dynamic func(ctx *fire.Context) (interface{}, error)
+
+// Condition is a declarative attribute based condition on model fields. It can
+// be compiled to a database filter and evaluated against a model in memory.
+// Fields are referenced using their struct field names.
+type Condition struct {
+	op    string
+	field string
+	value interface{}
+	list  []*Condition
+}
+
+// Eq will return a condition that matches if the field equals the value.
+func Eq(field string, value interface{}) *Condition {
+	return &Condition{op: "$eq", field: field, value: value}
+}
+
+// Ne will return a condition that matches if the field does not equal the value.
+func Ne(field string, value interface{}) *Condition {
+	return &Condition{op: "$ne", field: field, value: value}
+}
+
+// Gt will return a condition that matches if the field is greater than the
+// value.
+func Gt(field string, value interface{}) *Condition {
+	return &Condition{op: "$gt", field: field, value: value}
+}
+
+// Gte will return a condition that matches if the field is greater than or
+// equal to the value.
+func Gte(field string, value interface{}) *Condition {
+	return &Condition{op: "$gte", field: field, value: value}
+}
+
+// Lt will return a condition that matches if the field is less than the value.
+func Lt(field string, value interface{}) *Condition {
+	return &Condition{op: "$lt", field: field, value: value}
+}
+
+// Lte will return a condition that matches if the field is less than or equal
+// to the value.
+func Lte(field string, value interface{}) *Condition {
+	return &Condition{op: "$lte", field: field, value: value}
+}
+
+// In will return a condition that matches if the field equals one of the
+// values. The value may also be a dynamic value that resolves to a slice.
+func In(field string, values ...interface{}) *Condition {
+	// unwrap dynamic
+	if len(values) == 1 {
+		if dynamic, ok := values[0].(Dynamic); ok {
+			return &Condition{op: "$in", field: field, value: dynamic}
+		}
+	}
+
+	return &Condition{op: "$in", field: field, value: values}
+}
+
+// Exists will return a condition that matches if the field does or does not
+// exist.
+func Exists(field string, exists bool) *Condition {
+	return &Condition{op: "$exists", field: field, value: exists}
+}
+
+// AllOf will return a condition that matches if all conditions match.
+func AllOf(conditions ...*Condition) *Condition {
+	return &Condition{op: "$and", list: conditions}
+}
+
+// AnyOf will return a condition that matches if at least one condition matches.
+func AnyOf(conditions ...*Condition) *Condition {
+	return &Condition{op: "$or", list: conditions}
+}
+
+// NoneOf will return a condition that matches if no condition matches.
+func NoneOf(conditions ...*Condition) *Condition {
+	return &Condition{op: "$nor", list: conditions}
+}
+
+// Filter will compile the condition to a database filter for the specified
+// model using the provided context to resolve dynamic values.
+func (c *Condition) Filter(ctx *fire.Context, model coal.Model) (bson.M, error) {
+	// get meta
+	meta := coal.GetMeta(model)
+
+	// handle lists
+	if c.op == "$and" || c.op == "$or" || c.op == "$nor" {
+		// check list
+		if len(c.list) == 0 {
+			return nil, xo.F("empty condition list")
+		}
+
+		// compile conditions
+		list := make(bson.A, 0, len(c.list))
+		for _, cond := range c.list {
+			filter, err := cond.Filter(ctx, model)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, filter)
+		}
+
+		return bson.M{c.op: list}, nil
+	}
+
+	// get field
+	field := meta.Fields[c.field]
+	if field == nil {
+		field = meta.NestedFields[c.field]
+	}
+	if field == nil {
+		return nil, xo.F("unknown field %q", c.field)
+	} else if field.BSONKey == "" {
+		return nil, xo.F("virtual field %q", c.field)
+	}
+
+	// resolve value
+	value := c.value
+	if dynamic, ok := value.(Dynamic); ok {
+		var err error
+		value, err = dynamic(ctx)
+		if err != nil {
+			return nil, xo.W(err)
+		}
+	}
+
+	return bson.M{
+		field.BSONKey: bson.M{
+			c.op: value,
+		},
+	}, nil
+}
+
+// Match will evaluate the condition against the provided model using the
+// provided context to resolve dynamic values.
+func (c *Condition) Match(ctx *fire.Context, model coal.Model) (bool, error) {
+	// compile filter
+	filter, err := c.Filter(ctx, model)
+	if err != nil {
+		return false, err
+	}
+
+	// convert filter
+	query, err := bsonkit.Transform(filter)
+	if err != nil {
+		return false, xo.W(err)
+	}
+
+	// convert model
+	doc, err := bsonkit.Transform(model)
+	if err != nil {
+		return false, xo.W(err)
+	}
+
+	// match document
+	ok, err := mongokit.Match(doc, query)
+	if err != nil {
+		return false, xo.W(err)
+	}
+
+	return ok, nil
+}
+
+// AddCondition will enforce the authorization by compiling the condition and
+// adding it to the Filters of the context. It should be used together with the
+// ConditionValidator to enforce the same condition for all operations.
+//
+// Note: This enforcer cannot be used to authorize Create and CollectionAction
+// operations.
+func AddCondition(cond *Condition) *Enforcer {
+	return E("ash/AddCondition", fire.Except(fire.Create, fire.CollectionAction), func(ctx *fire.Context) error {
+		// compile condition
+		filter, err := cond.Filter(ctx, contextModel(ctx))
+		if err != nil {
+			return err
+		}
+
+		// add filter
+		ctx.Filters = append(ctx.Filters, filter)
+
+		return nil
+	})
+}
+
+// ConditionValidator will return a validator that evaluates the condition in
+// memory and denies access if it does not match. During Create and Delete the
+// condition is evaluated against the model, during Update against the original
+// model if available and the updated model. This prevents updates to models
+// that do not match as well as updates that move models out of the condition.
+func ConditionValidator(cond *Condition) *fire.Callback {
+	return fire.C("ash/ConditionValidator", fire.Only(fire.Create, fire.Update, fire.Delete), func(ctx *fire.Context) error {
+		// get models
+		models := []coal.Model{ctx.Model}
+		if ctx.Operation == fire.Update && ctx.Original != nil {
+			models = []coal.Model{ctx.Original, ctx.Model}
+		}
+
+		// match condition
+		for _, model := range models {
+			ok, err := cond.Match(ctx, model)
+			if err != nil {
+				return err
+			} else if !ok {
+				return fire.ErrAccessDenied.Wrap()
+			}
+		}
+
+		return nil
+	})
+}
+
+func contextModel(ctx *fire.Context) coal.Model {
+	// prefer controller model
+	if ctx.Controller != nil {
+		return ctx.Controller.Model
+	}
+
+	return ctx.Model
+}
@@ -0,0 +1,162 @@
+package ash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire"
+	"github.com/256dpi/fire/coal"
+	"github.com/256dpi/fire/stick"
+)
+
+var testCondition = AnyOf(
+	Eq("Published", true),
+	AllOf(
+		Eq("Title", Dynamic(func(ctx *fire.Context) (interface{}, error) {
+			return ctx.Data["title"], nil
+		})),
+		Ne("Title", ""),
+	),
+)
+
+func TestConditionFilter(t *testing.T) {
+	ctx := &fire.Context{Data: stick.Map{"title": "foo"}}
+
+	filter, err := testCondition.Filter(ctx, &postModel{})
+	assert.NoError(t, err)
+	assert.Equal(t, bson.M{
+		"$or": bson.A{
+			bson.M{"published": bson.M{"$eq": true}},
+			bson.M{
+				"$and": bson.A{
+					bson.M{"title": bson.M{"$eq": "foo"}},
+					bson.M{"title": bson.M{"$ne": ""}},
+				},
+			},
+		},
+	}, filter)
+
+	filter, err = In("Title", "foo", "bar").Filter(ctx, &postModel{})
+	assert.NoError(t, err)
+	assert.Equal(t, bson.M{
+		"title": bson.M{"$in": []interface{}{"foo", "bar"}},
+	}, filter)
+
+	_, err = Eq("Foo", 1).Filter(ctx, &postModel{})
+	assert.Error(t, err)
+	assert.Equal(t, `unknown field "Foo"`, err.Error())
+
+	_, err = AllOf().Filter(ctx, &postModel{})
+	assert.Error(t, err)
+	assert.Equal(t, `empty condition list`, err.Error())
+}
+
+func TestConditionNested(t *testing.T) {
+	type address struct {
+		City string `json:"city"`
+	}
+
+	type nestedModel struct {
+		coal.Base `json:"-" bson:",inline" coal:"nesteds"`
+		Address   address `json:"address"`
+		stick.NoValidation
+	}
+
+	ctx := &fire.Context{}
+
+	filter, err := Eq("Address.City", "Berlin").Filter(ctx, &nestedModel{})
+	assert.NoError(t, err)
+	assert.Equal(t, bson.M{
+		"address.city": bson.M{"$eq": "Berlin"},
+	}, filter)
+
+	ok, err := Eq("Address.City", "Berlin").Match(ctx, &nestedModel{Address: address{City: "Berlin"}})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = Eq("Address.City", "Berlin").Match(ctx, &nestedModel{})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestConditionMatch(t *testing.T) {
+	ctx := &fire.Context{Data: stick.Map{"title": "foo"}}
+
+	ok, err := testCondition.Match(ctx, &postModel{Title: "foo"})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = testCondition.Match(ctx, &postModel{Title: "bar"})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = testCondition.Match(ctx, &postModel{Title: "bar", Published: true})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = NoneOf(In("Title", "bar", "baz")).Match(ctx, &postModel{Title: "bar"})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestAddCondition(t *testing.T) {
+	authorizer := A("condition", fire.All(), func(ctx *fire.Context) ([]*Enforcer, error) {
+		return S{AddCondition(Eq("Published", true))}, nil
+	})
+
+	tester.WithContext(&fire.Context{
+		Operation:  fire.List,
+		Controller: &fire.Controller{Model: &postModel{}},
+	}, func(ctx *fire.Context) {
+		err := C(&Strategy{All: L{authorizer}}).Handler(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []bson.M{
+			{"published": bson.M{"$eq": true}},
+		}, ctx.Filters)
+	})
+}
+
+func TestConditionValidator(t *testing.T) {
+	validator := ConditionValidator(Eq("Published", false))
+
+	err := tester.RunCallback(&fire.Context{
+		Operation: fire.Create,
+		Model:     &postModel{},
+	}, validator)
+	assert.NoError(t, err)
+
+	err = tester.RunCallback(&fire.Context{
+		Operation: fire.Create,
+		Model:     &postModel{Published: true},
+	}, validator)
+	assert.True(t, fire.ErrAccessDenied.Is(err))
+
+	err = tester.RunCallback(&fire.Context{
+		Operation: fire.Update,
+		Model:     &postModel{Title: "foo"},
+		Original:  &postModel{},
+	}, validator)
+	assert.NoError(t, err)
+
+	err = tester.RunCallback(&fire.Context{
+		Operation: fire.Update,
+		Model:     &postModel{Published: true},
+		Original:  &postModel{},
+	}, validator)
+	assert.True(t, fire.ErrAccessDenied.Is(err))
+
+	err = tester.RunCallback(&fire.Context{
+		Operation: fire.Update,
+		Model:     &postModel{},
+		Original:  &postModel{Published: true},
+	}, validator)
+	assert.True(t, fire.ErrAccessDenied.Is(err))
+
+	err = tester.RunCallback(&fire.Context{
+		Operation: fire.Delete,
+		Model:     &postModel{Published: true},
+	}, validator)
+	assert.True(t, fire.ErrAccessDenied.Is(err))
+}
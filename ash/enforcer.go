@@ -1,6 +1,8 @@
 package ash
 
 import (
+	"strings"
+
 	"go.mongodb.org/mongo-driver/bson"
 
 	"github.com/256dpi/fire"
@@ -61,27 +63,30 @@ func AddFilter(filter bson.M) *Enforcer {
 }
 
 // WhitelistReadableFields will enforce the authorization by making sure only the
-// specified fields are returned for the client.
+// specified fields are returned for the client. Nested fields may be whitelisted
+// using their dotted name e.g. "Address.City" to only return parts of a field.
 //
 // Note: This enforcer cannot be used to authorize Delete, ResourceAction and
 // CollectionAction operations.
 func WhitelistReadableFields(fields ...string) *Enforcer {
 	return E("ash/WhitelistReadableFields", fire.Except(fire.Delete, fire.ResourceAction, fire.CollectionAction), func(ctx *fire.Context) error {
 		// set new list
-		ctx.ReadableFields = stick.Intersect(ctx.ReadableFields, fields)
+		ctx.ReadableFields = intersectFields(ctx.ReadableFields, fields)
 
 		return nil
 	})
 }
 
 // WhitelistWritableFields will enforce the authorization by making sure only the
-// specified fields can be changed by the client.
+// specified fields can be changed by the client. Nested fields may be
+// whitelisted using their dotted name e.g. "Address.City" to only allow changes
+// to parts of a field.
 //
 // Note: This enforcer can only be used to authorize Create and Update operations.
 func WhitelistWritableFields(fields ...string) *Enforcer {
 	return E("ash/WhitelistWritableFields", fire.Only(fire.Create, fire.Update), func(ctx *fire.Context) error {
 		// set new list
-		ctx.WritableFields = stick.Intersect(ctx.WritableFields, fields)
+		ctx.WritableFields = intersectFields(ctx.WritableFields, fields)
 
 		return nil
 	})
@@ -116,3 +121,26 @@ func AddRelationshipFilter(rel string, filter bson.M) *Enforcer {
 		return nil
 	})
 }
+
+func intersectFields(listA, listB []string) []string {
+	// prepare new list
+	list := make([]string, 0, len(listA))
+
+	// add fields that are part of both lists, a nested field is part of a list
+	// if its parent field is
+	for _, a := range listA {
+		for _, b := range listB {
+			var field string
+			if a == b || strings.HasPrefix(a, b+".") {
+				field = a
+			} else if strings.HasPrefix(b, a+".") {
+				field = b
+			}
+			if field != "" && !stick.Contains(list, field) {
+				list = append(list, field)
+			}
+		}
+	}
+
+	return list
+}
@@ -38,6 +38,11 @@ func TestWhitelistReadableFields(t *testing.T) {
 	err = tester.RunCallback(ctx, WhitelistReadableFields("foo", "bar"))
 	assert.NoError(t, err)
 	assert.Equal(t, []string{}, ctx.ReadableFields)
+
+	ctx = &fire.Context{ReadableFields: []string{"foo", "bar", "baz.qux"}}
+	err = tester.RunCallback(ctx, WhitelistReadableFields("foo.bar", "baz", "quz.bar"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo.bar", "baz.qux"}, ctx.ReadableFields)
 }
 
 func TestWhitelistWritableFields(t *testing.T) {
@@ -50,6 +55,11 @@ func TestWhitelistWritableFields(t *testing.T) {
 	err = tester.RunCallback(ctx, WhitelistWritableFields("foo", "bar"))
 	assert.NoError(t, err)
 	assert.Equal(t, []string{}, ctx.WritableFields)
+
+	ctx = &fire.Context{WritableFields: []string{"foo", "bar", "baz.qux"}}
+	err = tester.RunCallback(ctx, WhitelistWritableFields("foo.bar", "baz", "quz.bar"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo.bar", "baz.qux"}, ctx.WritableFields)
 }
 
 func TestWhitelistReadableProperties(t *testing.T) {
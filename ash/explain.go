@@ -0,0 +1,145 @@
+package ash
+
+import (
+	"encoding/json"
+
+	"github.com/256dpi/xo"
+
+	"github.com/256dpi/fire"
+	"github.com/256dpi/fire/stick"
+)
+
+const explanationKey = "ash:explanation"
+
+// Step describes the evaluation of a single authorizer.
+type Step struct {
+	// The name of the authorizer.
+	Authorizer string `json:"authorizer"`
+
+	// Whether the authorizer matcher did match.
+	Matched bool `json:"matched"`
+
+	// The names of the returned enforcers.
+	Enforcers []string `json:"enforcers,omitempty"`
+
+	// The error returned by the authorizer or one of its enforcers.
+	Error string `json:"error,omitempty"`
+}
+
+// StrategyExplanation describes how a single strategy decided about a request.
+type StrategyExplanation struct {
+	// The evaluated authorizers in order.
+	Steps []Step `json:"steps"`
+
+	// Whether access has been granted.
+	Granted bool `json:"granted"`
+}
+
+// Explanation describes how the strategies decided about a request.
+type Explanation struct {
+	// The authorized operation.
+	Operation string `json:"operation"`
+
+	// The evaluated strategies in order.
+	Strategies []StrategyExplanation `json:"strategies"`
+
+	// Whether access has been granted by all strategies.
+	Granted bool `json:"granted"`
+
+	// The resulting field and property whitelists.
+	ReadableFields     []string `json:"readableFields"`
+	WritableFields     []string `json:"writableFields"`
+	ReadableProperties []string `json:"readableProperties"`
+
+	header string
+}
+
+// Explain will enable the explain mode for the request of the provided context.
+// Strategies will then record their evaluation in an explanation that can be
+// retrieved using GetExplanation and is attached to the trace.
+func Explain(ctx *fire.Context) {
+	// ensure data
+	if ctx.Data == nil {
+		ctx.Data = stick.Map{}
+	}
+
+	// set explanation
+	ctx.Data[explanationKey] = &Explanation{}
+}
+
+// GetExplanation will return the explanation of the evaluated strategies if the
+// explain mode has been enabled for the request.
+func GetExplanation(ctx *fire.Context) *Explanation {
+	explanation, _ := ctx.Data[explanationKey].(*Explanation)
+	return explanation
+}
+
+// ExplainHeader will return a callback that enables the explain mode if the
+// specified request header is present and the required check function returns
+// true. The check must limit explanations to privileged clients as they expose
+// the authorization details. The explanation is additionally returned as JSON
+// in the same response header. The callback should be added to the authorizers
+// before any strategy.
+func ExplainHeader(header string, check func(*fire.Context) bool) *fire.Callback {
+	// check function
+	if check == nil {
+		panic("ash: missing check function")
+	}
+
+	return fire.C("ash/ExplainHeader", fire.All(), func(ctx *fire.Context) error {
+		// check header
+		if ctx.HTTPRequest == nil || ctx.HTTPRequest.Header.Get(header) == "" {
+			return nil
+		}
+
+		// check request
+		if !check(ctx) {
+			return nil
+		}
+
+		// enable explain mode
+		Explain(ctx)
+		GetExplanation(ctx).header = header
+
+		return nil
+	})
+}
+
+func (e *Explanation) begin(ctx *fire.Context) *StrategyExplanation {
+	// set operation
+	e.Operation = ctx.Operation.String()
+
+	// add strategy
+	e.Strategies = append(e.Strategies, StrategyExplanation{})
+
+	return &e.Strategies[len(e.Strategies)-1]
+}
+
+func (e *Explanation) finish(ctx *fire.Context, strategy *StrategyExplanation, err error) {
+	// set strategy result
+	strategy.Granted = err == nil
+
+	// set result
+	e.Granted = true
+	for _, s := range e.Strategies {
+		e.Granted = e.Granted && s.Granted
+	}
+	e.ReadableFields = ctx.ReadableFields
+	e.WritableFields = ctx.WritableFields
+	e.ReadableProperties = ctx.ReadableProperties
+
+	// encode explanation
+	buf, _ := json.Marshal(e)
+
+	// attach to trace
+	if ctx.Tracer != nil {
+		ctx.Tracer.Attach("ash/Explanation", xo.M{
+			"explanation": string(buf),
+		})
+	}
+
+	// set response header
+	if e.header != "" && ctx.ResponseWriter != nil {
+		ctx.ResponseWriter.Header().Set(e.header, string(buf))
+	}
+}
@@ -0,0 +1,174 @@
+package ash
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/256dpi/fire"
+)
+
+func TestExplain(t *testing.T) {
+	cb := C(&Strategy{
+		List: L{
+			A("skipped", fire.Only(fire.Find), func(_ *fire.Context) ([]*Enforcer, error) {
+				return S{GrantAccess()}, nil
+			}),
+			blank(),
+			WhitelistFields(Fields{
+				Readable: []string{"Title"},
+			}),
+		},
+		Update: L{accessDenied()},
+	})
+
+	tester.WithContext(&fire.Context{
+		Operation:      fire.List,
+		ReadableFields: []string{"Title", "Published"},
+	}, func(ctx *fire.Context) {
+		assert.Nil(t, GetExplanation(ctx))
+
+		Explain(ctx)
+
+		err := cb.Handler(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, &Explanation{
+			Operation: "List",
+			Strategies: []StrategyExplanation{
+				{
+					Steps: []Step{
+						{Authorizer: "skipped"},
+						{Authorizer: "blank", Matched: true},
+						{Authorizer: "ash/WhitelistFields", Matched: true, Enforcers: []string{"ash/GrantAccess", "ash/WhitelistReadableFields"}},
+					},
+					Granted: true,
+				},
+			},
+			Granted:        true,
+			ReadableFields: []string{"Title"},
+		}, GetExplanation(ctx))
+	})
+
+	tester.WithContext(&fire.Context{
+		Operation: fire.Update,
+	}, func(ctx *fire.Context) {
+		Explain(ctx)
+
+		err := cb.Handler(ctx)
+		assert.True(t, fire.ErrAccessDenied.Is(err))
+		assert.Equal(t, &Explanation{
+			Operation: "Update",
+			Strategies: []StrategyExplanation{
+				{
+					Steps: []Step{
+						{Authorizer: "accessDenied", Matched: true, Enforcers: []string{"ash/DenyAccess"}, Error: "unauthorized: access denied"},
+					},
+				},
+			},
+		}, GetExplanation(ctx))
+	})
+}
+
+func TestExplainStrategies(t *testing.T) {
+	access := C(&Strategy{
+		All: L{accessGranted()},
+	})
+
+	whitelist := C(&Strategy{
+		All: L{WhitelistFields(Fields{
+			Readable: []string{"Title"},
+		})},
+	})
+
+	tester.WithContext(&fire.Context{
+		Operation:      fire.Find,
+		ReadableFields: []string{"Title", "Published"},
+	}, func(ctx *fire.Context) {
+		Explain(ctx)
+
+		assert.NoError(t, access.Handler(ctx))
+		assert.NoError(t, whitelist.Handler(ctx))
+		assert.Equal(t, &Explanation{
+			Operation: "Find",
+			Strategies: []StrategyExplanation{
+				{
+					Steps: []Step{
+						{Authorizer: "accessGranted", Matched: true, Enforcers: []string{"ash/GrantAccess"}},
+					},
+					Granted: true,
+				},
+				{
+					Steps: []Step{
+						{Authorizer: "ash/WhitelistFields", Matched: true, Enforcers: []string{"ash/GrantAccess", "ash/WhitelistReadableFields"}},
+					},
+					Granted: true,
+				},
+			},
+			Granted:        true,
+			ReadableFields: []string{"Title"},
+		}, GetExplanation(ctx))
+	})
+
+	tester.WithContext(&fire.Context{
+		Operation: fire.Find,
+	}, func(ctx *fire.Context) {
+		Explain(ctx)
+
+		assert.NoError(t, access.Handler(ctx))
+		assert.Error(t, C(&Strategy{All: L{accessDenied()}}).Handler(ctx))
+		assert.Len(t, GetExplanation(ctx).Strategies, 2)
+		assert.True(t, GetExplanation(ctx).Strategies[0].Granted)
+		assert.False(t, GetExplanation(ctx).Strategies[1].Granted)
+		assert.False(t, GetExplanation(ctx).Granted)
+	})
+}
+
+func TestExplainHeader(t *testing.T) {
+	cb := C(&Strategy{
+		All: L{accessGranted()},
+	})
+
+	eh := ExplainHeader("X-Explain", func(ctx *fire.Context) bool {
+		return ctx.Data["admin"] == true
+	})
+
+	assert.PanicsWithValue(t, "ash: missing check function", func() {
+		ExplainHeader("X-Explain", nil)
+	})
+
+	tester.Header["X-Explain"] = "1"
+	defer delete(tester.Header, "X-Explain")
+
+	tester.WithContext(nil, func(ctx *fire.Context) {
+		assert.NoError(t, eh.Handler(ctx))
+		assert.NoError(t, cb.Handler(ctx))
+		assert.Nil(t, GetExplanation(ctx))
+		assert.Empty(t, ctx.ResponseWriter.Header().Get("X-Explain"))
+	})
+
+	tester.WithContext(&fire.Context{Data: map[string]interface{}{"admin": true}}, func(ctx *fire.Context) {
+		assert.NoError(t, eh.Handler(ctx))
+		assert.NoError(t, cb.Handler(ctx))
+		assert.NotNil(t, GetExplanation(ctx))
+		assert.JSONEq(t, `{
+			"operation": "List",
+			"strategies": [
+				{
+					"steps": [
+						{
+							"authorizer": "accessGranted",
+							"matched": true,
+							"enforcers": ["ash/GrantAccess"]
+						}
+					],
+					"granted": true
+				}
+			],
+			"granted": true,
+			"readableFields": null,
+			"writableFields": null,
+			"readableProperties": null
+		}`, ctx.ResponseWriter.(*httptest.ResponseRecorder).Header().Get("X-Explain"))
+	})
+}
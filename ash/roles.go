@@ -0,0 +1,484 @@
+package ash
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/256dpi/xo"
+
+	"github.com/256dpi/fire"
+	"github.com/256dpi/fire/coal"
+	"github.com/256dpi/fire/flame"
+	"github.com/256dpi/fire/stick"
+)
+
+var validPermission = regexp.MustCompile(`^(\*|[a-z0-9][a-z0-9._-]*):(\*|[a-z0-9][a-z0-9._-]*)$`).MatchString
+
+// Role defines a named set of permissions and field whitelists. Permissions
+// are of the form "resource:verb" where the resource is the plural name of a
+// model and the verb is one of "list", "find", "create", "update", "delete",
+// the name of a collection or resource action or one of the groups "read",
+// "write" and "actions". The wildcard "*" may be used for both parts.
+type Role struct {
+	// The unique name of the role.
+	Name string
+
+	// The roles from which permissions and whitelists are inherited.
+	Inherits []string
+
+	// The granted permissions e.g. "posts:read".
+	Permissions []string
+
+	// The whitelisted fields per plural model name.
+	Fields map[string]Fields
+
+	// The whitelisted properties per plural model name.
+	Properties map[string][]string
+}
+
+// Roles is a central catalog of roles that is used to authorize operations
+// based on the roles assigned to the authenticated resource owner.
+type Roles struct {
+	// The function used to resolve the roles of the current request.
+	//
+	// Default: AssignedRoles.
+	Resolver func(ctx *fire.Context) ([]string, error)
+
+	roles map[string]*Role
+	names []string
+}
+
+// NewRoles will create and return a new role catalog. It will panic if a role
+// is defined twice, an inherited role is missing, the inheritance contains a
+// cycle or a permission is malformed.
+func NewRoles(roles ...Role) *Roles {
+	// prepare catalog
+	r := &Roles{
+		Resolver: AssignedRoles,
+		roles:    map[string]*Role{},
+	}
+
+	// add roles
+	for i := range roles {
+		// get role
+		role := roles[i]
+
+		// check name
+		if role.Name == "" {
+			panic("ash: missing role name")
+		}
+
+		// check existence
+		if r.roles[role.Name] != nil {
+			panic(fmt.Sprintf(`ash: duplicate role "%s"`, role.Name))
+		}
+
+		// check permissions
+		for _, permission := range role.Permissions {
+			if !validPermission(permission) {
+				panic(fmt.Sprintf(`ash: invalid permission "%s" on role "%s"`, permission, role.Name))
+			}
+		}
+
+		// add role
+		r.roles[role.Name] = &role
+		r.names = append(r.names, role.Name)
+	}
+
+	// sort names
+	sort.Strings(r.names)
+
+	// check inheritance
+	for _, name := range r.names {
+		r.check(name, nil)
+	}
+
+	return r
+}
+
+func (r *Roles) check(name string, path []string) {
+	// check cycle
+	if stick.Contains(path, name) {
+		panic(fmt.Sprintf(`ash: cyclic role inheritance "%s"`, strings.Join(append(path, name), " > ")))
+	}
+
+	// get role
+	role := r.roles[name]
+	if role == nil {
+		panic(fmt.Sprintf(`ash: unknown role "%s"`, name))
+	}
+
+	// check inherited roles
+	for _, parent := range role.Inherits {
+		r.check(parent, append(path, name))
+	}
+}
+
+// Expand will return the provided roles and all roles they inherit from. The
+// returned map contains the inheritance path of each role starting from the
+// assigned role. Unknown roles are ignored.
+func (r *Roles) Expand(roles []string) ([]string, map[string][]string) {
+	// prepare result
+	var list []string
+	paths := map[string][]string{}
+
+	// define walker
+	var walk func(name string, path []string)
+	walk = func(name string, path []string) {
+		// get role
+		role := r.roles[name]
+		if role == nil {
+			return
+		}
+
+		// check if already visited
+		if _, ok := paths[name]; ok {
+			return
+		}
+
+		// add role
+		path = append(append([]string{}, path...), name)
+		list = append(list, name)
+		paths[name] = path
+
+		// walk inherited roles
+		for _, parent := range role.Inherits {
+			walk(parent, path)
+		}
+	}
+
+	// walk assigned roles
+	for _, name := range roles {
+		walk(name, nil)
+	}
+
+	return list, paths
+}
+
+// Decision describes the outcome of a permission check.
+type Decision struct {
+	// Whether the operation has been allowed.
+	Allowed bool
+
+	// The assigned roles.
+	Assigned []string
+
+	// The effective roles including inherited roles.
+	Effective []string
+
+	// The checked permissions in order of evaluation.
+	Checked []string
+
+	// The role and permission that granted access.
+	Role       string
+	Permission string
+
+	// The inheritance path of the granting role.
+	Path []string
+}
+
+// String will return a human readable explanation of the decision.
+func (d Decision) String() string {
+	// handle allowed
+	if d.Allowed {
+		return fmt.Sprintf(`allowed: role "%s" grants "%s" (via %s)`, d.Role, d.Permission, strings.Join(d.Path, " > "))
+	}
+
+	// handle missing roles
+	if len(d.Effective) == 0 {
+		return "denied: no roles assigned"
+	}
+
+	return fmt.Sprintf(`denied: none of the roles [%s] grants any of [%s]`, strings.Join(d.Effective, ", "), strings.Join(d.Checked, ", "))
+}
+
+// Check will check whether the provided roles are allowed to perform the
+// specified operation on the model. The action name is only used for
+// collection and resource actions.
+func (r *Roles) Check(roles []string, model coal.Model, op fire.Operation, action string) Decision {
+	// get resource
+	resource := coal.GetMeta(model).PluralName
+
+	// expand roles
+	effective, paths := r.Expand(roles)
+
+	// prepare decision
+	decision := Decision{
+		Assigned:  roles,
+		Effective: effective,
+		Checked:   Permissions(resource, op, action),
+	}
+
+	// find first granting role and permission
+	for _, permission := range decision.Checked {
+		for _, name := range effective {
+			if stick.Contains(r.roles[name].Permissions, permission) {
+				decision.Allowed = true
+				decision.Role = name
+				decision.Permission = permission
+				decision.Path = paths[name]
+				return decision
+			}
+		}
+	}
+
+	return decision
+}
+
+// Permissions will return the list of permissions that grant the specified
+// operation on the resource, ordered from the most to the least specific.
+func Permissions(resource string, op fire.Operation, action string) []string {
+	// determine verbs
+	var verbs []string
+	switch op {
+	case fire.List:
+		verbs = []string{"list", "read"}
+	case fire.Find:
+		verbs = []string{"find", "read"}
+	case fire.Create:
+		verbs = []string{"create", "write"}
+	case fire.Update:
+		verbs = []string{"update", "write"}
+	case fire.Delete:
+		verbs = []string{"delete", "write"}
+	case fire.CollectionAction, fire.ResourceAction:
+		verbs = []string{action, "actions"}
+	}
+
+	// add wildcard
+	verbs = append(verbs, "*")
+
+	// compute permissions
+	var list []string
+	for _, res := range []string{resource, "*"} {
+		for _, verb := range verbs {
+			if verb != "" {
+				list = append(list, res+":"+verb)
+			}
+		}
+	}
+
+	return list
+}
+
+// Whitelist will return the union of the field and property whitelists of the
+// provided roles and their inherited roles for the specified model. It will
+// also return whether any of the roles defines a field and property whitelist
+// for the model.
+func (r *Roles) Whitelist(roles []string, model coal.Model) (Fields, []string, bool, bool) {
+	// get resource
+	resource := coal.GetMeta(model).PluralName
+
+	// expand roles
+	effective, _ := r.Expand(roles)
+
+	// merge whitelists
+	var fields Fields
+	var properties []string
+	var hasFields, hasProperties bool
+	for _, name := range effective {
+		// get role
+		role := r.roles[name]
+
+		// merge fields
+		if f, ok := role.Fields[resource]; ok {
+			fields.Readable = stick.Union(fields.Readable, f.Readable)
+			fields.Writable = stick.Union(fields.Writable, f.Writable)
+			fields.Creatable = stick.Union(fields.Creatable, f.Creatable)
+			fields.Updatable = stick.Union(fields.Updatable, f.Updatable)
+			hasFields = true
+		}
+
+		// merge properties
+		if p, ok := role.Properties[resource]; ok {
+			properties = stick.Union(properties, p)
+			hasProperties = true
+		}
+	}
+
+	return fields, properties, hasFields, hasProperties
+}
+
+// Authorizer will return an authorizer that grants access to the specified
+// model if one of the roles of the current request is granted the required
+// permission for the operation.
+func (r *Roles) Authorizer(model coal.Model) *Authorizer {
+	return A("ash/Roles.Authorizer", fire.All(), func(ctx *fire.Context) ([]*Enforcer, error) {
+		// resolve roles
+		roles, err := r.Resolver(ctx)
+		if err != nil {
+			return nil, xo.W(err)
+		}
+
+		// get action
+		var action string
+		if ctx.JSONAPIRequest != nil {
+			if ctx.Operation == fire.CollectionAction {
+				action = ctx.JSONAPIRequest.CollectionAction
+			} else if ctx.Operation == fire.ResourceAction {
+				action = ctx.JSONAPIRequest.ResourceAction
+			}
+		}
+
+		// check permission
+		decision := r.Check(roles, model, ctx.Operation, action)
+		if !decision.Allowed {
+			return nil, nil
+		}
+
+		return S{GrantAccess()}, nil
+	})
+}
+
+// Whitelister will return an authorizer that whitelists the fields and
+// properties defined by the roles of the current request for the specified
+// model. Fields and properties are only whitelisted if at least one of the
+// roles defines a whitelist for them. The authorizer will return no enforcers
+// if none of the roles defines a whitelist for the model. Like WhitelistFields,
+// it should be used in a separate strategy following general resource access.
+func (r *Roles) Whitelister(model coal.Model) *Authorizer {
+	// check whitelists
+	for _, name := range r.names {
+		role := r.roles[name]
+		if f, ok := role.Fields[coal.GetMeta(model).PluralName]; ok {
+			for _, field := range stick.Union(f.Readable, f.Writable, f.Creatable, f.Updatable) {
+				coal.F(model, field)
+			}
+		}
+		for _, property := range role.Properties[coal.GetMeta(model).PluralName] {
+			fire.P(model, property)
+		}
+	}
+
+	return A("ash/Roles.Whitelister", fire.All(), func(ctx *fire.Context) ([]*Enforcer, error) {
+		// resolve roles
+		roles, err := r.Resolver(ctx)
+		if err != nil {
+			return nil, xo.W(err)
+		}
+
+		// get whitelist
+		fields, properties, hasFields, hasProperties := r.Whitelist(roles, model)
+
+		// whitelist fields and properties
+		switch {
+		case hasFields && hasProperties:
+			return And(WhitelistFields(fields), WhitelistProperties(properties)).Handler(ctx)
+		case hasFields:
+			return WhitelistFields(fields).Handler(ctx)
+		case hasProperties:
+			return WhitelistProperties(properties).Handler(ctx)
+		default:
+			return nil, nil
+		}
+	})
+}
+
+// Dump will return a human readable description of all roles including their
+// effective permissions and whitelists.
+func (r *Roles) Dump() string {
+	// prepare buffer
+	var buf bytes.Buffer
+
+	// write roles
+	for _, name := range r.names {
+		// get role
+		role := r.roles[name]
+
+		// expand role
+		effective, _ := r.Expand([]string{name})
+
+		// collect effective permissions
+		var permissions []string
+		for _, item := range effective {
+			permissions = stick.Union(permissions, r.roles[item].Permissions)
+		}
+		sort.Strings(permissions)
+
+		// write role
+		_, _ = fmt.Fprintf(&buf, "%s\n", name)
+		if len(role.Inherits) > 0 {
+			_, _ = fmt.Fprintf(&buf, "  inherits: %s\n", strings.Join(role.Inherits, ", "))
+		}
+		_, _ = fmt.Fprintf(&buf, "  permissions: %s\n", strings.Join(permissions, ", "))
+
+		// collect resources
+		var resources []string
+		for _, item := range effective {
+			for resource := range r.roles[item].Fields {
+				resources = stick.Union(resources, []string{resource})
+			}
+			for resource := range r.roles[item].Properties {
+				resources = stick.Union(resources, []string{resource})
+			}
+		}
+		sort.Strings(resources)
+
+		// write whitelists
+		for _, resource := range resources {
+			// merge whitelists
+			var fields Fields
+			var properties []string
+			for _, item := range effective {
+				f := r.roles[item].Fields[resource]
+				fields.Readable = stick.Union(fields.Readable, f.Readable)
+				fields.Writable = stick.Union(fields.Writable, f.Writable)
+				fields.Creatable = stick.Union(fields.Creatable, f.Creatable)
+				fields.Updatable = stick.Union(fields.Updatable, f.Updatable)
+				properties = stick.Union(properties, r.roles[item].Properties[resource])
+			}
+
+			// write whitelist
+			_, _ = fmt.Fprintf(&buf, "  %s:\n", resource)
+			if len(fields.Readable) > 0 {
+				_, _ = fmt.Fprintf(&buf, "    readable: %s\n", strings.Join(fields.Readable, ", "))
+			}
+			if len(fields.Writable) > 0 {
+				_, _ = fmt.Fprintf(&buf, "    writable: %s\n", strings.Join(fields.Writable, ", "))
+			}
+			if len(fields.Creatable) > 0 {
+				_, _ = fmt.Fprintf(&buf, "    creatable: %s\n", strings.Join(fields.Creatable, ", "))
+			}
+			if len(fields.Updatable) > 0 {
+				_, _ = fmt.Fprintf(&buf, "    updatable: %s\n", strings.Join(fields.Updatable, ", "))
+			}
+			if len(properties) > 0 {
+				_, _ = fmt.Fprintf(&buf, "    properties: %s\n", strings.Join(properties, ", "))
+			}
+		}
+	}
+
+	return buf.String()
+}
+
+// AssignedRoles will return the roles assigned to the authenticated resource
+// owner. The roles are read from the "[]string" field flagged with "ash-roles".
+// No roles are returned if no resource owner has been authenticated or the
+// model has no flagged field.
+//
+// Note: This resolver requires preliminary authorization using
+// flame.Callback().
+func AssignedRoles(ctx *fire.Context) ([]string, error) {
+	// get auth info
+	info, _ := ctx.Data[flame.AuthInfoDataKey].(*flame.AuthInfo)
+	if info == nil || info.ResourceOwner == nil {
+		return nil, nil
+	}
+
+	// get field
+	field := coal.L(info.ResourceOwner, "ash-roles", false)
+	if field == "" {
+		return nil, nil
+	}
+
+	// get roles
+	roles, ok := stick.MustGet(info.ResourceOwner, field).([]string)
+	if !ok {
+		return nil, xo.F("roles field is not of type []string")
+	}
+
+	return roles, nil
+}
@@ -0,0 +1,226 @@
+package ash
+
+import (
+	"context"
+	"testing"
+
+	"github.com/256dpi/jsonapi/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/256dpi/fire"
+	"github.com/256dpi/fire/flame"
+	"github.com/256dpi/fire/stick"
+)
+
+var testRoles = NewRoles(Role{
+	Name:        "viewer",
+	Permissions: []string{"posts:read"},
+	Fields: map[string]Fields{
+		"posts": {
+			Readable: []string{"Title"},
+		},
+	},
+}, Role{
+	Name:        "editor",
+	Inherits:    []string{"viewer"},
+	Permissions: []string{"posts:update", "posts:publish"},
+	Fields: map[string]Fields{
+		"posts": {
+			Readable: []string{"Published"},
+			Writable: []string{"Title"},
+		},
+	},
+	Properties: map[string][]string{
+		"posts": {"Info"},
+	},
+}, Role{
+	Name:        "admin",
+	Inherits:    []string{"editor"},
+	Permissions: []string{"*:*"},
+})
+
+func TestNewRoles(t *testing.T) {
+	assert.PanicsWithValue(t, `ash: missing role name`, func() {
+		NewRoles(Role{})
+	})
+
+	assert.PanicsWithValue(t, `ash: duplicate role "foo"`, func() {
+		NewRoles(Role{Name: "foo"}, Role{Name: "foo"})
+	})
+
+	assert.PanicsWithValue(t, `ash: invalid permission "posts" on role "foo"`, func() {
+		NewRoles(Role{Name: "foo", Permissions: []string{"posts"}})
+	})
+
+	assert.PanicsWithValue(t, `ash: unknown role "bar"`, func() {
+		NewRoles(Role{Name: "foo", Inherits: []string{"bar"}})
+	})
+
+	assert.PanicsWithValue(t, `ash: cyclic role inheritance "bar > foo > bar"`, func() {
+		NewRoles(Role{Name: "foo", Inherits: []string{"bar"}}, Role{Name: "bar", Inherits: []string{"foo"}})
+	})
+}
+
+func TestRolesExpand(t *testing.T) {
+	list, paths := testRoles.Expand([]string{"admin", "foo"})
+	assert.Equal(t, []string{"admin", "editor", "viewer"}, list)
+	assert.Equal(t, map[string][]string{
+		"admin":  {"admin"},
+		"editor": {"admin", "editor"},
+		"viewer": {"admin", "editor", "viewer"},
+	}, paths)
+}
+
+func TestRolesCheck(t *testing.T) {
+	decision := testRoles.Check([]string{"editor"}, &postModel{}, fire.Find, "")
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, "viewer", decision.Role)
+	assert.Equal(t, "posts:read", decision.Permission)
+	assert.Equal(t, `allowed: role "viewer" grants "posts:read" (via editor > viewer)`, decision.String())
+
+	decision = testRoles.Check([]string{"editor"}, &postModel{}, fire.ResourceAction, "publish")
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, "posts:publish", decision.Permission)
+
+	decision = testRoles.Check([]string{"viewer"}, &postModel{}, fire.Update, "")
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, `denied: none of the roles [viewer] grants any of [posts:update, posts:write, posts:*, *:update, *:write, *:*]`, decision.String())
+
+	decision = testRoles.Check(nil, &postModel{}, fire.List, "")
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, `denied: no roles assigned`, decision.String())
+
+	decision = testRoles.Check([]string{"admin"}, &postModel{}, fire.Delete, "")
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, "admin", decision.Role)
+	assert.Equal(t, "*:*", decision.Permission)
+}
+
+func TestRolesAuthorizer(t *testing.T) {
+	roles := NewRoles(*testRoles.roles["viewer"], *testRoles.roles["editor"])
+	roles.Resolver = func(ctx *fire.Context) ([]string, error) {
+		list, _ := ctx.Data["roles"].([]string)
+		return list, nil
+	}
+
+	cb := C(&Strategy{
+		All: L{roles.Authorizer(&postModel{})},
+	})
+
+	err := tester.RunCallback(&fire.Context{Operation: fire.List}, cb)
+	assert.True(t, fire.ErrAccessDenied.Is(err))
+
+	err = tester.RunCallback(&fire.Context{Operation: fire.List, Data: stick.Map{"roles": []string{"viewer"}}}, cb)
+	assert.NoError(t, err)
+
+	err = tester.RunCallback(&fire.Context{Operation: fire.Update, Data: stick.Map{"roles": []string{"viewer"}}}, cb)
+	assert.True(t, fire.ErrAccessDenied.Is(err))
+
+	err = tester.RunCallback(&fire.Context{Operation: fire.Update, Data: stick.Map{"roles": []string{"editor"}}}, cb)
+	assert.NoError(t, err)
+
+	err = tester.RunCallback(&fire.Context{
+		Operation:      fire.ResourceAction,
+		Data:           stick.Map{"roles": []string{"editor"}},
+		JSONAPIRequest: &jsonapi.Request{ResourceAction: "publish"},
+	}, cb)
+	assert.NoError(t, err)
+}
+
+func TestRolesWhitelister(t *testing.T) {
+	roles := NewRoles(*testRoles.roles["viewer"], *testRoles.roles["editor"])
+	roles.Resolver = func(ctx *fire.Context) ([]string, error) {
+		list, _ := ctx.Data["roles"].([]string)
+		return list, nil
+	}
+
+	strategy := C(&Strategy{
+		All: L{roles.Whitelister(&postModel{})},
+	})
+
+	ctx := &fire.Context{
+		Data:               stick.Map{"roles": []string{"editor"}},
+		Operation:          fire.Update,
+		ReadableFields:     []string{"Title", "Published"},
+		WritableFields:     []string{"Title", "Published"},
+		ReadableProperties: []string{"Info"},
+	}
+
+	tester.WithContext(ctx, func(ctx *fire.Context) {
+		err := strategy.Handler(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Title", "Published"}, ctx.ReadableFields)
+		assert.Equal(t, []string{"Title"}, ctx.WritableFields)
+		assert.Equal(t, []string{"Info"}, ctx.ReadableProperties)
+	})
+
+	ctx = &fire.Context{
+		Data:               stick.Map{"roles": []string{"viewer"}},
+		Operation:          fire.Update,
+		ReadableFields:     []string{"Title", "Published"},
+		WritableFields:     []string{"Title", "Published"},
+		ReadableProperties: []string{"Info"},
+	}
+
+	tester.WithContext(ctx, func(ctx *fire.Context) {
+		err := strategy.Handler(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Title"}, ctx.ReadableFields)
+		assert.Empty(t, ctx.WritableFields)
+		assert.Equal(t, []string{"Info"}, ctx.ReadableProperties)
+	})
+
+	err := tester.RunCallback(&fire.Context{Operation: fire.Find}, strategy)
+	assert.True(t, fire.ErrAccessDenied.Is(err))
+}
+
+func TestRolesDump(t *testing.T) {
+	assert.Equal(t, `admin
+  inherits: editor
+  permissions: *:*, posts:publish, posts:read, posts:update
+  posts:
+    readable: Published, Title
+    writable: Title
+    properties: Info
+editor
+  inherits: viewer
+  permissions: posts:publish, posts:read, posts:update
+  posts:
+    readable: Published, Title
+    writable: Title
+    properties: Info
+viewer
+  permissions: posts:read
+  posts:
+    readable: Title
+`, testRoles.Dump())
+}
+
+func TestAssignedRoles(t *testing.T) {
+	tester.WithContext(nil, func(ctx *fire.Context) {
+		roles, err := AssignedRoles(ctx)
+		assert.NoError(t, err)
+		assert.Nil(t, roles)
+	})
+
+	client := &flame.Application{Name: "app"}
+	user := &userModel{Name: "user", Roles: []string{"editor"}}
+	token := &flame.Token{Scope: []string{"foo"}}
+	c := context.WithValue(context.Background(), flame.ClientContextKey, client)
+	c = context.WithValue(c, flame.ResourceOwnerContextKey, user)
+	c = context.WithValue(c, flame.AccessTokenContextKey, token)
+
+	tester.WithContext(&fire.Context{Context: c}, func(ctx *fire.Context) {
+		err := tester.RunCallback(ctx, flame.Callback(false, "foo"))
+		assert.NoError(t, err)
+
+		roles, err := AssignedRoles(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"editor"}, roles)
+
+		err = tester.RunCallback(ctx, C(&Strategy{
+			All: L{testRoles.Authorizer(&postModel{})},
+		}))
+		assert.NoError(t, err)
+	})
+}
@@ -63,8 +63,8 @@ func (s *Strategy) Callback() *fire.Callback {
 		s.ResourceAction = make(map[string][]*Authorizer)
 	}
 
-	// construct and return callback
-	return fire.C("ash/Strategy.Callback", fire.All(), func(ctx *fire.Context) (err error) {
+	// construct callback
+	cb := fire.C("ash/Strategy.Callback", fire.All(), func(ctx *fire.Context) (err error) {
 		// select authorizers based on operation
 		switch ctx.Operation {
 		case fire.List:
@@ -85,24 +85,67 @@ func (s *Strategy) Callback() *fire.Callback {
 
 		return err
 	})
+
+	// set origin
+	cb.Origin = s
+
+	return cb
 }
 
 func (s *Strategy) call(ctx *fire.Context, lists ...[]*Authorizer) error {
+	// get explanation
+	explanation := GetExplanation(ctx)
+	if explanation == nil {
+		return s.run(ctx, nil, lists)
+	}
+
+	// run and record
+	strategy := explanation.begin(ctx)
+	err := s.run(ctx, strategy, lists)
+	explanation.finish(ctx, strategy, err)
+
+	return err
+}
+
+func (s *Strategy) run(ctx *fire.Context, explanation *StrategyExplanation, lists [][]*Authorizer) error {
 	// loop through all lists
 	for _, list := range lists {
 		// loop through all callbacks
 		for _, authorizer := range list {
 			// check if authenticator can be run
-			if !authorizer.Matcher(ctx) {
+			matched := authorizer.Matcher(ctx)
+
+			// record step
+			var step *Step
+			if explanation != nil {
+				explanation.Steps = append(explanation.Steps, Step{
+					Authorizer: authorizer.Name,
+					Matched:    matched,
+				})
+				step = &explanation.Steps[len(explanation.Steps)-1]
+			}
+
+			// skip if not matched
+			if !matched {
 				continue
 			}
 
 			// run callback and return on error
 			enforcers, err := authorizer.Handler(ctx)
 			if err != nil {
+				if step != nil {
+					step.Error = err.Error()
+				}
 				return xo.W(err)
 			}
 
+			// record enforcers
+			if step != nil {
+				for _, enforcer := range enforcers {
+					step.Enforcers = append(step.Enforcers, enforcer.Name)
+				}
+			}
+
 			// run enforcers if provided
 			if len(enforcers) > 0 {
 				for _, enforcer := range enforcers {
@@ -116,6 +159,9 @@ func (s *Strategy) call(ctx *fire.Context, lists ...[]*Authorizer) error {
 					// run enforcer
 					err = enforcer.Handler(ctx)
 					if err != nil {
+						if step != nil {
+							step.Error = err.Error()
+						}
 						return xo.W(err)
 					}
 				}
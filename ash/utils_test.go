@@ -21,6 +21,17 @@ func (p *postModel) Info() string {
 	return p.Title
 }
 
+type userModel struct {
+	coal.Base `json:"-" bson:",inline" coal:"users"`
+	Name      string   `json:"name"`
+	Roles     []string `json:"roles" coal:"ash-roles"`
+	stick.NoValidation
+}
+
+func (u *userModel) ValidPassword(string) bool {
+	return false
+}
+
 func blank() *Authorizer {
 	return A("blank", fire.All(), func(_ *fire.Context) ([]*Enforcer, error) {
 		return nil, nil
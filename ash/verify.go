@@ -0,0 +1,274 @@
+package ash
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/256dpi/jsonapi/v2"
+
+	"github.com/256dpi/fire"
+	"github.com/256dpi/fire/coal"
+	"github.com/256dpi/fire/stick"
+)
+
+type verifyList struct {
+	label       string
+	authorizers []*Authorizer
+}
+
+// Verify will statically check the strategies used as authorizers by the
+// controllers of the provided group. It reports supported operations and
+// actions that are not covered by any matching authorizer, strategy action
+// lists for unknown actions, authorizers that never match any operation they
+// are listed for and whitelisted fields and properties that are not known to the
+// controller. Matchers that panic are reported as well. The returned list is
+// empty if no issues have been found:
+//
+//	assert.Empty(t, ash.Verify(group))
+func Verify(group *fire.Group) []string {
+	// prepare issues
+	var issues []string
+
+	// check controllers
+	for _, controller := range group.Controllers() {
+		// get name
+		name := coal.GetMeta(controller.Model).PluralName
+
+		// collect strategies
+		var list []*Strategy
+		for _, cb := range controller.Authorizers {
+			if strategy, ok := cb.Origin.(*Strategy); ok {
+				list = append(list, strategy)
+			}
+		}
+
+		// check list
+		if len(list) == 0 {
+			issues = append(issues, fmt.Sprintf("%s: no strategy", name))
+			continue
+		}
+
+		// verify strategies
+		for i, strategy := range list {
+			// prepare prefix
+			prefix := name
+			if len(list) > 1 {
+				prefix = fmt.Sprintf("%s: strategy %d", name, i+1)
+			}
+
+			// verify strategy
+			for _, issue := range strategy.verify(controller) {
+				issues = append(issues, prefix+": "+issue)
+			}
+		}
+	}
+
+	return issues
+}
+
+func (s *Strategy) verify(controller *fire.Controller) []string {
+	// prepare issues
+	var issues []string
+
+	// prepare matched and panicked authorizers
+	matched := map[*Authorizer]bool{}
+	panicked := map[*Authorizer]error{}
+
+	// check operations
+	for _, op := range []fire.Operation{fire.List, fire.Find, fire.Create, fire.Update, fire.Delete} {
+		supported, err := verifySupported(controller, op)
+		if err != nil {
+			issues = append(issues, fmt.Sprintf("supported matcher panicked for operation %s: %s", op, err))
+		} else if !supported {
+			continue
+		}
+		if !s.cover(controller, op, "", matched, panicked) {
+			issues = append(issues, fmt.Sprintf("operation %s is not covered", op))
+		}
+	}
+
+	// check collection actions
+	for _, action := range sortedKeys(controller.CollectionActions) {
+		if !s.cover(controller, fire.CollectionAction, action, matched, panicked) {
+			issues = append(issues, fmt.Sprintf("collection action %q is not covered", action))
+		}
+	}
+
+	// check resource actions
+	for _, action := range sortedKeys(controller.ResourceActions) {
+		if !s.cover(controller, fire.ResourceAction, action, matched, panicked) {
+			issues = append(issues, fmt.Sprintf("resource action %q is not covered", action))
+		}
+	}
+
+	// check unknown actions
+	for _, action := range sortedKeys(s.CollectionAction) {
+		if controller.CollectionActions[action] == nil {
+			issues = append(issues, fmt.Sprintf("unknown collection action %q", action))
+		}
+	}
+	for _, action := range sortedKeys(s.ResourceAction) {
+		if controller.ResourceActions[action] == nil {
+			issues = append(issues, fmt.Sprintf("unknown resource action %q", action))
+		}
+	}
+
+	// get meta
+	meta := coal.GetMeta(controller.Model)
+
+	// check authorizers
+	for _, list := range s.lists(controller) {
+		for i, authorizer := range list.authorizers {
+			// check reachability
+			if err := panicked[authorizer]; err != nil {
+				issues = append(issues, fmt.Sprintf("authorizer %q (%s #%d) panicked while matching: %s", authorizer.Name, list.label, i+1, err))
+			} else if !matched[authorizer] {
+				issues = append(issues, fmt.Sprintf("authorizer %q (%s #%d) is unreachable", authorizer.Name, list.label, i+1))
+			}
+
+			// check fields
+			for _, field := range authorizer.fields {
+				if meta.Fields[field] == nil && meta.NestedFields[field] == nil {
+					issues = append(issues, fmt.Sprintf("authorizer %q (%s #%d) references unknown field %q", authorizer.Name, list.label, i+1, field))
+				}
+			}
+
+			// check properties
+			for _, property := range authorizer.properties {
+				if _, ok := controller.Properties[property]; !ok {
+					issues = append(issues, fmt.Sprintf("authorizer %q (%s #%d) references unknown property %q", authorizer.Name, list.label, i+1, property))
+				}
+			}
+		}
+	}
+
+	return issues
+}
+
+func (s *Strategy) cover(controller *fire.Controller, op fire.Operation, action string, matched map[*Authorizer]bool, panicked map[*Authorizer]error) bool {
+	// prepare context
+	ctx := &fire.Context{
+		Data:           stick.Map{},
+		Operation:      op,
+		Controller:     controller,
+		JSONAPIRequest: &jsonapi.Request{},
+	}
+
+	// select lists
+	var lists [][]*Authorizer
+	switch op {
+	case fire.List:
+		lists = [][]*Authorizer{s.List, s.Read, s.All}
+	case fire.Find:
+		lists = [][]*Authorizer{s.Find, s.Read, s.All}
+	case fire.Create:
+		lists = [][]*Authorizer{s.Create, s.Write, s.All}
+	case fire.Update:
+		lists = [][]*Authorizer{s.Update, s.Write, s.All}
+	case fire.Delete:
+		lists = [][]*Authorizer{s.Delete, s.Write, s.All}
+	case fire.CollectionAction:
+		ctx.JSONAPIRequest.CollectionAction = action
+		lists = [][]*Authorizer{s.CollectionAction[action], s.CollectionActions, s.Actions, s.All}
+	case fire.ResourceAction:
+		ctx.JSONAPIRequest.ResourceAction = action
+		lists = [][]*Authorizer{s.ResourceAction[action], s.ResourceActions, s.Actions, s.All}
+	}
+
+	// match authorizers
+	covered := false
+	for _, list := range lists {
+		for _, authorizer := range list {
+			ok, err := verifyMatch(authorizer.Matcher, ctx)
+			if err != nil {
+				panicked[authorizer] = err
+			} else if ok {
+				matched[authorizer] = true
+				covered = true
+			}
+		}
+	}
+
+	return covered
+}
+
+func (s *Strategy) lists(controller *fire.Controller) []verifyList {
+	// prepare lists
+	lists := []verifyList{
+		{"List", s.List},
+		{"Find", s.Find},
+		{"Create", s.Create},
+		{"Update", s.Update},
+		{"Delete", s.Delete},
+	}
+
+	// add known action lists
+	for _, action := range sortedKeys(s.CollectionAction) {
+		if controller.CollectionActions[action] != nil {
+			lists = append(lists, verifyList{fmt.Sprintf("CollectionAction[%s]", action), s.CollectionAction[action]})
+		}
+	}
+	for _, action := range sortedKeys(s.ResourceAction) {
+		if controller.ResourceActions[action] != nil {
+			lists = append(lists, verifyList{fmt.Sprintf("ResourceAction[%s]", action), s.ResourceAction[action]})
+		}
+	}
+
+	// add general lists
+	lists = append(lists, []verifyList{
+		{"CollectionActions", s.CollectionActions},
+		{"ResourceActions", s.ResourceActions},
+		{"Read", s.Read},
+		{"Write", s.Write},
+		{"Actions", s.Actions},
+		{"All", s.All},
+	}...)
+
+	return lists
+}
+
+func verifySupported(controller *fire.Controller, op fire.Operation) (bool, error) {
+	// check matcher
+	if controller.Supported == nil {
+		return true, nil
+	}
+
+	return verifyMatch(controller.Supported, &fire.Context{
+		Data:           stick.Map{},
+		Operation:      op,
+		Controller:     controller,
+		JSONAPIRequest: &jsonapi.Request{},
+	})
+}
+
+func verifyMatch(matcher fire.Matcher, ctx *fire.Context) (ok bool, err error) {
+	// matchers that depend on request data may panic, the panic is returned
+	// as the result cannot be determined statically
+	defer func() {
+		if val := recover(); val != nil {
+			err = fmt.Errorf("%v", val)
+		}
+	}()
+
+	return matcher(ctx), nil
+}
+
+func sortedKeys(m interface{}) []string {
+	// collect keys
+	var keys []string
+	switch m := m.(type) {
+	case map[string]*fire.Action:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[string][]*Authorizer:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	}
+
+	// sort keys
+	sort.Strings(keys)
+
+	return keys
+}
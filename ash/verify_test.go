@@ -0,0 +1,108 @@
+package ash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/256dpi/fire"
+)
+
+func TestVerify(t *testing.T) {
+	action := fire.A("action", []string{"POST"}, 0, func(ctx *fire.Context) error {
+		return nil
+	})
+
+	group := fire.NewGroup(nil)
+	group.Add(&fire.Controller{
+		Model: &postModel{},
+		Properties: map[string]string{
+			"Info": "info",
+		},
+		Authorizers: fire.L{
+			C(&Strategy{
+				Read: L{accessGranted()},
+				Write: L{
+					A("update", fire.Only(fire.Update), func(_ *fire.Context) ([]*Enforcer, error) {
+						return nil, nil
+					}),
+				},
+				CollectionAction: M{
+					"foo": L{accessGranted()},
+					"bar": L{accessGranted()},
+				},
+				All: L{
+					A("never", fire.Only(fire.ResourceAction), func(_ *fire.Context) ([]*Enforcer, error) {
+						return nil, nil
+					}),
+					WhitelistFields(Fields{
+						Readable: []string{"Title", "Body"},
+					}).And(WhitelistProperties([]string{"Info", "Summary"})),
+				},
+			}),
+		},
+		CollectionActions: map[string]*fire.Action{
+			"foo": action,
+			"baz": action,
+		},
+		Supported: fire.Except(fire.Update),
+	}, &fire.Controller{
+		Model: &userModel{},
+	})
+
+	assert.Equal(t, []string{
+		`posts: unknown collection action "bar"`,
+		`posts: authorizer "update" (Write #1) is unreachable`,
+		`posts: authorizer "never" (All #1) is unreachable`,
+		`posts: authorizer "ash/And" (All #2) references unknown field "Body"`,
+		`posts: authorizer "ash/And" (All #2) references unknown property "Summary"`,
+		`users: no strategy`,
+	}, Verify(group))
+
+	group = fire.NewGroup(nil)
+	group.Add(&fire.Controller{
+		Model: &postModel{},
+		Authorizers: fire.L{
+			C(&Strategy{
+				Read:  L{accessGranted()},
+				Write: L{accessGranted()},
+			}),
+			C(&Strategy{
+				List: L{accessGranted()},
+			}),
+		},
+		CollectionActions: map[string]*fire.Action{
+			"foo": action,
+		},
+	})
+
+	assert.Equal(t, []string{
+		`posts: strategy 1: collection action "foo" is not covered`,
+		`posts: strategy 2: operation Find is not covered`,
+		`posts: strategy 2: operation Create is not covered`,
+		`posts: strategy 2: operation Update is not covered`,
+		`posts: strategy 2: operation Delete is not covered`,
+		`posts: strategy 2: collection action "foo" is not covered`,
+	}, Verify(group))
+
+	group = fire.NewGroup(nil)
+	group.Add(&fire.Controller{
+		Model: &postModel{},
+		Authorizers: fire.L{
+			C(&Strategy{
+				All: L{
+					accessGranted(),
+					A("panic", func(ctx *fire.Context) bool {
+						return ctx.Model.ID().IsZero()
+					}, func(_ *fire.Context) ([]*Enforcer, error) {
+						return nil, nil
+					}),
+				},
+			}),
+		},
+	})
+
+	issues := Verify(group)
+	assert.Len(t, issues, 1)
+	assert.Contains(t, issues[0], `posts: authorizer "panic" (All #2) panicked while matching: `)
+}
@@ -22,7 +22,8 @@ type Matrix struct {
 	Candidates []*Authorizer
 
 	// Fields is the matrix that specifies read and write permissions per field
-	// and candidate using the tags "R", "C", "U" and "W".
+	// and candidate using the tags "R", "C", "U" and "W". Nested fields may be
+	// listed using their dotted name.
 	Fields map[string][]string
 
 	// Properties is the matrix that specifies read permissions per property and
@@ -140,7 +141,8 @@ type Fields struct {
 //	}))
 //
 func WhitelistFields(fields Fields) *Authorizer {
-	return A("ash/WhitelistFields", fire.All(), func(ctx *fire.Context) ([]*Enforcer, error) {
+	// create authorizer
+	authorizer := A("ash/WhitelistFields", fire.All(), func(ctx *fire.Context) ([]*Enforcer, error) {
 		// prepare list
 		list := S{GrantAccess()}
 
@@ -170,6 +172,11 @@ func WhitelistFields(fields Fields) *Authorizer {
 
 		return list, nil
 	})
+
+	// set references
+	authorizer.fields = stick.Union(fields.Readable, fields.Writable, fields.Creatable, fields.Updatable)
+
+	return authorizer
 }
 
 // WhitelistProperties is an authorizer that will whitelist the readable
@@ -182,7 +189,8 @@ func WhitelistFields(fields Fields) *Authorizer {
 //	Token("user").And(WhitelistProperties([]string{"Info"})
 //
 func WhitelistProperties(readable []string) *Authorizer {
-	return A("ash/WhitelistProperties", fire.All(), func(ctx *fire.Context) ([]*Enforcer, error) {
+	// create authorizer
+	authorizer := A("ash/WhitelistProperties", fire.All(), func(ctx *fire.Context) ([]*Enforcer, error) {
 		// prepare list
 		list := S{GrantAccess()}
 
@@ -193,4 +201,9 @@ func WhitelistProperties(readable []string) *Authorizer {
 
 		return list, nil
 	})
+
+	// set references
+	authorizer.properties = stick.Union(readable)
+
+	return authorizer
 }
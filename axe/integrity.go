@@ -0,0 +1,38 @@
+package axe
+
+import (
+	"time"
+
+	"github.com/256dpi/fire/coal"
+	"github.com/256dpi/fire/stick"
+)
+
+// IntegrityJob is the periodic job enqueued to check the referential integrity
+// of a catalog.
+type IntegrityJob struct {
+	Base `json:"-" axe:"fire/axe.integrity"`
+	stick.NoValidation
+}
+
+// IntegrityTask will return a periodic task that can be run to periodically
+// check the referential integrity of the catalog models using
+// coal.CheckIntegrity. Broken references are repaired if requested and all
+// issues are yielded to the optional report function.
+func IntegrityTask(store *coal.Store, catalog *coal.Catalog, repair bool, report func(coal.IntegrityIssue), lifetime, timeout, periodicity time.Duration) *Task {
+	return &Task{
+		Job: &IntegrityJob{},
+		Handler: func(ctx *Context) error {
+			return coal.CheckIntegrity(ctx, store, catalog, repair, report)
+		},
+		Workers:     1,
+		MaxAttempts: 1,
+		Lifetime:    lifetime,
+		Timeout:     timeout,
+		Periodicity: periodicity,
+		PeriodicJob: Blueprint{
+			Job: &IntegrityJob{
+				Base: B("periodic"),
+			},
+		},
+	}
+}
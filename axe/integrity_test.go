@@ -0,0 +1,71 @@
+package axe
+
+import (
+	"testing"
+	"time"
+
+	"github.com/256dpi/xo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/256dpi/fire"
+	"github.com/256dpi/fire/coal"
+)
+
+type refModel struct {
+	coal.Base `json:"-" bson:",inline" coal:"refs"`
+	Job       *coal.ID `json:"-" coal:"job:jobs"`
+}
+
+func (m *refModel) Validate() error {
+	return nil
+}
+
+func TestIntegrityTask(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *fire.Tester) {
+		tester = fire.NewTester(tester.Store, &Model{}, &refModel{})
+		tester.Clean()
+
+		ref := tester.Insert(&refModel{
+			Job: coal.P(coal.New()),
+		}).(*refModel)
+
+		var issues []coal.IntegrityIssue
+		done := make(chan struct{})
+
+		task := IntegrityTask(tester.Store, coal.NewCatalog(&Model{}, &refModel{}), true, func(issue coal.IntegrityIssue) {
+			issues = append(issues, issue)
+		}, time.Minute, time.Minute, 0)
+		task.Notifier = func(ctx *Context, cancelled bool, reason string) error {
+			close(done)
+			return nil
+		}
+
+		queue := NewQueue(Options{
+			Store:    tester.Store,
+			Reporter: xo.Panic,
+		})
+		queue.Add(task)
+		<-queue.Run()
+		defer queue.Close()
+
+		job := IntegrityJob{}
+		enqueued, err := queue.Enqueue(nil, &job, 0, 0)
+		assert.NoError(t, err)
+		assert.True(t, enqueued)
+
+		<-done
+
+		model := tester.Fetch(&Model{}, job.ID()).(*Model)
+		assert.Equal(t, Completed, model.State)
+		assert.Equal(t, []coal.IntegrityIssue{
+			{
+				Model:    "refs",
+				ID:       ref.ID(),
+				Field:    "Job",
+				Ref:      coal.Ref{Coll: "jobs", ID: *ref.Job},
+				Repaired: true,
+			},
+		}, issues)
+		assert.Nil(t, tester.Fetch(&refModel{}, ref.ID()).(*refModel).Job)
+	})
+}
@@ -454,6 +454,37 @@ func (s *Storage) Release(ctx context.Context, model coal.Model, field string) e
 	return nil
 }
 
+// ReleaseAll will release all claimed links at the field on the provided
+// model. Other fields and empty links are ignored, which allows using it as
+// the release function of a coal.Privacy. The released links must be persisted
+// in the same transaction as the release to ensure consistency.
+func (s *Storage) ReleaseAll(ctx context.Context, model coal.Model, field string) error {
+	// collect links
+	var links []Link
+	switch value := stick.MustGet(model, field).(type) {
+	case Link:
+		links = append(links, value)
+	case *Link:
+		if value != nil {
+			links = append(links, *value)
+		}
+	case Links:
+		links = append(links, value...)
+	}
+
+	// release links
+	for i := range links {
+		if !links[i].File.IsZero() {
+			err := s.ReleaseLink(ctx, &links[i])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 // ReleaseLink will release the provided link. The released link must be
 // persisted in the same transaction as the release to ensure consistency.
 func (s *Storage) ReleaseLink(ctx context.Context, link *Link) error {
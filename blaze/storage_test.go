@@ -472,6 +472,68 @@ func TestStorageClaimDecorateReleaseOptional(t *testing.T) {
 	})
 }
 
+func TestStorageReleaseAll(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *fire.Tester) {
+		storage := NewStorage(tester.Store, testNotary, NewMemory(), register)
+
+		var files []coal.ID
+		for i := 0; i < 3; i++ {
+			files = append(files, tester.Insert(&File{
+				State:   Claimed,
+				Updated: time.Now(),
+				Size:    42,
+				Handle: Handle{
+					"foo": "bar",
+				},
+				Type:    "image/png",
+				Binding: "test",
+				Owner:   coal.P(coal.New()),
+			}).ID())
+		}
+
+		model := &testModel{
+			Base: coal.B(),
+			RequiredFile: Link{
+				File: files[0],
+			},
+			MultipleFiles: Links{
+				{File: files[1]},
+				{File: files[2]},
+			},
+		}
+
+		/* without transaction */
+
+		err := storage.ReleaseAll(nil, model, "RequiredFile")
+		assert.Error(t, err)
+		assert.Equal(t, "missing transaction for release", err.Error())
+
+		/* release */
+
+		err = tester.Store.T(nil, false, func(ctx context.Context) error {
+			for _, field := range []string{"RequiredFile", "OptionalFile", "MultipleFiles"} {
+				err := storage.ReleaseAll(ctx, model, field)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+
+		for _, file := range files {
+			assert.Equal(t, Released, tester.Fetch(&File{}, file).(*File).State)
+		}
+
+		/* empty links */
+
+		err = tester.Store.T(nil, false, func(ctx context.Context) error {
+			return storage.ReleaseAll(ctx, &testModel{}, "RequiredFile")
+		})
+		assert.NoError(t, err)
+	})
+}
+
 func TestStorageModifierRequired(t *testing.T) {
 	withTester(t, func(t *testing.T, tester *fire.Tester) {
 		storage := NewStorage(tester.Store, testNotary, NewMemory(), register)
@@ -67,6 +67,43 @@ func TimestampModifier() *Callback {
 	})
 }
 
+// SequenceModifier will assign the next value of the provided sequence to the
+// specified field during Create. Values provided by the client are always
+// overwritten to prevent spoofed numbers. The optional scope
+// function returns the sequence scope for the current request. Integer fields
+// are set to the plain value while string fields are set to the formatted
+// value.
+func SequenceModifier(sequence *coal.Sequence, field string, scope func(ctx *Context) string) *Callback {
+	return C("fire/SequenceModifier", Only(Create), func(ctx *Context) error {
+		// get value
+		value := reflect.ValueOf(stick.MustGet(ctx.Model, field))
+
+		// get scope
+		var name string
+		if scope != nil {
+			name = scope(ctx)
+		}
+
+		// get next value
+		num, err := sequence.Next(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		// set value
+		switch value.Kind() {
+		case reflect.String:
+			stick.MustSet(ctx.Model, field, sequence.Formatted(name, num))
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			stick.MustSet(ctx.Model, field, reflect.ValueOf(num).Convert(value.Type()).Interface())
+		default:
+			return xo.F("unsupported sequence field type %s", value.Type())
+		}
+
+		return nil
+	})
+}
+
 // NoDefault marks the specified field to have no default that needs to be
 // enforced while executing the ProtectedFieldsValidator.
 const NoDefault noDefault = iota
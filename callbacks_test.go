@@ -2,10 +2,12 @@ package fire
 
 import (
 	"encoding/base64"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
 
 	"github.com/256dpi/fire/coal"
 	"github.com/256dpi/fire/stick"
@@ -72,6 +74,57 @@ func TestTimestampModifier(t *testing.T) {
 	})
 }
 
+func TestSequenceModifier(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		type model struct {
+			coal.Base `json:"-" bson:",inline" coal:"posts"`
+			Number    int64
+			Code      string
+			stick.NoValidation
+		}
+
+		_, err := tester.Store.C(&coal.Counter{}).DeleteMany(nil, bson.M{})
+		assert.NoError(t, err)
+
+		sequence := &coal.Sequence{
+			Store: tester.Store,
+			Name:  "invoices",
+			Format: func(scope string, value int64) string {
+				return fmt.Sprintf("%s-%04d", scope, value)
+			},
+		}
+
+		number := SequenceModifier(sequence, "Number", nil)
+		code := SequenceModifier(sequence, "Code", func(ctx *Context) string {
+			return "INV"
+		})
+
+		m := &model{}
+		err = tester.RunCallback(&Context{Operation: Create, Model: m}, number)
+		assert.NoError(t, err)
+		err = tester.RunCallback(&Context{Operation: Create, Model: m}, code)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), m.Number)
+		assert.Equal(t, "INV-0001", m.Code)
+
+		m = &model{Number: 7}
+		err = tester.RunCallback(&Context{Operation: Create, Model: m}, number)
+		assert.NoError(t, err)
+		err = tester.RunCallback(&Context{Operation: Create, Model: m}, code)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), m.Number)
+		assert.Equal(t, "INV-0002", m.Code)
+
+		m = &model{Code: "INV-9999"}
+		err = tester.RunCallback(&Context{Operation: Create, Model: m}, number)
+		assert.NoError(t, err)
+		err = tester.RunCallback(&Context{Operation: Create, Model: m}, code)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), m.Number)
+		assert.Equal(t, "INV-0003", m.Code)
+	})
+}
+
 func TestProtectedAttributesValidatorOnCreate(t *testing.T) {
 	withTester(t, func(t *testing.T, tester *Tester) {
 		validator := ProtectedFieldsValidator(map[string]interface{}{
@@ -0,0 +1,263 @@
+package fire
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/coal"
+	"github.com/256dpi/fire/stick"
+)
+
+// The available cascade rules. A rule is declared by flagging a has-one or
+// has-many relationship field of a model:
+//
+//	Comments coal.HasMany `json:"-" bson:"-" coal:"comments:comments:post,fire-cascade-delete"`
+//
+// The rules are enforced by the controller when a resource is deleted. If the
+// controller soft deletes resources, dependent resources of the delete rule are
+// soft deleted as well. Dependent resources are changed directly using the
+// store and not through their controllers. Their authorizers, validators,
+// notifiers and other callbacks are therefore not run.
+const (
+	// CascadeRestrict will deny the deletion if dependent resources exist.
+	// Soft deleted dependent resources are ignored.
+	CascadeRestrict = "fire-restrict"
+
+	// CascadeDelete will delete all dependent resources. If the deleted
+	// resource is soft deleted, the dependent resources are soft deleted, which
+	// requires a field flagged as "fire-soft-delete".
+	CascadeDelete = "fire-cascade-delete"
+
+	// CascadeNullify will unset the reference in all dependent resources. The
+	// inverse relationship must be an optional to-one or a to-many relationship.
+	CascadeNullify = "fire-nullify"
+
+	// CascadeSoftDelete will soft delete all dependent resources. The dependent
+	// model must have a field flagged as "fire-soft-delete".
+	CascadeSoftDelete = "fire-cascade-soft-delete"
+)
+
+var cascadeRules = []string{CascadeRestrict, CascadeDelete, CascadeNullify, CascadeSoftDelete}
+
+func cascadeRule(field *coal.Field) string {
+	// find rule
+	var rule string
+	for _, flag := range field.Flags {
+		if stick.Contains(cascadeRules, flag) {
+			if rule != "" {
+				panic(fmt.Sprintf(`fire: multiple cascade rules on field "%s"`, field.Name))
+			}
+			rule = flag
+		}
+	}
+
+	return rule
+}
+
+func (c *Controller) cascade(ctx *Context, model coal.Model, ids []coal.ID, soft bool, depth int, visited map[coal.Ref]bool) error {
+	// check fields
+	for _, field := range coal.GetMeta(model).OrderedFields {
+		// check field
+		if !field.HasOne && !field.HasMany {
+			continue
+		}
+
+		// get rule
+		rule := cascadeRule(field)
+		if rule == "" {
+			continue
+		}
+
+		// get related controller
+		rc := ctx.Group.controllers[field.RelType]
+		if rc == nil {
+			return xo.F("missing related controller for %s", field.RelType)
+		}
+
+		// get inverse field
+		var inverse *coal.Field
+		for _, f := range coal.GetMeta(rc.Model).OrderedFields {
+			if f.RelName == field.RelInverse && (f.ToOne || f.ToMany) {
+				inverse = f
+			}
+		}
+		if inverse == nil {
+			return xo.F("missing inverse relationship %s for %s", field.RelInverse, field.RelType)
+		}
+
+		// prepare filter
+		filter := bson.M{
+			inverse.Name: bson.M{
+				"$in": ids,
+			},
+		}
+
+		// get soft delete field
+		softDeleteField := coal.L(rc.Model, "fire-soft-delete", false)
+
+		// soft delete dependent documents of soft deleted documents
+		if rule == CascadeDelete && soft {
+			if softDeleteField == "" {
+				return xo.F("cannot cascade delete %s of soft deleted resource", field.RelType)
+			}
+			rule = CascadeSoftDelete
+		}
+
+		// exclude soft deleted documents
+		if softDeleteField != "" && (rule == CascadeRestrict || rule == CascadeSoftDelete) {
+			filter[softDeleteField] = nil
+		}
+
+		// get manager
+		manager := ctx.Store.M(rc.Model)
+
+		// handle rule
+		switch rule {
+		case CascadeRestrict:
+			// count dependent documents
+			count, err := manager.Count(ctx, filter, 0, 1, false)
+			if err != nil {
+				return err
+			} else if count > 0 {
+				return xo.SF("resource has dependent resources")
+			}
+		case CascadeNullify:
+			// check field
+			if inverse.ToOne && !inverse.Optional {
+				return xo.F("cannot nullify required relationship %s of %s", inverse.RelName, field.RelType)
+			}
+
+			// nullify to-one references
+			if inverse.ToOne {
+				_, err := manager.UpdateAll(ctx, filter, bson.M{
+					"$set": bson.M{
+						inverse.Name: nil,
+					},
+				}, false, coal.NoValidation)
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			// remove to-many references
+			if !ctx.Store.Lungo() {
+				_, err := manager.UpdateAll(ctx, filter, bson.M{
+					"$pull": bson.M{
+						inverse.Name: bson.M{
+							"$in": ids,
+						},
+					},
+				}, false, coal.NoValidation)
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			// find dependent documents (lungo does not support $pull)
+			var list []coal.Model
+			iter, err := manager.FindEach(ctx, filter, nil, 0, 0, false, coal.NoValidation)
+			if err != nil {
+				return err
+			}
+			for iter.Next() {
+				doc := coal.GetMeta(rc.Model).Make()
+				err = iter.Decode(doc)
+				if err != nil {
+					iter.Close()
+					return err
+				}
+				list = append(list, doc)
+			}
+			iter.Close()
+
+			// check error
+			err = iter.Error()
+			if err != nil {
+				return err
+			}
+
+			// remove to-many references individually
+			for _, doc := range list {
+				var refs []coal.ID
+				for _, id := range stick.MustGet(doc, inverse.Name).([]coal.ID) {
+					if !coal.Contains(ids, id) {
+						refs = append(refs, id)
+					}
+				}
+				_, err = manager.Update(ctx, nil, doc.ID(), bson.M{
+					"$set": bson.M{
+						inverse.Name: refs,
+					},
+				}, false, coal.NoValidation)
+				if err != nil {
+					return err
+				}
+			}
+		case CascadeDelete, CascadeSoftDelete:
+			// check soft delete field
+			if rule == CascadeSoftDelete && softDeleteField == "" {
+				return xo.F("missing soft delete field for %s", field.RelType)
+			}
+
+			// find dependent documents
+			list, err := manager.Distinct(ctx, "_id", filter, false)
+			if err != nil {
+				return err
+			}
+
+			// collect unvisited documents
+			var dependents []coal.ID
+			for _, item := range list {
+				ref := coal.Ref{Coll: coal.GetMeta(rc.Model).Collection, ID: item.(coal.ID)}
+				if !visited[ref] {
+					visited[ref] = true
+					dependents = append(dependents, ref.ID)
+				}
+			}
+			if len(dependents) == 0 {
+				continue
+			}
+
+			// check depth
+			if depth >= c.CascadeDepth {
+				return xo.SF("cascade depth limit exceeded")
+			}
+
+			// cascade dependent documents
+			err = c.cascade(ctx, rc.Model, dependents, rule == CascadeSoftDelete, depth+1, visited)
+			if err != nil {
+				return err
+			}
+
+			// prepare filter
+			filter = bson.M{
+				"_id": bson.M{
+					"$in": dependents,
+				},
+			}
+
+			// delete or soft delete dependent documents
+			if rule == CascadeDelete {
+				_, err = manager.DeleteAll(ctx, filter)
+			} else {
+				_, err = manager.UpdateAll(ctx, filter, bson.M{
+					"$set": bson.M{
+						softDeleteField: time.Now(),
+					},
+				}, false, coal.NoValidation)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,260 @@
+package fire
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/coal"
+	"github.com/256dpi/fire/stick"
+)
+
+type parentModel struct {
+	coal.Base `json:"-" bson:",inline" coal:"parents"`
+	Name      string       `json:"name"`
+	Children  coal.HasMany `json:"-" bson:"-" coal:"children:children:parent,fire-cascade-delete"`
+	Labels    coal.HasMany `json:"-" bson:"-" coal:"labels:labels:parents,fire-nullify"`
+	Archives  coal.HasMany `json:"-" bson:"-" coal:"archives:archives:parent,fire-cascade-soft-delete"`
+	Lock      coal.HasOne  `json:"-" bson:"-" coal:"lock:locks:parent,fire-restrict"`
+	stick.NoValidation
+}
+
+type childModel struct {
+	coal.Base `json:"-" bson:",inline" coal:"children"`
+	Parent    coal.ID `json:"-" coal:"parent:parents"`
+	stick.NoValidation
+}
+
+type labelModel struct {
+	coal.Base `json:"-" bson:",inline" coal:"labels"`
+	Parents   []coal.ID `json:"-" coal:"parents:parents"`
+	stick.NoValidation
+}
+
+type archiveModel struct {
+	coal.Base `json:"-" bson:",inline" coal:"archives"`
+	Parent    coal.ID    `json:"-" coal:"parent:parents"`
+	Deleted   *time.Time `json:"-" coal:"fire-soft-delete"`
+	stick.NoValidation
+}
+
+type lockModel struct {
+	coal.Base `json:"-" bson:",inline" coal:"locks"`
+	Parent    coal.ID `json:"-" coal:"parent:parents"`
+	stick.NoValidation
+}
+
+type nodeModel struct {
+	coal.Base `json:"-" bson:",inline" coal:"nodes"`
+	Parent    *coal.ID     `json:"-" coal:"parent:nodes"`
+	Children  coal.HasMany `json:"-" bson:"-" coal:"children:nodes:parent,fire-cascade-delete"`
+	stick.NoValidation
+}
+
+type trashModel struct {
+	coal.Base `json:"-" bson:",inline" coal:"trashes"`
+	Items     coal.HasMany `json:"-" bson:"-" coal:"items:trash-items:trash,fire-cascade-delete"`
+	Deleted   *time.Time   `json:"-" coal:"fire-soft-delete"`
+	stick.NoValidation
+}
+
+type binModel struct {
+	coal.Base `json:"-" bson:",inline" coal:"bins"`
+	Notes     coal.HasMany `json:"-" bson:"-" coal:"notes:bin-notes:bin,fire-cascade-delete"`
+	Deleted   *time.Time   `json:"-" coal:"fire-soft-delete"`
+	stick.NoValidation
+}
+
+type trashItemModel struct {
+	coal.Base `json:"-" bson:",inline" coal:"trash-items"`
+	Trash     coal.ID    `json:"-" coal:"trash:trashes"`
+	Deleted   *time.Time `json:"-" coal:"fire-soft-delete"`
+	stick.NoValidation
+}
+
+type binNoteModel struct {
+	coal.Base `json:"-" bson:",inline" coal:"bin-notes"`
+	Bin       coal.ID `json:"-" coal:"bin:bins"`
+	stick.NoValidation
+}
+
+func TestCascade(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		tester = NewTester(tester.Store, &parentModel{}, &childModel{}, &labelModel{}, &archiveModel{}, &lockModel{})
+		tester.Clean()
+
+		tester.Assign("", &Controller{
+			Model: &parentModel{},
+			Store: tester.Store,
+		}, &Controller{
+			Model: &childModel{},
+			Store: tester.Store,
+		}, &Controller{
+			Model: &labelModel{},
+			Store: tester.Store,
+		}, &Controller{
+			Model:      &archiveModel{},
+			Store:      tester.Store,
+			SoftDelete: true,
+		}, &Controller{
+			Model: &lockModel{},
+			Store: tester.Store,
+		})
+
+		parent1 := tester.Insert(&parentModel{Name: "1"})
+		parent2 := tester.Insert(&parentModel{Name: "2"})
+		child1 := tester.Insert(&childModel{Parent: parent1.ID()})
+		child2 := tester.Insert(&childModel{Parent: parent2.ID()})
+		label := tester.Insert(&labelModel{Parents: []coal.ID{parent1.ID(), parent2.ID()}})
+		archive := tester.Insert(&archiveModel{Parent: parent1.ID()})
+		lock := tester.Insert(&lockModel{Parent: parent1.ID()})
+
+		// restricted
+		tester.Request("DELETE", "parents/"+parent1.ID().Hex(), "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusBadRequest, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"errors": [{
+					"status": "400",
+					"detail": "resource has dependent resources"
+				}]
+			}`, r.Body.String())
+		})
+
+		assert.Equal(t, 2, tester.Count(&parentModel{}))
+		assert.Equal(t, 2, tester.Count(&childModel{}))
+
+		tester.Delete(lock)
+
+		// cascaded
+		tester.Request("DELETE", "parents/"+parent1.ID().Hex(), "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusNoContent, r.Result().StatusCode, tester.DebugRequest(rq, r))
+		})
+
+		assert.Equal(t, 1, tester.Count(&parentModel{}))
+		assert.Equal(t, 0, tester.Count(&childModel{}, bson.M{"_id": child1.ID()}))
+		assert.Equal(t, 1, tester.Count(&childModel{}, bson.M{"_id": child2.ID()}))
+		assert.Equal(t, []coal.ID{parent2.ID()}, tester.Fetch(&labelModel{}, label.ID()).(*labelModel).Parents)
+		assert.NotNil(t, tester.Fetch(&archiveModel{}, archive.ID()).(*archiveModel).Deleted)
+	})
+}
+
+func TestCascadeSoftDeleted(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		tester = NewTester(tester.Store, &trashModel{}, &trashItemModel{}, &binModel{}, &binNoteModel{})
+		tester.Clean()
+
+		var lastErr error
+		group := NewGroup(func(err error) {
+			lastErr = err
+		})
+
+		group.Add(&Controller{
+			Model:      &trashModel{},
+			Store:      tester.Store,
+			SoftDelete: true,
+		}, &Controller{
+			Model:      &trashItemModel{},
+			Store:      tester.Store,
+			SoftDelete: true,
+		}, &Controller{
+			Model:      &binModel{},
+			Store:      tester.Store,
+			SoftDelete: true,
+		}, &Controller{
+			Model: &binNoteModel{},
+			Store: tester.Store,
+		})
+
+		tester.Handler = group.Endpoint("")
+
+		trash := tester.Insert(&trashModel{})
+		item := tester.Insert(&trashItemModel{Trash: trash.ID()})
+		bin := tester.Insert(&binModel{})
+		tester.Insert(&binNoteModel{Bin: bin.ID()})
+
+		// soft deleted
+		tester.Request("DELETE", "trashes/"+trash.ID().Hex(), "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusNoContent, r.Result().StatusCode, tester.DebugRequest(rq, r))
+		})
+
+		assert.NotNil(t, tester.Fetch(&trashModel{}, trash.ID()).(*trashModel).Deleted)
+		assert.NotNil(t, tester.Fetch(&trashItemModel{}, item.ID()).(*trashItemModel).Deleted)
+
+		// not soft deletable
+		tester.Request("DELETE", "bins/"+bin.ID().Hex(), "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusInternalServerError, r.Result().StatusCode, tester.DebugRequest(rq, r))
+		})
+
+		assert.Error(t, lastErr)
+		assert.Equal(t, "cannot cascade delete bin-notes of soft deleted resource", lastErr.Error())
+		assert.Nil(t, tester.Fetch(&binModel{}, bin.ID()).(*binModel).Deleted)
+		assert.Equal(t, 1, tester.Count(&binNoteModel{}))
+	})
+}
+
+func TestCascadeDepth(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		tester = NewTester(tester.Store, &nodeModel{})
+		tester.Clean()
+
+		tester.Assign("", &Controller{
+			Model:        &nodeModel{},
+			Store:        tester.Store,
+			CascadeDepth: 2,
+		})
+
+		node1 := tester.Insert(&nodeModel{})
+		node2 := tester.Insert(&nodeModel{Parent: coal.P(node1.ID())})
+		node3 := tester.Insert(&nodeModel{Parent: coal.P(node2.ID())})
+		node4 := tester.Insert(&nodeModel{Parent: coal.P(node3.ID())})
+
+		// depth exceeded
+		tester.Request("DELETE", "nodes/"+node1.ID().Hex(), "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusBadRequest, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"errors": [{
+					"status": "400",
+					"detail": "cascade depth limit exceeded"
+				}]
+			}`, r.Body.String())
+		})
+
+		assert.Equal(t, 4, tester.Count(&nodeModel{}))
+
+		// loop
+		tester.Update(node2, bson.M{
+			"$set": bson.M{
+				"Parent": node4.ID(),
+			},
+		})
+		tester.Update(node4, bson.M{
+			"$set": bson.M{
+				"Parent": node2.ID(),
+			},
+		})
+
+		tester.Request("DELETE", "nodes/"+node2.ID().Hex(), "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusNoContent, r.Result().StatusCode, tester.DebugRequest(rq, r))
+		})
+
+		assert.Equal(t, 1, tester.Count(&nodeModel{}, bson.M{"_id": node1.ID()}))
+	})
+}
+
+func TestCascadeRules(t *testing.T) {
+	assert.PanicsWithValue(t, `fire: multiple cascade rules on field "Children"`, func() {
+		type invalidModel struct {
+			coal.Base `json:"-" bson:",inline" coal:"invalids"`
+			Children  coal.HasMany `json:"-" bson:"-" coal:"children:children:parent,fire-restrict,fire-cascade-delete"`
+			stick.NoValidation
+		}
+
+		NewGroup(nil).Add(&Controller{
+			Model: &invalidModel{},
+		})
+	})
+}
@@ -0,0 +1,273 @@
+package coal
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"sort"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// backupBatchSize is the number of documents inserted at once during restore.
+const backupBatchSize = 500
+
+type backupEntry struct {
+	Model    string `bson:"model"`
+	Document bson.D `bson:"document"`
+}
+
+// Backup will write all documents of the catalog's models to the provided
+// writer. The archive is written as canonical extended JSON with one document
+// per line, ordered by model plural name and document id. The optional
+// filters, keyed by model plural name, select the documents that are included.
+// Documents are written as stored, which includes encrypted fields.
+func (c *Catalog) Backup(ctx context.Context, store *Store, w io.Writer, filters map[string]bson.M) (int, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Catalog.Backup")
+	defer span.End()
+
+	// check filters
+	for name := range filters {
+		if c.models[name] == nil {
+			return 0, xo.F("unknown model %q", name)
+		}
+	}
+
+	// get sorted names
+	names := make([]string, 0, len(c.models))
+	for name := range c.models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// prepare writer
+	buf := bufio.NewWriter(w)
+
+	// write models
+	var total int
+	for _, name := range names {
+		// get filter
+		filter := filters[name]
+		if filter == nil {
+			filter = bson.M{}
+		}
+
+		// find documents
+		iter, err := store.C(c.models[name]).Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}))
+		if err != nil {
+			return total, err
+		}
+
+		// write documents
+		for iter.Next() {
+			// decode document
+			var doc bson.D
+			err = iter.Decode(&doc)
+			if err != nil {
+				iter.Close()
+				return total, err
+			}
+
+			// encode line
+			line, err := bson.MarshalExtJSON(backupEntry{
+				Model:    name,
+				Document: doc,
+			}, true, false)
+			if err != nil {
+				iter.Close()
+				return total, xo.W(err)
+			}
+
+			// write line
+			_, err = buf.Write(append(line, '\n'))
+			if err != nil {
+				iter.Close()
+				return total, xo.W(err)
+			}
+
+			// increment
+			total++
+		}
+
+		// check error
+		err = iter.Error()
+		if err != nil {
+			return total, err
+		}
+	}
+
+	// flush writer
+	err := buf.Flush()
+	if err != nil {
+		return total, xo.W(err)
+	}
+
+	return total, nil
+}
+
+// Restore will insert all documents from an archive written by Backup. The
+// documents are inserted as is, without validation and encryption. If remap is
+// false, the original ids are preserved and the restore fails if a document
+// already exists. If remap is true, every document gets a new id and all
+// references to archived documents, wherever they appear in the documents,
+// are replaced accordingly. Remapping requires the whole archive to be read
+// into memory. The method returns the ids that have been assigned.
+func (c *Catalog) Restore(ctx context.Context, store *Store, r io.Reader, remap bool) (map[ID]ID, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Catalog.Restore")
+	defer span.End()
+
+	// prepare ids
+	ids := map[ID]ID{}
+
+	// prepare batch
+	var batch []interface{}
+	var batchModel string
+	flush := func() error {
+		// check batch
+		if len(batch) == 0 {
+			return nil
+		}
+
+		// insert documents
+		_, err := store.C(c.models[batchModel]).InsertMany(ctx, batch)
+		if err != nil {
+			return err
+		}
+
+		// reset batch
+		batch = nil
+
+		return nil
+	}
+
+	// prepare insert
+	insert := func(entry backupEntry) error {
+		// flush batch if model changes or full
+		if entry.Model != batchModel || len(batch) >= backupBatchSize {
+			err := flush()
+			if err != nil {
+				return err
+			}
+			batchModel = entry.Model
+		}
+
+		// add document
+		batch = append(batch, entry.Document)
+
+		return nil
+	}
+
+	// prepare reader
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	// read entries
+	var entries []backupEntry
+	for scanner.Scan() {
+		// skip empty lines
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		// decode entry
+		var entry backupEntry
+		err := bson.UnmarshalExtJSON(scanner.Bytes(), true, &entry)
+		if err != nil {
+			return nil, xo.W(err)
+		}
+
+		// check model
+		if c.models[entry.Model] == nil {
+			return nil, xo.F("unknown model %q", entry.Model)
+		}
+
+		// get id
+		id, ok := backupID(entry.Document)
+		if !ok {
+			return nil, xo.F("missing document id")
+		}
+
+		// collect entry if remapping
+		if remap {
+			ids[id] = New()
+			entries = append(entries, entry)
+			continue
+		}
+
+		// otherwise insert directly
+		ids[id] = id
+		err = insert(entry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// check error
+	err := scanner.Err()
+	if err != nil {
+		return nil, xo.W(err)
+	}
+
+	// remap and insert collected entries
+	for _, entry := range entries {
+		entry.Document = remapIDs(entry.Document, ids).(bson.D)
+		err = insert(entry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// flush batch
+	err = flush()
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func backupID(doc bson.D) (ID, bool) {
+	// find id
+	for _, e := range doc {
+		if e.Key == "_id" {
+			id, ok := e.Value.(ID)
+			return id, ok
+		}
+	}
+
+	return ID{}, false
+}
+
+func remapIDs(value interface{}, ids map[ID]ID) interface{} {
+	switch v := value.(type) {
+	case bson.D:
+		// remap values
+		doc := make(bson.D, 0, len(v))
+		for _, e := range v {
+			doc = append(doc, bson.E{Key: e.Key, Value: remapIDs(e.Value, ids)})
+		}
+
+		return doc
+	case bson.A:
+		// remap items
+		list := make(bson.A, 0, len(v))
+		for _, item := range v {
+			list = append(list, remapIDs(item, ids))
+		}
+
+		return list
+	case ID:
+		// replace known ids
+		if id, ok := ids[v]; ok {
+			return id
+		}
+
+		return v
+	default:
+		return v
+	}
+}
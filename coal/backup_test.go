@@ -0,0 +1,80 @@
+package coal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCatalogBackupRestore(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		catalog := NewCatalog(&postModel{}, &commentModel{}, &polyModel{})
+
+		post1 := tester.Insert(&postModel{Title: "post-1"}).(*postModel)
+		post2 := tester.Insert(&postModel{Title: "post-2"}).(*postModel)
+		comment := tester.Insert(&commentModel{Message: "msg", Post: post1.ID()}).(*commentModel)
+		poly := tester.Insert(&polyModel{
+			Ref1: R(post1),
+			Ref3: []Ref{R(post2)},
+		}).(*polyModel)
+
+		var buf bytes.Buffer
+		n, err := catalog.Backup(nil, tester.Store, &buf, map[string]bson.M{
+			"posts": {"title": "post-1"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, n)
+		assert.Equal(t, 3, strings.Count(buf.String(), "\n"))
+		archive := buf.Bytes()
+
+		_, err = catalog.Backup(nil, tester.Store, &buf, map[string]bson.M{
+			"foo": {},
+		})
+		assert.Error(t, err)
+
+		/* preserve */
+
+		tester.Clean()
+
+		ids, err := catalog.Restore(nil, tester.Store, bytes.NewReader(archive), false)
+		assert.NoError(t, err)
+		assert.Equal(t, map[ID]ID{
+			post1.ID():   post1.ID(),
+			comment.ID(): comment.ID(),
+			poly.ID():    poly.ID(),
+		}, ids)
+		assert.Equal(t, 1, tester.Count(&postModel{}))
+		assert.Equal(t, comment, tester.Fetch(&commentModel{}, comment.ID()))
+		assert.Equal(t, poly, tester.Fetch(&polyModel{}, poly.ID()))
+
+		_, err = catalog.Restore(nil, tester.Store, bytes.NewReader(archive), false)
+		assert.Error(t, err)
+
+		/* remap */
+
+		ids, err = catalog.Restore(nil, tester.Store, bytes.NewReader(archive), true)
+		assert.NoError(t, err)
+		assert.Len(t, ids, 3)
+		assert.Equal(t, 2, tester.Count(&postModel{}))
+		assert.Equal(t, 2, tester.Count(&commentModel{}))
+
+		newComment := tester.Fetch(&commentModel{}, ids[comment.ID()]).(*commentModel)
+		assert.Equal(t, "msg", newComment.Message)
+		assert.Equal(t, ids[post1.ID()], newComment.Post)
+
+		newPoly := tester.Fetch(&polyModel{}, ids[poly.ID()]).(*polyModel)
+		assert.Equal(t, ids[post1.ID()], newPoly.Ref1.ID)
+		assert.Equal(t, []Ref{R(post2)}, newPoly.Ref3)
+
+		/* errors */
+
+		_, err = catalog.Restore(nil, tester.Store, strings.NewReader(`{"model":"foo","document":{}}`), false)
+		assert.Error(t, err)
+
+		_, err = catalog.Restore(nil, tester.Store, strings.NewReader(`{"model":"posts","document":{}}`), false)
+		assert.Error(t, err)
+	})
+}
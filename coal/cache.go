@@ -0,0 +1,458 @@
+package coal
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+type cacheEntry struct {
+	model Model
+	data  []byte
+}
+
+// Cache keeps a live read-only copy of a collection in memory. It uses
+// Reconcile to load all documents and then apply all following changes. If the
+// underlying stream fails, the cache is fully reloaded. Returned models are
+// shared and must not be modified.
+type Cache struct {
+	store    *Store
+	model    Model
+	filter   func(Model) bool
+	reporter func(error)
+	keys     []string
+
+	mutex   sync.RWMutex
+	entries map[ID]*cacheEntry
+	indexes map[string]map[interface{}]map[ID]Model
+	loading map[ID]*cacheEntry
+	synced  chan struct{}
+	stream  *Stream
+	gen     int
+	closed  bool
+
+	subMutex    sync.Mutex
+	subscribers map[int]func(Event, ID, Model)
+	subCounter  int
+}
+
+// NewCache will create and start a cache for the specified model. The optional
+// filter selects the models that are kept in the cache. The reporter is called
+// with stream errors before the cache is reloaded. While reloading, the cache
+// continues to serve the previously loaded models. The specified fields are
+// indexed as secondary keys and can be used with Lookup.
+func NewCache(store *Store, model Model, filter func(Model) bool, reporter func(error), keys ...string) *Cache {
+	// get meta
+	meta := GetMeta(model)
+
+	// check keys
+	for _, key := range keys {
+		field := meta.Fields[key]
+		if field == nil {
+			panic(fmt.Sprintf(`coal: unknown cache key "%s"`, key))
+		} else if !field.Type.Comparable() {
+			panic(fmt.Sprintf(`coal: cache key "%s" is not comparable`, key))
+		}
+	}
+
+	// create cache
+	c := &Cache{
+		store:       store,
+		model:       model,
+		filter:      filter,
+		reporter:    reporter,
+		keys:        keys,
+		entries:     map[ID]*cacheEntry{},
+		indexes:     map[string]map[interface{}]map[ID]Model{},
+		synced:      make(chan struct{}),
+		subscribers: map[int]func(Event, ID, Model){},
+	}
+
+	// prepare indexes
+	for _, key := range keys {
+		c.indexes[key] = map[interface{}]map[ID]Model{}
+	}
+
+	// open stream
+	c.open()
+
+	return c
+}
+
+// Synced returns a channel that is closed once the cache has been loaded. The
+// returned channel is replaced when the cache is being reloaded.
+func (c *Cache) Synced() <-chan struct{} {
+	// acquire mutex
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.synced
+}
+
+// Get will return the cached model with the specified id or nil if it has not
+// been found.
+func (c *Cache) Get(id ID) Model {
+	// acquire mutex
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	// get entry
+	entry := c.entries[id]
+	if entry == nil {
+		return nil
+	}
+
+	return entry.model
+}
+
+// Lookup will return all cached models that have the specified value in the
+// specified secondary key field.
+func (c *Cache) Lookup(key string, value interface{}) []Model {
+	// acquire mutex
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	// get index
+	index, ok := c.indexes[key]
+	if !ok {
+		panic(fmt.Sprintf(`coal: unknown cache key "%s"`, key))
+	}
+
+	// collect models
+	list := make([]Model, 0, len(index[value]))
+	for _, model := range index[value] {
+		list = append(list, model)
+	}
+
+	return list
+}
+
+// All will return all cached models.
+func (c *Cache) All() []Model {
+	// acquire mutex
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	// collect models
+	list := make([]Model, 0, len(c.entries))
+	for _, entry := range c.entries {
+		list = append(list, entry.model)
+	}
+
+	return list
+}
+
+// Subscribe will register a callback that is called with all changes to the
+// cache. The callback is called after the cache has been updated and may
+// therefore read from the cache. The returned function may be called to
+// remove the subscription.
+func (c *Cache) Subscribe(fn func(event Event, id ID, model Model)) func() {
+	// acquire mutex
+	c.subMutex.Lock()
+	defer c.subMutex.Unlock()
+
+	// add subscriber
+	c.subCounter++
+	n := c.subCounter
+	c.subscribers[n] = fn
+
+	return func() {
+		// acquire mutex
+		c.subMutex.Lock()
+		defer c.subMutex.Unlock()
+
+		// remove subscriber
+		delete(c.subscribers, n)
+	}
+}
+
+// Close will close the cache.
+func (c *Cache) Close() {
+	// acquire mutex
+	c.mutex.Lock()
+	c.closed = true
+	stream := c.stream
+	c.mutex.Unlock()
+
+	// close stream
+	stream.Close()
+}
+
+func (c *Cache) open() {
+	// increment generation
+	c.gen++
+	gen := c.gen
+
+	// open stream
+	c.stream = Reconcile(c.store, c.model, func() {
+		c.loaded(gen)
+	}, func(model Model) {
+		c.created(gen, model)
+	}, func(model Model) {
+		c.updated(gen, model)
+	}, func(id ID) {
+		c.deleted(gen, id)
+	}, func(err error) {
+		c.errored(gen, err)
+	})
+}
+
+func (c *Cache) created(gen int, model Model) {
+	// check filter
+	if c.filter != nil && !c.filter(model) {
+		return
+	}
+
+	// prepare entry
+	entry, err := makeCacheEntry(model)
+	if err != nil {
+		c.errored(gen, err)
+		return
+	}
+
+	// acquire mutex
+	c.mutex.Lock()
+
+	// check generation
+	if gen != c.gen {
+		c.mutex.Unlock()
+		return
+	}
+
+	// add to loading set if not synced
+	select {
+	case <-c.synced:
+	default:
+		if c.loading == nil {
+			c.loading = map[ID]*cacheEntry{}
+		}
+		c.loading[model.ID()] = entry
+		c.mutex.Unlock()
+		return
+	}
+
+	// set entry
+	c.set(model.ID(), entry)
+	c.mutex.Unlock()
+
+	// notify
+	c.notify(Created, model.ID(), model)
+}
+
+func (c *Cache) updated(gen int, model Model) {
+	// prepare entry
+	entry, err := makeCacheEntry(model)
+	if err != nil {
+		c.errored(gen, err)
+		return
+	}
+
+	// acquire mutex
+	c.mutex.Lock()
+
+	// check generation
+	if gen != c.gen {
+		c.mutex.Unlock()
+		return
+	}
+
+	// check existence
+	_, existed := c.entries[model.ID()]
+
+	// remove if filtered
+	if c.filter != nil && !c.filter(model) {
+		if existed {
+			c.set(model.ID(), nil)
+		}
+		c.mutex.Unlock()
+		if existed {
+			c.notify(Deleted, model.ID(), nil)
+		}
+		return
+	}
+
+	// set entry
+	c.set(model.ID(), entry)
+	c.mutex.Unlock()
+
+	// notify
+	if existed {
+		c.notify(Updated, model.ID(), model)
+	} else {
+		c.notify(Created, model.ID(), model)
+	}
+}
+
+func (c *Cache) deleted(gen int, id ID) {
+	// acquire mutex
+	c.mutex.Lock()
+
+	// check generation and existence
+	_, existed := c.entries[id]
+	if gen != c.gen || !existed {
+		c.mutex.Unlock()
+		return
+	}
+
+	// remove entry
+	c.set(id, nil)
+	c.mutex.Unlock()
+
+	// notify
+	c.notify(Deleted, id, nil)
+}
+
+func (c *Cache) loaded(gen int) {
+	// prepare events
+	type change struct {
+		event Event
+		id    ID
+		model Model
+	}
+	var changes []change
+
+	// acquire mutex
+	c.mutex.Lock()
+
+	// check generation
+	if gen != c.gen {
+		c.mutex.Unlock()
+		return
+	}
+
+	// remove missing entries
+	for id := range c.entries {
+		if c.loading[id] == nil {
+			c.set(id, nil)
+			changes = append(changes, change{event: Deleted, id: id})
+		}
+	}
+
+	// add new and changed entries
+	for id, entry := range c.loading {
+		existing := c.entries[id]
+		if existing == nil {
+			c.set(id, entry)
+			changes = append(changes, change{event: Created, id: id, model: entry.model})
+		} else if !bytes.Equal(existing.data, entry.data) {
+			c.set(id, entry)
+			changes = append(changes, change{event: Updated, id: id, model: entry.model})
+		}
+	}
+
+	// reset loading set and signal sync
+	c.loading = nil
+	close(c.synced)
+	c.mutex.Unlock()
+
+	// notify
+	for _, ch := range changes {
+		c.notify(ch.event, ch.id, ch.model)
+	}
+}
+
+func (c *Cache) errored(gen int, err error) {
+	// report error
+	if c.reporter != nil {
+		c.reporter(err)
+	}
+
+	// acquire mutex
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// check if closed or already reloading
+	if c.closed || gen != c.gen {
+		return
+	}
+
+	// reset loading set and sync signal
+	c.loading = nil
+	select {
+	case <-c.synced:
+		c.synced = make(chan struct{})
+	default:
+	}
+
+	// get stream and increment generation to ignore further callbacks
+	stream := c.stream
+	c.gen++
+
+	// reload asynchronously as the callback is called by the stream
+	go func() {
+		// close stream
+		stream.Close()
+
+		// acquire mutex
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		// reopen stream if not closed
+		if !c.closed {
+			c.open()
+		}
+	}()
+}
+
+func (c *Cache) set(id ID, entry *cacheEntry) {
+	// remove existing entry from indexes
+	if existing := c.entries[id]; existing != nil {
+		for _, key := range c.keys {
+			value := stick.MustGet(existing.model, key)
+			delete(c.indexes[key][value], id)
+			if len(c.indexes[key][value]) == 0 {
+				delete(c.indexes[key], value)
+			}
+		}
+	}
+
+	// handle removal
+	if entry == nil {
+		delete(c.entries, id)
+		return
+	}
+
+	// set entry
+	c.entries[id] = entry
+
+	// add entry to indexes
+	for _, key := range c.keys {
+		value := stick.MustGet(entry.model, key)
+		if c.indexes[key][value] == nil {
+			c.indexes[key][value] = map[ID]Model{}
+		}
+		c.indexes[key][value][id] = entry.model
+	}
+}
+
+func (c *Cache) notify(event Event, id ID, model Model) {
+	// get subscribers
+	c.subMutex.Lock()
+	list := make([]func(Event, ID, Model), 0, len(c.subscribers))
+	for _, fn := range c.subscribers {
+		list = append(list, fn)
+	}
+	c.subMutex.Unlock()
+
+	// call subscribers
+	for _, fn := range list {
+		fn(event, id, model)
+	}
+}
+
+func makeCacheEntry(model Model) (*cacheEntry, error) {
+	// encode model
+	data, err := bson.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cacheEntry{
+		model: model,
+		data:  data,
+	}, nil
+}
@@ -0,0 +1,139 @@
+package coal
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		time.Sleep(100 * time.Millisecond)
+
+		post1 := tester.Insert(&postModel{
+			Title:    "foo",
+			TextBody: "a",
+		}).(*postModel)
+
+		tester.Insert(&postModel{
+			Title:     "bar",
+			Published: true,
+		})
+
+		cache := NewCache(tester.Store, &postModel{}, func(model Model) bool {
+			return !model.(*postModel).Published
+		}, nil, "Title", "TextBody")
+		defer cache.Close()
+
+		<-cache.Synced()
+
+		assert.Len(t, cache.All(), 1)
+		assert.Equal(t, "foo", cache.Get(post1.ID()).(*postModel).Title)
+		assert.Len(t, cache.Lookup("Title", "foo"), 1)
+		assert.Len(t, cache.Lookup("Title", "bar"), 0)
+		assert.Len(t, cache.Lookup("TextBody", "a"), 1)
+
+		var mutex sync.Mutex
+		var events []Event
+		signal := make(chan struct{}, 10)
+		unsubscribe := cache.Subscribe(func(event Event, id ID, model Model) {
+			mutex.Lock()
+			events = append(events, event)
+			mutex.Unlock()
+			signal <- struct{}{}
+		})
+
+		post2 := tester.Insert(&postModel{
+			Title:    "baz",
+			TextBody: "a",
+		}).(*postModel)
+		<-signal
+
+		assert.Len(t, cache.All(), 2)
+		assert.Len(t, cache.Lookup("TextBody", "a"), 2)
+
+		post2.Title = "qux"
+		tester.Replace(post2)
+		<-signal
+
+		assert.Len(t, cache.Lookup("Title", "baz"), 0)
+		assert.Len(t, cache.Lookup("Title", "qux"), 1)
+
+		post2.Published = true
+		tester.Replace(post2)
+		<-signal
+
+		assert.Nil(t, cache.Get(post2.ID()))
+		assert.Len(t, cache.Lookup("TextBody", "a"), 1)
+
+		tester.Delete(post1)
+		<-signal
+
+		assert.Nil(t, cache.Get(post1.ID()))
+		assert.Len(t, cache.All(), 0)
+
+		mutex.Lock()
+		assert.Equal(t, []Event{Created, Updated, Deleted, Deleted}, events)
+		mutex.Unlock()
+
+		unsubscribe()
+
+		assert.PanicsWithValue(t, `coal: unknown cache key "Foo"`, func() {
+			cache.Lookup("Foo", "bar")
+		})
+	})
+
+	assert.PanicsWithValue(t, `coal: cache key "Posts" is not comparable`, func() {
+		NewCache(nil, &selectionModel{}, nil, nil, "Posts")
+	})
+}
+
+func TestCacheReload(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		time.Sleep(100 * time.Millisecond)
+
+		post := tester.Insert(&postModel{
+			Title: "foo",
+		}).(*postModel)
+
+		var mutex sync.Mutex
+		var errs []error
+		cache := NewCache(tester.Store, &postModel{}, nil, func(err error) {
+			mutex.Lock()
+			errs = append(errs, err)
+			mutex.Unlock()
+		})
+		defer cache.Close()
+
+		<-cache.Synced()
+		assert.NotNil(t, cache.Get(post.ID()))
+
+		deleted := make(chan ID, 1)
+		cache.Subscribe(func(event Event, id ID, model Model) {
+			if event == Deleted {
+				deleted <- id
+			}
+		})
+
+		err := tester.Store.C(&postModel{}).Native().Drop(nil)
+		assert.NoError(t, err)
+
+		assert.Equal(t, post.ID(), <-deleted)
+		<-cache.Synced()
+		assert.Nil(t, cache.Get(post.ID()))
+
+		mutex.Lock()
+		assert.NotEmpty(t, errs)
+		assert.True(t, ErrInvalidated.Is(errs[0]))
+		mutex.Unlock()
+
+		post = tester.Insert(&postModel{
+			Title: "bar",
+		}).(*postModel)
+
+		time.Sleep(100 * time.Millisecond)
+		assert.NotNil(t, cache.Get(post.ID()))
+	})
+}
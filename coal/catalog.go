@@ -23,6 +23,7 @@ type Index struct {
 	Unique bool
 	Expiry time.Duration
 	Filter bson.D
+	Geo    bool
 }
 
 // Compile will compile the index to a mongo.IndexModel.
@@ -46,9 +47,17 @@ func (i *Index) Compile() mongo.IndexModel {
 		opts.SetExpireAfterSeconds(int32(i.Expiry / time.Second))
 	}
 
+	// prepare keys
+	keys := Sort(key...)
+	if i.Geo {
+		for j := range keys {
+			keys[j].Value = "2dsphere"
+		}
+	}
+
 	// add index
 	return mongo.IndexModel{
-		Keys:    Sort(key...),
+		Keys:    keys,
 		Options: opts,
 	}
 }
@@ -167,8 +176,23 @@ func (c *Catalog) AddPartialIndex(model Model, unique bool, expiry time.Duration
 	})
 }
 
+// AddGeoIndex will add a 2dsphere index for the specified point or polygon
+// field to the internal index list.
+func (c *Catalog) AddGeoIndex(model Model, field string) {
+	// get name
+	name := GetMeta(model).PluralName
+
+	// add index
+	c.indexes[name] = append(c.indexes[name], Index{
+		Model:  model,
+		Fields: []string{field},
+		Geo:    true,
+	})
+}
+
 // EnsureIndexes will ensure that the added indexes exist. It may fail early if
 // some of the indexes are already existing and do not match the supplied index.
+// Use ReconcileIndexes to also update changed and drop stale indexes.
 func (c *Catalog) EnsureIndexes(store *Store) error {
 	// create context
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
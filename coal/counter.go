@@ -0,0 +1,212 @@
+package coal
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+// Counter stores the last assigned value of a sequence scope.
+type Counter struct {
+	Base `json:"-" bson:",inline" coal:"counters"`
+
+	// The name of the sequence.
+	Name string `json:"name"`
+
+	// The scope of the sequence.
+	Scope string `json:"scope"`
+
+	// The last assigned or reserved value.
+	Value int64 `json:"value"`
+}
+
+// Validate will validate the model.
+func (c *Counter) Validate() error {
+	return stick.Validate(c, func(v *stick.Validator) {
+		v.Value("Name", false, stick.IsNotZero)
+	})
+}
+
+// AddCounterIndexes will add counter indexes to the provided catalog.
+func AddCounterIndexes(catalog *Catalog) {
+	// index and require name and scope to be unique
+	catalog.AddIndex(&Counter{}, true, 0, "Name", "Scope")
+}
+
+type sequenceBlock struct {
+	mutex sync.Mutex
+	next  int64
+	end   int64
+}
+
+// Sequence generates sequential numbers per scope using atomically incremented
+// counters. Without a block size, numbers are assigned in order and, if
+// generated within a transaction, without gaps. With a block size, numbers are
+// reserved in blocks and handed out from memory outside of transactions which
+// increases throughput at the cost of gaps and out of order assignments across
+// processes.
+//
+// Note: A unique index should be added using AddCounterIndexes.
+type Sequence struct {
+	// The store used to persist the counters.
+	Store *Store
+
+	// The name of the sequence.
+	Name string
+
+	// The number of values reserved at once when generating outside of a
+	// transaction. Values below two disable the reservation of blocks.
+	Block int64
+
+	// The function used to format values. If missing, the plain value is used.
+	Format func(scope string, value int64) string
+
+	mutex  sync.Mutex
+	blocks map[string]*sequenceBlock
+}
+
+// Next will return the next value of the specified scope. If the context
+// carries a transaction, the increment is part of the transaction and the
+// block cache is bypassed.
+func (s *Sequence) Next(ctx context.Context, scope string) (int64, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Sequence.Next")
+	defer span.End()
+
+	// check transaction
+	ok, store := GetTransaction(ctx)
+	if ok && store != s.Store {
+		return 0, xo.F("transaction store mismatch")
+	}
+
+	// increment directly if in transaction or not using blocks
+	if ok || s.Block < 2 {
+		return s.Reserve(ctx, scope, 1)
+	}
+
+	// get block
+	block := s.block(scope)
+
+	// acquire block mutex
+	block.mutex.Lock()
+	defer block.mutex.Unlock()
+
+	// reserve block if exhausted
+	if block.next > block.end {
+		first, err := s.Reserve(ctx, scope, s.Block)
+		if err != nil {
+			return 0, err
+		}
+		block.next = first
+		block.end = first + s.Block - 1
+	}
+
+	// get value
+	value := block.next
+	block.next++
+
+	return value, nil
+}
+
+func (s *Sequence) block(scope string) *sequenceBlock {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// ensure blocks
+	if s.blocks == nil {
+		s.blocks = map[string]*sequenceBlock{}
+	}
+
+	// ensure block
+	block := s.blocks[scope]
+	if block == nil {
+		block = &sequenceBlock{next: 1}
+		s.blocks[scope] = block
+	}
+
+	return block
+}
+
+// NextString will return the next value of the specified scope formatted using
+// the configured format function.
+func (s *Sequence) NextString(ctx context.Context, scope string) (string, error) {
+	// get next value
+	value, err := s.Next(ctx, scope)
+	if err != nil {
+		return "", err
+	}
+
+	return s.Formatted(scope, value), nil
+}
+
+// Formatted will return the provided value formatted using the configured
+// format function.
+func (s *Sequence) Formatted(scope string, value int64) string {
+	// use format if available
+	if s.Format != nil {
+		return s.Format(scope, value)
+	}
+
+	return strconv.FormatInt(value, 10)
+}
+
+// Reserve will atomically reserve the specified amount of consecutive values
+// in the specified scope and return the first value. The values of a new
+// scope start with one.
+func (s *Sequence) Reserve(ctx context.Context, scope string, n int64) (int64, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Sequence.Reserve")
+	defer span.End()
+
+	// check amount
+	if n < 1 {
+		return 0, xo.F("invalid amount")
+	}
+
+	// prepare filter and update
+	filter := bson.M{
+		"Name":  s.Name,
+		"Scope": scope,
+	}
+	update := bson.M{
+		"$inc": bson.M{
+			"Value": n,
+		},
+	}
+
+	// increment counter, retry once if a concurrent upsert inserted the counter
+	var counter Counter
+	_, err := s.Store.M(&counter).Upsert(ctx, &counter, filter, update, nil, false, NoValidation)
+	if IsDuplicate(err) && !HasTransaction(ctx) {
+		_, err = s.Store.M(&counter).Upsert(ctx, &counter, filter, update, nil, false, NoValidation)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return counter.Value - n + 1, nil
+}
+
+// Current will return the last assigned or reserved value of the specified
+// scope.
+func (s *Sequence) Current(ctx context.Context, scope string) (int64, error) {
+	// find counter
+	var counter Counter
+	found, err := s.Store.M(&counter).FindFirst(ctx, &counter, bson.M{
+		"Name":  s.Name,
+		"Scope": scope,
+	}, nil, 0, false)
+	if err != nil {
+		return 0, err
+	} else if !found {
+		return 0, nil
+	}
+
+	return counter.Value, nil
+}
@@ -0,0 +1,153 @@
+package coal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/256dpi/xo"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSequence(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		_, err := tester.Store.C(&Counter{}).DeleteMany(nil, bson.M{})
+		assert.NoError(t, err)
+
+		seq := &Sequence{
+			Store: tester.Store,
+			Name:  "tickets",
+		}
+
+		n, err := seq.Current(nil, "a")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), n)
+
+		for i := int64(1); i <= 3; i++ {
+			n, err = seq.Next(nil, "a")
+			assert.NoError(t, err)
+			assert.Equal(t, i, n)
+		}
+
+		n, err = seq.Next(nil, "b")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+
+		n, err = seq.Reserve(nil, "a", 10)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(4), n)
+
+		n, err = seq.Current(nil, "a")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(13), n)
+
+		_, err = seq.Reserve(nil, "a", 0)
+		assert.Error(t, err)
+
+		str, err := seq.NextString(nil, "b")
+		assert.NoError(t, err)
+		assert.Equal(t, "2", str)
+
+		seq.Format = func(scope string, value int64) string {
+			return fmt.Sprintf("%s-%03d", scope, value)
+		}
+
+		str, err = seq.NextString(nil, "b")
+		assert.NoError(t, err)
+		assert.Equal(t, "b-003", str)
+	})
+}
+
+func TestSequenceBlock(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		_, err := tester.Store.C(&Counter{}).DeleteMany(nil, bson.M{})
+		assert.NoError(t, err)
+
+		seq1 := &Sequence{
+			Store: tester.Store,
+			Name:  "orders",
+			Block: 5,
+		}
+		seq2 := &Sequence{
+			Store: tester.Store,
+			Name:  "orders",
+			Block: 5,
+		}
+
+		n, err := seq1.Next(nil, "")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+
+		n, err = seq2.Next(nil, "")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(6), n)
+
+		n, err = seq1.Next(nil, "")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+
+		n, err = seq1.Current(nil, "")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(10), n)
+
+		var mutex sync.Mutex
+		var wg sync.WaitGroup
+		seen := map[int64]bool{}
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					n, err := seq1.Next(nil, "")
+					assert.NoError(t, err)
+					mutex.Lock()
+					assert.False(t, seen[n])
+					seen[n] = true
+					mutex.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Len(t, seen, 40)
+	})
+}
+
+func TestSequenceTransaction(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		_, err := tester.Store.C(&Counter{}).DeleteMany(nil, bson.M{})
+		assert.NoError(t, err)
+
+		seq := &Sequence{
+			Store: tester.Store,
+			Name:  "invoices",
+			Block: 10,
+		}
+
+		err = tester.Store.T(nil, false, func(ctx context.Context) error {
+			n, err := seq.Next(ctx, "")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), n)
+
+			n, err = seq.Next(ctx, "")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(2), n)
+
+			return xo.F("abort")
+		})
+		assert.Error(t, err)
+
+		n, err := seq.Current(nil, "")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), n)
+
+		other := MustOpen(nil, "test-fire-coal-other", xo.Panic)
+		err = other.T(nil, false, func(ctx context.Context) error {
+			_, err := seq.Next(ctx, "")
+			return err
+		})
+		assert.Error(t, err)
+		assert.Equal(t, "transaction store mismatch", err.Error())
+	})
+}
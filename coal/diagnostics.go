@@ -0,0 +1,225 @@
+package coal
+
+import (
+	"strings"
+	"time"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrUnindexed is returned by managers in strict diagnostics mode if a query is
+// not supported by an index.
+var ErrUnindexed = xo.BF("query not supported by an index")
+
+// Diagnostics configures the analysis of queries issued through managers.
+type Diagnostics struct {
+	// The catalog that is used to look up the available indexes. Queries are
+	// only analyzed if a catalog is configured.
+	Catalog *Catalog
+
+	// The duration after which operations are reported as slow. Zero disables
+	// the reporting of slow operations.
+	SlowThreshold time.Duration
+
+	// Whether queries that would cause a collection scan or in-memory sort
+	// should fail with ErrUnindexed instead of being reported. This is useful
+	// in tests to ensure that all queries are indexed.
+	Strict bool
+}
+
+// UseDiagnostics will set the diagnostics that are used by managers to analyze
+// queries. Detected collection scans, in-memory sorts and slow operations are
+// reported using the store reporter and tagged on the operation span. It should
+// be called before the store is used.
+func (s *Store) UseDiagnostics(diagnostics *Diagnostics) {
+	// set diagnostics
+	s.diagnostics = diagnostics
+
+	// reset managers
+	s.managers.Range(func(key, _ interface{}) bool {
+		s.managers.Delete(key)
+		return true
+	})
+}
+
+// QueryAnalysis is the result of a static query analysis.
+type QueryAnalysis struct {
+	// Whether no index supports the filter.
+	CollectionScan bool
+
+	// Whether no index supports the sort.
+	InMemorySort bool
+}
+
+// Issues will return a list of the detected issues.
+func (a QueryAnalysis) Issues() []string {
+	// collect issues
+	var issues []string
+	if a.CollectionScan {
+		issues = append(issues, "collection scan")
+	}
+	if a.InMemorySort {
+		issues = append(issues, "in-memory sort")
+	}
+
+	return issues
+}
+
+// Analyze will statically check whether the provided translated filter and
+// sort documents can be supported by the indexes added for the specified model
+// or the implicit "_id" index. A filter is considered supported if one of its
+// fields is the first field of an index. A sort is considered supported if it
+// matches, in the same or fully reversed direction, the index fields that
+// follow the leading fields used by the filter. Fields nested in "$or", "$nor"
+// and other operators are not analyzed. Empty filters are not reported as
+// collection scans.
+func (c *Catalog) Analyze(model Model, filter, sort bson.D) QueryAnalysis {
+	// collect filter fields
+	fields := map[string]bool{}
+	collectFilterFields(filter, fields)
+
+	// prepare indexes
+	indexes := []bson.D{{{Key: "_id", Value: int32(1)}}}
+	for _, index := range c.indexes[GetMeta(model).PluralName] {
+		indexes = append(indexes, index.Compile().Keys.(bson.D))
+	}
+
+	// check indexes
+	filterOK := len(fields) == 0
+	sortOK := len(sort) == 0
+	for _, keys := range indexes {
+		// check filter
+		usable := len(fields) == 0 || fields[keys[0].Key]
+		if usable {
+			filterOK = true
+		}
+
+		// check sort
+		if usable && len(sort) > 0 && indexSupportsSort(keys, fields, sort) {
+			sortOK = true
+		}
+	}
+
+	return QueryAnalysis{
+		CollectionScan: !filterOK,
+		InMemorySort:   !sortOK,
+	}
+}
+
+func collectFilterFields(filter bson.D, fields map[string]bool) {
+	for _, e := range filter {
+		// handle conjunctions
+		if e.Key == "$and" {
+			if list, ok := e.Value.(bson.A); ok {
+				for _, item := range list {
+					if doc, ok := item.(bson.D); ok {
+						collectFilterFields(doc, fields)
+					}
+				}
+			}
+			continue
+		}
+
+		// skip other operators
+		if strings.HasPrefix(e.Key, "$") {
+			continue
+		}
+
+		// add field
+		fields[e.Key] = true
+	}
+}
+
+func indexSupportsSort(keys bson.D, fields map[string]bool, sort bson.D) bool {
+	// skip leading fields used by the filter
+	i := 0
+	for i < len(keys) && fields[keys[i].Key] && keys[i].Key != sort[0].Key {
+		i++
+	}
+
+	// check remaining fields
+	if len(keys)-i < len(sort) {
+		return false
+	}
+
+	// compare fields and directions
+	var reversed bool
+	for j, e := range sort {
+		key := keys[i+j]
+		if key.Key != e.Key {
+			return false
+		}
+		dir, ok := key.Value.(int32)
+		if !ok {
+			return false
+		}
+		same := dir == e.Value.(int32)
+		if j == 0 {
+			reversed = !same
+		} else if same == reversed {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (m *Manager) diagnose(span *xo.Span, op string, filter bson.D, sort interface{}) (func(), error) {
+	// check diagnostics
+	diag := m.diagnostics
+	if diag == nil {
+		return func() {}, nil
+	}
+
+	// analyze query
+	if diag.Catalog != nil {
+		sortDoc, _ := sort.(bson.D)
+		issues := diag.Catalog.Analyze(m.meta.Make(), filter, sortDoc).Issues()
+		if len(issues) > 0 {
+			// tag span
+			if span != nil {
+				span.Tag("issues", strings.Join(issues, ", "))
+			}
+
+			// fail in strict mode
+			if diag.Strict {
+				return nil, ErrUnindexed.WrapF("%s on %q: %s", op, m.meta.Collection, strings.Join(issues, ", "))
+			}
+
+			// report issues
+			m.report(xo.F("%s on %q: %s (filter: %v, sort: %v)", op, m.meta.Collection, strings.Join(issues, ", "), filter, sort))
+		}
+	}
+
+	// check threshold
+	if diag.SlowThreshold <= 0 {
+		return func() {}, nil
+	}
+
+	// get start
+	start := time.Now()
+
+	return func() {
+		// check duration
+		duration := time.Since(start)
+		if duration < diag.SlowThreshold {
+			return
+		}
+
+		// tag span
+		if span != nil {
+			span.Tag("slow", true)
+		}
+
+		// report operation
+		m.report(xo.F("slow %s on %q took %s (filter: %v, sort: %v)", op, m.meta.Collection, duration, filter, sort))
+	}, nil
+}
+
+func (m *Manager) report(err error) {
+	// report error
+	if m.reporter != nil {
+		m.reporter(err)
+	}
+}
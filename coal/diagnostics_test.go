@@ -0,0 +1,146 @@
+package coal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCatalogAnalyze(t *testing.T) {
+	catalog := NewCatalog(&postModel{})
+	catalog.AddIndex(&postModel{}, false, 0, "Title", "-TextBody")
+	catalog.AddIndex(&postModel{}, false, 0, "Published")
+
+	table := []struct {
+		filter bson.D
+		sort   bson.D
+		issues []string
+	}{
+		{
+			filter: bson.D{},
+			sort:   nil,
+		},
+		{
+			filter: bson.D{{Key: "_id", Value: New()}},
+			sort:   nil,
+		},
+		{
+			filter: bson.D{},
+			sort:   Sort("-_id"),
+		},
+		{
+			filter: bson.D{{Key: "title", Value: "foo"}},
+			sort:   nil,
+		},
+		{
+			filter: bson.D{{Key: "title", Value: "foo"}, {Key: "text_body", Value: "bar"}},
+			sort:   nil,
+		},
+		{
+			filter: bson.D{{Key: "text_body", Value: "bar"}},
+			sort:   nil,
+			issues: []string{"collection scan"},
+		},
+		{
+			filter: bson.D{{Key: "$and", Value: bson.A{
+				bson.D{{Key: "published", Value: true}},
+			}}},
+			sort: nil,
+		},
+		{
+			filter: bson.D{{Key: "$or", Value: bson.A{
+				bson.D{{Key: "text_body", Value: "bar"}},
+			}}},
+			sort: nil,
+		},
+		{
+			filter: bson.D{{Key: "title", Value: "foo"}},
+			sort:   Sort("-text_body"),
+		},
+		{
+			filter: bson.D{{Key: "title", Value: "foo"}},
+			sort:   Sort("text_body"),
+		},
+		{
+			filter: bson.D{},
+			sort:   Sort("title", "-text_body"),
+		},
+		{
+			filter: bson.D{},
+			sort:   Sort("-title", "text_body"),
+		},
+		{
+			filter: bson.D{},
+			sort:   Sort("title", "text_body"),
+			issues: []string{"in-memory sort"},
+		},
+		{
+			filter: bson.D{{Key: "published", Value: true}},
+			sort:   Sort("title"),
+			issues: []string{"in-memory sort"},
+		},
+		{
+			filter: bson.D{{Key: "text_body", Value: "bar"}},
+			sort:   Sort("published"),
+			issues: []string{"collection scan", "in-memory sort"},
+		},
+	}
+
+	for i, item := range table {
+		analysis := catalog.Analyze(&postModel{}, item.filter, item.sort)
+		assert.Equal(t, item.issues, analysis.Issues(), i)
+	}
+}
+
+func TestManagerDiagnostics(t *testing.T) {
+	var reports []string
+	store := MustOpen(nil, "test-fire-coal-diagnostics", func(err error) {
+		reports = append(reports, err.Error())
+	})
+
+	catalog := NewCatalog(&postModel{})
+	catalog.AddIndex(&postModel{}, false, 0, "Title")
+
+	store.UseDiagnostics(&Diagnostics{
+		Catalog: catalog,
+	})
+
+	tester := NewTester(store, &postModel{})
+	tester.Insert(&postModel{Title: "foo"})
+
+	var list []postModel
+	err := store.M(&postModel{}).FindAll(nil, &list, bson.M{"Title": "foo"}, nil, 0, 0, false, NoTransaction)
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	assert.Empty(t, reports)
+
+	n, err := store.M(&postModel{}).Count(nil, bson.M{"TextBody": "bar"}, 0, 0, false, NoTransaction)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	assert.Len(t, reports, 1)
+	assert.True(t, strings.HasPrefix(reports[0], `Count on "posts": collection scan`), reports[0])
+
+	store.UseDiagnostics(&Diagnostics{
+		Catalog: catalog,
+		Strict:  true,
+	})
+
+	_, err = store.M(&postModel{}).FindFirst(nil, &postModel{}, bson.M{"Title": "foo"}, []string{"Published"}, 0, false)
+	assert.Error(t, err)
+	assert.True(t, ErrUnindexed.Is(err))
+	assert.Equal(t, `FindFirst on "posts": in-memory sort: query not supported by an index`, err.Error())
+	assert.Len(t, reports, 1)
+
+	store.UseDiagnostics(&Diagnostics{
+		SlowThreshold: time.Nanosecond,
+	})
+
+	found, err := store.M(&postModel{}).FindFirst(nil, &postModel{}, bson.M{"TextBody": "bar"}, nil, 0, false)
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Len(t, reports, 2)
+	assert.True(t, strings.HasPrefix(reports[1], `slow FindFirst on "posts" took`), reports[1])
+}
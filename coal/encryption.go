@@ -0,0 +1,571 @@
+package coal
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/256dpi/lungo/bsonkit"
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/256dpi/fire/stick"
+)
+
+// EncryptedFlag marks string and byte slice fields that should be encrypted
+// using random nonces. Encrypted fields cannot be used in filters.
+const EncryptedFlag = "fire-encrypted"
+
+// DeterministicFlag marks string and byte slice fields that should be
+// encrypted using deterministic nonces. Deterministically encrypted fields can
+// be used in equality filters ($eq, $ne, $in and $nin) at the cost of
+// revealing which documents share the same value.
+const DeterministicFlag = "fire-encrypted-deterministic"
+
+const encryptionPrefix = "$enc$"
+
+var encryptionKeyID = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`).MatchString
+
+var stringType = reflect.TypeOf("")
+var bytesType = reflect.TypeOf([]byte{})
+
+// EncryptionKey is a key used to encrypt and decrypt field values.
+type EncryptionKey struct {
+	// The key id that is stored with every encrypted value.
+	ID string
+
+	// The 16, 24 or 32 byte key e.g. derived using heat.Secret.Derive.
+	Key []byte
+}
+
+type encryptionKey struct {
+	id   string
+	aead cipher.AEAD
+	mac  []byte
+}
+
+// Encryptor encrypts and decrypts field values using AES-GCM. Values are always
+// encrypted using the first key while all keys are used for decryption. This
+// allows the rotation of keys by prepending a new key and re-encrypting existing
+// documents using ReEncrypt.
+type Encryptor struct {
+	keys    []*encryptionKey
+	indexes map[string]*encryptionKey
+}
+
+// NewEncryptor will create and return a new encryptor using the provided keys.
+//
+// Note: This method panics if no or invalid keys are provided.
+func NewEncryptor(keys ...EncryptionKey) *Encryptor {
+	// check keys
+	if len(keys) == 0 {
+		panic("coal: missing encryption keys")
+	}
+
+	// prepare encryptor
+	encryptor := &Encryptor{
+		indexes: map[string]*encryptionKey{},
+	}
+
+	// add keys
+	for _, key := range keys {
+		// check id
+		if !encryptionKeyID(key.ID) {
+			panic(fmt.Sprintf(`coal: invalid encryption key id "%s"`, key.ID))
+		} else if encryptor.indexes[key.ID] != nil {
+			panic(fmt.Sprintf(`coal: duplicate encryption key id "%s"`, key.ID))
+		}
+
+		// create cipher
+		block, err := aes.NewCipher(key.Key)
+		if err != nil {
+			panic(fmt.Sprintf(`coal: invalid encryption key "%s": %s`, key.ID, err.Error()))
+		}
+
+		// create aead
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			panic(err)
+		}
+
+		// derive mac key
+		mac := hmac.New(sha256.New, key.Key)
+		mac.Write([]byte("coal/Encryptor.nonce"))
+
+		// add key
+		k := &encryptionKey{
+			id:   key.ID,
+			aead: aead,
+			mac:  mac.Sum(nil),
+		}
+		encryptor.keys = append(encryptor.keys, k)
+		encryptor.indexes[key.ID] = k
+	}
+
+	return encryptor
+}
+
+// Encrypt will encrypt the provided plaintext using the current key. The
+// additional data is authenticated but not included in the result. If
+// deterministic is set, the same plaintext will always yield the same result.
+func (e *Encryptor) Encrypt(plaintext []byte, data string, deterministic bool) (string, error) {
+	return e.encrypt(e.keys[0], plaintext, data, deterministic)
+}
+
+// Decrypt will decrypt the provided value and return the plaintext and the id
+// of the used key.
+func (e *Encryptor) Decrypt(value string, data string) ([]byte, string, error) {
+	// check prefix
+	if !IsEncrypted(value) {
+		return nil, "", xo.F("value is not encrypted")
+	}
+
+	// split value
+	parts := strings.SplitN(strings.TrimPrefix(value, encryptionPrefix), "$", 2)
+	if len(parts) != 2 {
+		return nil, "", xo.F("malformed encrypted value")
+	}
+
+	// get key
+	key := e.indexes[parts[0]]
+	if key == nil {
+		return nil, "", xo.F("unknown encryption key %q", parts[0])
+	}
+
+	// decode value
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, "", xo.W(err)
+	}
+
+	// check length
+	if len(raw) < key.aead.NonceSize() {
+		return nil, "", xo.F("malformed encrypted value")
+	}
+
+	// decrypt value
+	plaintext, err := key.aead.Open(nil, raw[:key.aead.NonceSize()], raw[key.aead.NonceSize():], []byte(data))
+	if err != nil {
+		return nil, "", xo.W(err)
+	}
+
+	return plaintext, key.id, nil
+}
+
+// IsEncrypted returns whether the provided value has been encrypted.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptionPrefix)
+}
+
+func (e *Encryptor) encrypt(key *encryptionKey, plaintext []byte, data string, deterministic bool) (string, error) {
+	// prepare nonce
+	nonce := make([]byte, key.aead.NonceSize())
+	if deterministic {
+		mac := hmac.New(sha256.New, key.mac)
+		mac.Write([]byte(data))
+		mac.Write([]byte{0})
+		mac.Write(plaintext)
+		copy(nonce, mac.Sum(nil))
+	} else {
+		_, err := rand.Read(nonce)
+		if err != nil {
+			return "", xo.W(err)
+		}
+	}
+
+	// encrypt value
+	raw := key.aead.Seal(nonce, nonce, plaintext, []byte(data))
+
+	return encryptionPrefix + key.id + "$" + base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func encryptedFields(meta *Meta) []*Field {
+	// check fields
+	if len(meta.FlaggedFields[EncryptedFlag]) == 0 && len(meta.FlaggedFields[DeterministicFlag]) == 0 {
+		return nil
+	}
+
+	// collect fields in order
+	var list []*Field
+	for _, field := range meta.OrderedFields {
+		if stick.Contains(field.Flags, EncryptedFlag) || stick.Contains(field.Flags, DeterministicFlag) {
+			list = append(list, field)
+		}
+	}
+
+	return list
+}
+
+func encryptionData(meta *Meta, field *Field) string {
+	return meta.Collection + "." + field.BSONKey
+}
+
+func encryptValue(encryptor *Encryptor, key *encryptionKey, meta *Meta, field *Field, value interface{}) (interface{}, error) {
+	// check encryptor
+	if encryptor == nil {
+		return nil, xo.F("missing encryptor for field %q", field.Name)
+	}
+
+	// get key
+	if key == nil {
+		key = encryptor.keys[0]
+	}
+
+	// get deterministic
+	deterministic := stick.Contains(field.Flags, DeterministicFlag)
+
+	// encrypt value
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return v, nil
+		}
+		return encryptor.encrypt(key, []byte(v), encryptionData(meta, field), deterministic)
+	case primitive.Binary:
+		if len(v.Data) == 0 {
+			return v, nil
+		}
+		str, err := encryptor.encrypt(key, v.Data, encryptionData(meta, field), deterministic)
+		if err != nil {
+			return nil, err
+		}
+		return primitive.Binary{Subtype: v.Subtype, Data: []byte(str)}, nil
+	case nil:
+		return nil, nil
+	default:
+		return nil, xo.F("unsupported value %T for encrypted field %q", value, field.Name)
+	}
+}
+
+func decryptValue(encryptor *Encryptor, meta *Meta, field *Field, value []byte) ([]byte, bool, error) {
+	// skip unencrypted values
+	if !IsEncrypted(string(value)) {
+		return value, false, nil
+	}
+
+	// check encryptor
+	if encryptor == nil {
+		return nil, false, xo.F("missing encryptor for field %q", field.Name)
+	}
+
+	// decrypt value
+	plaintext, _, err := encryptor.Decrypt(string(value), encryptionData(meta, field))
+	if err != nil {
+		return nil, false, err
+	}
+
+	return plaintext, true, nil
+}
+
+func (t *Translator) encrypt(doc bson.D, filter bool) error {
+	for i, pair := range doc {
+		switch pair.Key {
+		case "$and", "$or", "$nor":
+			// encrypt sub filters
+			list, _ := pair.Value.(bson.A)
+			for _, item := range list {
+				if sub, ok := item.(bson.D); ok {
+					err := t.encrypt(sub, true)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		case "$set", "$setOnInsert":
+			// encrypt values
+			sub, _ := pair.Value.(bson.D)
+			for j, item := range sub {
+				field := t.encryptedField(item.Key)
+				if field != nil {
+					value, err := encryptValue(t.encryptor, nil, t.meta, field, item.Value)
+					if err != nil {
+						return err
+					}
+					sub[j].Value = value
+				}
+			}
+		case "$unset":
+		default:
+			// check update operators
+			if strings.HasPrefix(pair.Key, "$") {
+				sub, _ := pair.Value.(bson.D)
+				for _, item := range sub {
+					if field := t.encryptedField(item.Key); field != nil {
+						return xo.F("unsupported operator %q on encrypted field %q", pair.Key, field.Name)
+					}
+				}
+				continue
+			}
+
+			// check field
+			field := t.encryptedField(pair.Key)
+			if field == nil || !filter {
+				continue
+			}
+
+			// encrypt condition
+			value, err := t.encryptCondition(field, pair.Value)
+			if err != nil {
+				return err
+			}
+			doc[i].Value = value
+		}
+	}
+
+	return nil
+}
+
+func (t *Translator) encryptCondition(field *Field, value interface{}) (interface{}, error) {
+	// check mode
+	if !stick.Contains(field.Flags, DeterministicFlag) {
+		return nil, xo.F("filter on non-deterministically encrypted field %q", field.Name)
+	}
+
+	// handle plain values
+	sub, ok := value.(bson.D)
+	if !ok {
+		list, err := t.encryptAll(field, bson.A{value})
+		if err != nil {
+			return nil, err
+		}
+		return bson.D{{Key: "$in", Value: list}}, nil
+	}
+
+	// handle operators
+	out := make(bson.D, 0, len(sub))
+	for _, item := range sub {
+		switch item.Key {
+		case "$eq", "$ne":
+			list, err := t.encryptAll(field, bson.A{item.Value})
+			if err != nil {
+				return nil, err
+			}
+			op := "$in"
+			if item.Key == "$ne" {
+				op = "$nin"
+			}
+			out = append(out, bson.E{Key: op, Value: list})
+		case "$in", "$nin":
+			values, _ := item.Value.(bson.A)
+			list, err := t.encryptAll(field, values)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, bson.E{Key: item.Key, Value: list})
+		case "$exists":
+			out = append(out, item)
+		default:
+			return nil, xo.F("unsupported operator %q on encrypted field %q", item.Key, field.Name)
+		}
+	}
+
+	return out, nil
+}
+
+func (t *Translator) encryptAll(field *Field, values bson.A) (bson.A, error) {
+	// check encryptor
+	if t.encryptor == nil {
+		return nil, xo.F("missing encryptor for field %q", field.Name)
+	}
+
+	// encrypt values with all keys to match values encrypted with older keys
+	list := make(bson.A, 0, len(values)*len(t.encryptor.keys))
+	for _, value := range values {
+		for _, key := range t.encryptor.keys {
+			enc, err := encryptValue(t.encryptor, key, t.meta, field, value)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, enc)
+		}
+	}
+
+	return list, nil
+}
+
+func (t *Translator) encryptedField(key string) *Field {
+	// get field
+	field := t.meta.DatabaseFields[key]
+	if field == nil {
+		return nil
+	}
+
+	// check flags
+	if stick.Contains(field.Flags, EncryptedFlag) || stick.Contains(field.Flags, DeterministicFlag) {
+		return field
+	}
+
+	return nil
+}
+
+func (m *Manager) encode(model Model) (interface{}, error) {
+	// stamp version
+	m.stampVersion(model)
+
+	// get fields
+	fields := encryptedFields(m.meta)
+	if len(fields) == 0 {
+		return model, nil
+	}
+
+	// convert model
+	doc, err := bsonkit.Transform(model)
+	if err != nil {
+		return nil, xo.W(err)
+	}
+
+	// encrypt fields
+	for _, field := range fields {
+		value, err := encryptValue(m.trans.encryptor, nil, m.meta, field, bsonkit.Get(doc, field.BSONKey))
+		if err != nil {
+			return nil, err
+		}
+		_, err = bsonkit.Put(doc, field.BSONKey, value, false)
+		if err != nil {
+			return nil, xo.W(err)
+		}
+	}
+
+	return *doc, nil
+}
+
+func (m *Manager) decrypt(model Model) error {
+	// decrypt fields
+	for _, field := range encryptedFields(m.meta) {
+		// get value
+		var value []byte
+		switch v := stick.MustGet(model, field.Name).(type) {
+		case string:
+			value = []byte(v)
+		case []byte:
+			value = v
+		}
+
+		// decrypt value
+		plaintext, ok, err := decryptValue(m.trans.encryptor, m.meta, field, value)
+		if err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+
+		// set value
+		if field.Type == bytesType {
+			stick.MustSet(model, field.Name, plaintext)
+		} else {
+			stick.MustSet(model, field.Name, string(plaintext))
+		}
+	}
+
+	return nil
+}
+
+func (m *Manager) decryptRaw(field string, value interface{}) (interface{}, error) {
+	// get field
+	metaField := m.trans.encryptedField(field)
+	if metaField == nil {
+		return value, nil
+	}
+
+	// decrypt value
+	switch v := value.(type) {
+	case string:
+		plaintext, _, err := decryptValue(m.trans.encryptor, m.meta, metaField, []byte(v))
+		if err != nil {
+			return nil, err
+		}
+		return string(plaintext), nil
+	case primitive.Binary:
+		plaintext, _, err := decryptValue(m.trans.encryptor, m.meta, metaField, v.Data)
+		if err != nil {
+			return nil, err
+		}
+		return primitive.Binary{Subtype: v.Subtype, Data: plaintext}, nil
+	}
+
+	return value, nil
+}
+
+// ReEncrypt will re-encrypt the encrypted fields of all matching documents using
+// the current key of the stores encryptor. It will also encrypt values that
+// have been stored unencrypted. Only the encrypted fields are updated and only
+// if they have not been changed in the meantime. It returns the number of
+// matched, re-encrypted and conflicting documents. Documents are not validated.
+func ReEncrypt(ctx context.Context, store *Store, model Model, filter bson.M, concurrency int) (int64, int64, int64, error) {
+	// process documents
+	var conflicts int64
+	matched, processed, err := ProcessEach(ctx, store, model, filter, concurrency, func(model Model) error {
+		ok, err := store.M(model).reEncrypt(ctx, model.ID())
+		if err != nil {
+			return err
+		} else if !ok {
+			atomic.AddInt64(&conflicts, 1)
+		}
+		return nil
+	})
+
+	return matched, processed - conflicts, conflicts, err
+}
+
+func (m *Manager) reEncrypt(ctx context.Context, id ID) (bool, error) {
+	// load raw document
+	var doc bson.M
+	err := m.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&doc)
+	if IsMissing(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	// prepare filter and values
+	filter := bson.M{"_id": id}
+	set := bson.M{}
+	for _, field := range encryptedFields(m.meta) {
+		// get value
+		value, ok := doc[field.BSONKey]
+		if !ok || value == nil {
+			continue
+		}
+
+		// decrypt value
+		plaintext, err := m.decryptRaw(field.BSONKey, value)
+		if err != nil {
+			return false, err
+		}
+
+		// encrypt value
+		ciphertext, err := encryptValue(m.trans.encryptor, nil, m.meta, field, plaintext)
+		if err != nil {
+			return false, err
+		}
+
+		// require original value
+		filter[field.BSONKey] = value
+		set[field.BSONKey] = ciphertext
+	}
+
+	// check values
+	if len(set) == 0 {
+		return true, nil
+	}
+
+	// update document
+	res, err := m.coll.UpdateOne(ctx, filter, bson.M{
+		"$set": set,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return res.MatchedCount == 1, nil
+}
@@ -0,0 +1,257 @@
+package coal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+type secretModel struct {
+	Base   `json:"-" bson:",inline" coal:"secrets"`
+	Name   string `json:"name"`
+	Email  string `json:"email" coal:"fire-encrypted-deterministic"`
+	Token  []byte `json:"token" coal:"fire-encrypted"`
+	Public string `json:"public"`
+}
+
+func (m *secretModel) Validate() error {
+	return nil
+}
+
+var testKey1 = EncryptionKey{ID: "k1", Key: []byte("0123456789abcdef0123456789abcdef")}
+var testKey2 = EncryptionKey{ID: "k2", Key: []byte("fedcba9876543210fedcba9876543210")}
+
+func TestEncryptor(t *testing.T) {
+	enc := NewEncryptor(testKey1)
+
+	val1, err := enc.Encrypt([]byte("foo"), "data", false)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(val1, "$enc$k1$"))
+	assert.True(t, IsEncrypted(val1))
+
+	val2, err := enc.Encrypt([]byte("foo"), "data", false)
+	assert.NoError(t, err)
+	assert.NotEqual(t, val1, val2)
+
+	val3, err := enc.Encrypt([]byte("foo"), "data", true)
+	assert.NoError(t, err)
+	val4, err := enc.Encrypt([]byte("foo"), "data", true)
+	assert.NoError(t, err)
+	assert.Equal(t, val3, val4)
+
+	val5, err := enc.Encrypt([]byte("foo"), "other", true)
+	assert.NoError(t, err)
+	assert.NotEqual(t, val3, val5)
+
+	plaintext, id, err := enc.Decrypt(val1, "data")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("foo"), plaintext)
+	assert.Equal(t, "k1", id)
+
+	_, _, err = enc.Decrypt(val1, "other")
+	assert.Error(t, err)
+
+	_, _, err = enc.Decrypt("foo", "data")
+	assert.Error(t, err)
+	assert.Equal(t, "value is not encrypted", err.Error())
+
+	_, _, err = NewEncryptor(testKey2).Decrypt(val1, "data")
+	assert.Error(t, err)
+	assert.Equal(t, `unknown encryption key "k1"`, err.Error())
+
+	rotated := NewEncryptor(testKey2, testKey1)
+	plaintext, id, err = rotated.Decrypt(val1, "data")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("foo"), plaintext)
+	assert.Equal(t, "k1", id)
+
+	assert.PanicsWithValue(t, "coal: missing encryption keys", func() {
+		NewEncryptor()
+	})
+
+	assert.PanicsWithValue(t, `coal: invalid encryption key id "a$b"`, func() {
+		NewEncryptor(EncryptionKey{ID: "a$b", Key: testKey1.Key})
+	})
+
+	assert.PanicsWithValue(t, `coal: duplicate encryption key id "k1"`, func() {
+		NewEncryptor(testKey1, testKey1)
+	})
+
+	assert.PanicsWithValue(t, `coal: invalid encryption key "k3": crypto/aes: invalid key size 3`, func() {
+		NewEncryptor(EncryptionKey{ID: "k3", Key: []byte("foo")})
+	})
+}
+
+func TestEncryptedFieldType(t *testing.T) {
+	type invalidModel struct {
+		Base   `json:"-" bson:",inline" coal:"invalids"`
+		Number int `coal:"fire-encrypted"`
+		stick.NoValidation
+	}
+
+	assert.PanicsWithValue(t, `coal: encrypted field "Number" must be a string or byte slice`, func() {
+		GetMeta(&invalidModel{})
+	})
+}
+
+func TestManagerEncryption(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		tester = NewTester(tester.Store, &secretModel{})
+		defer tester.Store.UseEncryptor(nil)
+
+		tester.Store.UseEncryptor(nil)
+		err := tester.Store.M(&secretModel{}).Insert(nil, &secretModel{Email: "foo@example.com"})
+		assert.Error(t, err)
+		assert.Equal(t, `missing encryptor for field "Email"`, err.Error())
+
+		tester.Store.UseEncryptor(NewEncryptor(testKey1))
+		m := tester.Store.M(&secretModel{})
+
+		model := &secretModel{
+			Name:   "foo",
+			Email:  "foo@example.com",
+			Token:  []byte("secret"),
+			Public: "public",
+		}
+		err = m.Insert(nil, model)
+		assert.NoError(t, err)
+		assert.Equal(t, "foo@example.com", model.Email)
+
+		var raw bson.M
+		err = tester.Store.C(model).FindOne(nil, bson.M{"_id": model.ID()}).Decode(&raw)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(raw["email"].(string), "$enc$k1$"))
+		assert.Equal(t, "public", raw["public"])
+
+		var found secretModel
+		ok, err := m.Find(nil, &found, model.ID(), false)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, *model, found)
+
+		var first secretModel
+		ok, err = m.FindFirst(nil, &first, bson.M{"Email": "foo@example.com"}, nil, 0, false)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, model.ID(), first.ID())
+
+		n, err := m.Count(nil, bson.M{"Email": bson.M{"$ne": "foo@example.com"}}, 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), n)
+
+		_, err = m.Count(nil, bson.M{"Token": "secret"}, 0, 0, false, NoTransaction)
+		assert.Error(t, err)
+		assert.Equal(t, `filter on non-deterministically encrypted field "Token"`, err.Error())
+
+		_, err = m.Count(nil, bson.M{"Email": bson.M{"$regex": "foo"}}, 0, 0, false, NoTransaction)
+		assert.Error(t, err)
+		assert.Equal(t, `unsupported operator "$regex" on encrypted field "Email"`, err.Error())
+
+		var updated secretModel
+		ok, err = m.Update(nil, &updated, model.ID(), bson.M{
+			"$set": bson.M{
+				"Email": "bar@example.com",
+			},
+		}, false)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "bar@example.com", updated.Email)
+
+		value, ok, err := m.Project(nil, model.ID(), "Email", false)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "bar@example.com", value)
+
+		_, err = m.Update(nil, nil, model.ID(), bson.M{
+			"$push": bson.M{
+				"Email": "baz",
+			},
+		}, false)
+		assert.Error(t, err)
+		assert.Equal(t, `unsupported operator "$push" on encrypted field "Email"`, err.Error())
+
+		tester.Store.UseEncryptor(NewEncryptor(testKey2, testKey1))
+		m = tester.Store.M(&secretModel{})
+
+		var list []*secretModel
+		err = m.FindAll(nil, &list, bson.M{"Email": "bar@example.com"}, nil, 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		assert.Len(t, list, 1)
+		assert.Equal(t, []byte("secret"), list[0].Token)
+
+		matched, modified, conflicts, err := ReEncrypt(nil, tester.Store, &secretModel{}, bson.M{}, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), matched)
+		assert.Equal(t, int64(1), modified)
+		assert.Equal(t, int64(0), conflicts)
+
+		raw = nil
+		err = tester.Store.C(model).FindOne(nil, bson.M{"_id": model.ID()}).Decode(&raw)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(raw["email"].(string), "$enc$k2$"))
+		assert.Equal(t, "public", raw["public"])
+
+		ok, err = tester.Store.M(&secretModel{}).reEncrypt(nil, New())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		tester.Store.UseEncryptor(NewEncryptor(testKey2))
+		m = tester.Store.M(&secretModel{})
+
+		found = secretModel{}
+		ok, err = m.FindFirst(nil, &found, bson.M{"Email": "bar@example.com"}, nil, 0, false)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, []byte("secret"), found.Token)
+	})
+}
+
+func TestReconcileEncryption(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		tester = NewTester(tester.Store, &secretModel{})
+		tester.Store.UseEncryptor(NewEncryptor(testKey1))
+		defer tester.Store.UseEncryptor(nil)
+
+		time.Sleep(10 * time.Millisecond)
+
+		tester.Insert(&secretModel{
+			Email: "foo@example.com",
+		})
+
+		open := make(chan struct{})
+		done := make(chan struct{})
+
+		var emails []string
+		stream := Reconcile(tester.Store, &secretModel{}, func() {
+			close(open)
+		}, func(model Model) {
+			emails = append(emails, model.(*secretModel).Email)
+		}, func(model Model) {
+			emails = append(emails, model.(*secretModel).Email)
+		}, func(id ID) {
+			close(done)
+		}, func(err error) {
+			panic(err)
+		})
+
+		<-open
+
+		model := tester.Insert(&secretModel{
+			Email: "bar@example.com",
+		}).(*secretModel)
+		model.Email = "baz@example.com"
+		tester.Replace(model)
+		tester.Delete(model)
+
+		<-done
+
+		stream.Close()
+
+		assert.Equal(t, []string{"foo@example.com", "bar@example.com", "baz@example.com"}, emails)
+	})
+}
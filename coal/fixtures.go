@@ -0,0 +1,397 @@
+package coal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/yaml.v3"
+)
+
+// TestingT is the subset of testing.TB used by snapshot assertions.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// LoadFixtures will load and insert the fixtures from the specified YAML or
+// JSON files. The files must contain a document keyed by the model plural
+// names that holds the named fixtures of each model. Fixtures are specified
+// using the BSON keys of the model fields:
+//
+//	posts:
+//	  post1:
+//	    title: "Hello World!"
+//	comments:
+//	  comment1:
+//	    message: "Nice post!"
+//	    post_id: "@post1"
+//
+// String values of the form "@name" are replaced with the generated id of the
+// named fixture. A leading "@@" can be used to escape a literal "@". Fixture
+// names must be unique across all loaded fixtures and may reference fixtures
+// that have been loaded before. Models are inserted ordered by plural and
+// fixture name. The method returns the ids of all loaded fixtures.
+func (t *Tester) LoadFixtures(files ...string) map[string]ID {
+	// read files
+	var sets []map[string]map[string]map[string]interface{}
+	for _, file := range files {
+		sets = append(sets, readFixtures(file))
+	}
+
+	// prepare ids
+	type fixture struct {
+		name  string
+		model Model
+		data  map[string]interface{}
+	}
+	var list []fixture
+	ids := map[string]ID{}
+	for _, set := range sets {
+		// get sorted collections
+		names := make([]string, 0, len(set))
+		for name := range set {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		// add fixtures
+		for _, name := range names {
+			// get model
+			model := t.fixtureModel(name)
+
+			// get sorted entries
+			entries := make([]string, 0, len(set[name]))
+			for entry := range set[name] {
+				entries = append(entries, entry)
+			}
+			sort.Strings(entries)
+
+			// generate ids
+			for _, entry := range entries {
+				if _, ok := t.fixtures[entry]; ok {
+					panic(fmt.Sprintf(`coal: duplicate fixture "%s"`, entry))
+				} else if _, ok := ids[entry]; ok {
+					panic(fmt.Sprintf(`coal: duplicate fixture "%s"`, entry))
+				}
+				ids[entry] = New()
+				list = append(list, fixture{
+					name:  entry,
+					model: model,
+					data:  set[name][entry],
+				})
+			}
+		}
+	}
+
+	// decode fixtures
+	models := make([]Model, 0, len(list))
+	for _, item := range list {
+		// get meta
+		meta := GetMeta(item.model)
+
+		// prepare document
+		doc := bson.M{}
+		for key, value := range item.data {
+			field := meta.DatabaseFields[key]
+			if field == nil {
+				panic(fmt.Sprintf(`coal: unknown fixture field "%s" on "%s"`, key, meta.PluralName))
+			}
+			doc[key] = t.fixtureValue(value, field.Type, ids)
+		}
+
+		// set id
+		doc["_id"] = ids[item.name]
+
+		// decode model
+		bytes, err := bson.Marshal(doc)
+		if err != nil {
+			panic(err)
+		}
+		model := meta.Make()
+		err = bson.Unmarshal(bytes, model)
+		if err != nil {
+			panic(fmt.Sprintf(`coal: invalid fixture "%s": %s`, item.name, err.Error()))
+		}
+
+		// add model
+		models = append(models, model)
+	}
+
+	// insert models
+	for _, model := range models {
+		t.Insert(model)
+	}
+
+	// add ids
+	if t.fixtures == nil {
+		t.fixtures = map[string]ID{}
+	}
+	for name, id := range ids {
+		t.fixtures[name] = id
+	}
+
+	return ids
+}
+
+// Fixture will return the id of the named fixture.
+func (t *Tester) Fixture(name string) ID {
+	// get id
+	id, ok := t.fixtures[name]
+	if !ok {
+		panic(fmt.Sprintf(`coal: unknown fixture "%s"`, name))
+	}
+
+	return id
+}
+
+// AssertSnapshot will compare the current contents of the collections of all
+// registered models with the specified golden file. The documents are ordered
+// by id and ids are replaced with the names of the loaded fixtures or with
+// stable placeholders like "#1" if unknown. Strings starting with "@" are
+// escaped with a leading "@@" like in fixtures. The values of the specified
+// ignored fields, given as dotted BSON paths, are replaced with "<ignored>".
+// A missing golden file fails the assertion. If the environment variable
+// "COAL_UPDATE_SNAPSHOTS" is set, the golden file is written instead.
+func (t *Tester) AssertSnapshot(tt TestingT, file string, ignore ...string) bool {
+	tt.Helper()
+
+	// prepare ignore
+	ignored := map[string]bool{}
+	for _, path := range ignore {
+		ignored[path] = true
+	}
+
+	// prepare names
+	names := map[ID]string{}
+	for name, id := range t.fixtures {
+		names[id] = "@" + name
+	}
+	unknown := 0
+
+	// get sorted models
+	models := append([]Model(nil), t.Models...)
+	sort.Slice(models, func(i, j int) bool {
+		return GetMeta(models[i]).PluralName < GetMeta(models[j]).PluralName
+	})
+
+	// build snapshot
+	snapshot := map[string]interface{}{}
+	for _, model := range models {
+		// find documents
+		iter, err := t.Store.C(model).Find(nil, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+		if err != nil {
+			panic(err)
+		}
+		var docs []bson.D
+		err = iter.All(&docs)
+		if err != nil {
+			panic(err)
+		}
+
+		// normalize documents
+		list := make([]interface{}, 0, len(docs))
+		for _, doc := range docs {
+			list = append(list, normalizeSnapshot(doc, "", ignored, names, &unknown))
+		}
+
+		// set list
+		snapshot[GetMeta(model).PluralName] = list
+	}
+
+	// encode snapshot
+	actual, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	actual = append(actual, '\n')
+
+	// read golden file
+	expected, err := ioutil.ReadFile(file)
+	missing := os.IsNotExist(err)
+	if err != nil && !missing {
+		panic(err)
+	}
+
+	// write golden file if requested
+	if os.Getenv("COAL_UPDATE_SNAPSHOTS") != "" {
+		err = os.MkdirAll(filepath.Dir(file), 0755)
+		if err != nil {
+			panic(err)
+		}
+		err = ioutil.WriteFile(file, actual, 0644)
+		if err != nil {
+			panic(err)
+		}
+		return true
+	}
+
+	// check golden file
+	if missing {
+		tt.Errorf("coal: snapshot %s is missing, set COAL_UPDATE_SNAPSHOTS to write it", file)
+		return false
+	}
+
+	// compare snapshot
+	if !bytes.Equal(expected, actual) {
+		tt.Errorf("coal: snapshot %s does not match:\n\nexpected:\n%s\nactual:\n%s", file, expected, actual)
+		return false
+	}
+
+	return true
+}
+
+func (t *Tester) fixtureModel(name string) Model {
+	// find model
+	for _, model := range t.Models {
+		if GetMeta(model).PluralName == name {
+			return model
+		}
+	}
+
+	panic(fmt.Sprintf(`coal: unknown fixture model "%s"`, name))
+}
+
+func (t *Tester) fixtureValue(value interface{}, typ reflect.Type, ids map[string]ID) interface{} {
+	switch v := value.(type) {
+	case string:
+		// handle escaped strings
+		if strings.HasPrefix(v, "@@") {
+			return v[1:]
+		}
+
+		// handle references
+		if strings.HasPrefix(v, "@") {
+			id, ok := ids[v[1:]]
+			if !ok {
+				id, ok = t.fixtures[v[1:]]
+			}
+			if !ok {
+				panic(fmt.Sprintf(`coal: unknown fixture reference "%s"`, v))
+			}
+			return id
+		}
+
+		// handle times
+		if typ != nil && derefType(typ) == timeType {
+			tm, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				panic(fmt.Sprintf(`coal: invalid fixture time "%s"`, v))
+			}
+			return tm
+		}
+
+		return v
+	case []interface{}:
+		// get element type
+		var elem reflect.Type
+		if typ != nil && derefType(typ).Kind() == reflect.Slice {
+			elem = derefType(typ).Elem()
+		}
+
+		// convert elements
+		list := make(bson.A, 0, len(v))
+		for _, item := range v {
+			list = append(list, t.fixtureValue(item, elem, ids))
+		}
+
+		return list
+	case map[string]interface{}:
+		// convert values
+		doc := bson.M{}
+		for key, item := range v {
+			doc[key] = t.fixtureValue(item, nil, ids)
+		}
+
+		return doc
+	default:
+		return v
+	}
+}
+
+func readFixtures(file string) map[string]map[string]map[string]interface{} {
+	// read file
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		panic(err)
+	}
+
+	// decode file
+	var set map[string]map[string]map[string]interface{}
+	switch filepath.Ext(file) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &set)
+	case ".json":
+		err = json.Unmarshal(data, &set)
+	default:
+		panic(fmt.Sprintf(`coal: unsupported fixture file "%s"`, file))
+	}
+	if err != nil {
+		panic(fmt.Sprintf(`coal: invalid fixture file "%s": %s`, file, err.Error()))
+	}
+
+	return set
+}
+
+func normalizeSnapshot(value interface{}, path string, ignored map[string]bool, names map[ID]string, unknown *int) interface{} {
+	// check ignored
+	if ignored[path] {
+		return "<ignored>"
+	}
+
+	switch v := value.(type) {
+	case bson.D:
+		// normalize fields
+		doc := map[string]interface{}{}
+		for _, e := range v {
+			key := e.Key
+			if path != "" {
+				key = path + "." + e.Key
+			}
+			doc[e.Key] = normalizeSnapshot(e.Value, key, ignored, names, unknown)
+		}
+
+		return doc
+	case bson.A:
+		// normalize items
+		list := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			list = append(list, normalizeSnapshot(item, path, ignored, names, unknown))
+		}
+
+		return list
+	case primitive.ObjectID:
+		// get name or assign placeholder
+		name, ok := names[v]
+		if !ok {
+			*unknown++
+			name = fmt.Sprintf("#%d", *unknown)
+			names[v] = name
+		}
+
+		return name
+	case primitive.DateTime:
+		return v.Time().UTC().Format(time.RFC3339Nano)
+	case primitive.Decimal128:
+		return v.String()
+	case string:
+		// escape strings that look like references
+		if strings.HasPrefix(v, "@") {
+			return "@" + v
+		}
+
+		return v
+	default:
+		return v
+	}
+}
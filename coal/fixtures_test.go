@@ -0,0 +1,212 @@
+package coal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type snapshotT struct {
+	errors []string
+}
+
+func (t *snapshotT) Helper() {}
+
+func (t *snapshotT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestTesterFixtures(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		dir := t.TempDir()
+
+		yamlFile := filepath.Join(dir, "posts.yaml")
+		err := ioutil.WriteFile(yamlFile, []byte(`
+posts:
+  post1:
+    title: "Hello"
+    published: true
+  post2:
+    title: "@@mention"
+notes:
+  note1:
+    title: "Note"
+    created_at: "2020-01-02T03:04:05Z"
+    post_id: "@post1"
+`), 0644)
+		assert.NoError(t, err)
+
+		jsonFile := filepath.Join(dir, "comments.json")
+		err = ioutil.WriteFile(jsonFile, []byte(`{
+			"comments": {
+				"comment1": {
+					"message": "Nice!",
+					"post_id": "@post2"
+				}
+			},
+			"selections": {
+				"selection1": {
+					"name": "All",
+					"post_ids": ["@post1", "@post2"]
+				}
+			}
+		}`), 0644)
+		assert.NoError(t, err)
+
+		ids := tester.LoadFixtures(yamlFile, jsonFile)
+		assert.Len(t, ids, 5)
+		assert.Equal(t, ids["post1"], tester.Fixture("post1"))
+
+		post1 := tester.Fetch(&postModel{}, ids["post1"]).(*postModel)
+		assert.Equal(t, "Hello", post1.Title)
+		assert.True(t, post1.Published)
+
+		post2 := tester.Fetch(&postModel{}, ids["post2"]).(*postModel)
+		assert.Equal(t, "@mention", post2.Title)
+
+		note := tester.Fetch(&noteModel{}, ids["note1"]).(*noteModel)
+		assert.Equal(t, ids["post1"], note.Post)
+		assert.Equal(t, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), note.CreatedAt.UTC())
+
+		comment := tester.Fetch(&commentModel{}, ids["comment1"]).(*commentModel)
+		assert.Equal(t, ids["post2"], comment.Post)
+
+		selection := tester.Fetch(&selectionModel{}, ids["selection1"]).(*selectionModel)
+		assert.Equal(t, []ID{ids["post1"], ids["post2"]}, selection.Posts)
+
+		assert.PanicsWithValue(t, `coal: duplicate fixture "comment1"`, func() {
+			tester.LoadFixtures(jsonFile)
+		})
+
+		assert.PanicsWithValue(t, `coal: unknown fixture "foo"`, func() {
+			tester.Fixture("foo")
+		})
+
+		badFile := filepath.Join(dir, "bad.yaml")
+		err = ioutil.WriteFile(badFile, []byte(`
+posts:
+  post3:
+    foo: "bar"
+`), 0644)
+		assert.NoError(t, err)
+
+		assert.PanicsWithValue(t, `coal: unknown fixture field "foo" on "posts"`, func() {
+			tester.LoadFixtures(badFile)
+		})
+
+		err = ioutil.WriteFile(badFile, []byte(`
+comments:
+  comment2:
+    post_id: "@missing"
+`), 0644)
+		assert.NoError(t, err)
+
+		assert.PanicsWithValue(t, `coal: unknown fixture reference "@missing"`, func() {
+			tester.LoadFixtures(badFile)
+		})
+		assert.Equal(t, 1, tester.Count(&commentModel{}))
+
+		err = ioutil.WriteFile(badFile, []byte(`
+comments:
+  comment2:
+    post_id: "@post1"
+`), 0644)
+		assert.NoError(t, err)
+
+		ids = tester.LoadFixtures(badFile)
+		comment = tester.Fetch(&commentModel{}, ids["comment2"]).(*commentModel)
+		assert.Equal(t, tester.Fixture("post1"), comment.Post)
+
+		tester.Clean()
+		assert.PanicsWithValue(t, `coal: unknown fixture "post1"`, func() {
+			tester.Fixture("post1")
+		})
+	})
+}
+
+func TestTesterAssertSnapshot(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		tester = NewTester(tester.Store, &postModel{}, &noteModel{})
+
+		dir := t.TempDir()
+		fixtures := filepath.Join(dir, "fixtures.yaml")
+		err := ioutil.WriteFile(fixtures, []byte(`
+posts:
+  post1:
+    title: "Hello"
+notes:
+  note1:
+    title: "Note"
+    post_id: "@post1"
+`), 0644)
+		assert.NoError(t, err)
+
+		tester.LoadFixtures(fixtures)
+
+		tester.Insert(&noteModel{
+			Title:     "@other",
+			Post:      New(),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		})
+
+		golden := filepath.Join(dir, "snapshot.json")
+		st := &snapshotT{}
+		assert.False(t, tester.AssertSnapshot(st, golden, "created_at", "updated_at"))
+		assert.Len(t, st.errors, 1)
+		assert.Contains(t, st.errors[0], "is missing")
+
+		_, err = os.Stat(golden)
+		assert.True(t, os.IsNotExist(err))
+
+		_ = os.Setenv("COAL_UPDATE_SNAPSHOTS", "1")
+		assert.True(t, tester.AssertSnapshot(t, golden, "created_at", "updated_at"))
+		_ = os.Unsetenv("COAL_UPDATE_SNAPSHOTS")
+
+		data, err := ioutil.ReadFile(golden)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{
+			"notes": [
+				{
+					"_id": "@note1",
+					"title": "Note",
+					"created_at": "<ignored>",
+					"updated_at": "<ignored>",
+					"post_id": "@post1"
+				},
+				{
+					"_id": "#1",
+					"title": "@@other",
+					"created_at": "<ignored>",
+					"updated_at": "<ignored>",
+					"post_id": "#2"
+				}
+			],
+			"posts": [
+				{
+					"_id": "@post1",
+					"title": "Hello",
+					"published": false,
+					"text_body": ""
+				}
+			]
+		}`, string(data))
+
+		assert.True(t, tester.AssertSnapshot(t, golden, "created_at", "updated_at"))
+
+		tester.Update(&postModel{Base: B(tester.Fixture("post1"))}, bson.M{
+			"$set": bson.M{"title": "Changed"},
+		})
+
+		st = &snapshotT{}
+		assert.False(t, tester.AssertSnapshot(st, golden, "created_at", "updated_at"))
+		assert.Len(t, st.errors, 1)
+		assert.Contains(t, st.errors[0], `"title": "Changed"`)
+	})
+}
@@ -0,0 +1,280 @@
+package coal
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// earthRadius is the radius in meters used by MongoDB for spherical queries.
+const earthRadius = 6378100
+
+var pointType = reflect.TypeOf(Point{})
+var polygonType = reflect.TypeOf(Polygon{})
+
+// Point is a geographic location that is coded as a GeoJSON point.
+type Point struct {
+	Longitude float64
+	Latitude  float64
+}
+
+type geoPoint struct {
+	Type        string    `json:"type" bson:"type"`
+	Coordinates []float64 `json:"coordinates" bson:"coordinates"`
+}
+
+// Validate will validate the point.
+func (p Point) Validate() error {
+	// check longitude and latitude
+	if p.Longitude < -180 || p.Longitude > 180 {
+		return xo.SF("invalid longitude")
+	} else if p.Latitude < -90 || p.Latitude > 90 {
+		return xo.SF("invalid latitude")
+	}
+
+	return nil
+}
+
+func (p Point) geo() geoPoint {
+	return geoPoint{
+		Type:        "Point",
+		Coordinates: []float64{p.Longitude, p.Latitude},
+	}
+}
+
+func (p *Point) set(geo geoPoint) error {
+	// check point
+	if geo.Type != "Point" || len(geo.Coordinates) != 2 {
+		return xo.F("invalid point")
+	}
+
+	// set point
+	p.Longitude = geo.Coordinates[0]
+	p.Latitude = geo.Coordinates[1]
+
+	return nil
+}
+
+// MarshalBSONValue implements the bsoncodec.ValueMarshaler interface.
+func (p Point) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(p.geo())
+}
+
+// UnmarshalBSONValue implements the bsoncodec.ValueUnmarshaler interface.
+func (p *Point) UnmarshalBSONValue(typ bsontype.Type, bytes []byte) error {
+	// decode point
+	var geo geoPoint
+	err := bson.RawValue{Type: typ, Value: bytes}.Unmarshal(&geo)
+	if err != nil {
+		return err
+	}
+
+	return p.set(geo)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p Point) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.geo())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *Point) UnmarshalJSON(bytes []byte) error {
+	// decode point
+	var geo geoPoint
+	err := json.Unmarshal(bytes, &geo)
+	if err != nil {
+		return err
+	}
+
+	return p.set(geo)
+}
+
+// Polygon is a geographic area that is coded as a GeoJSON polygon. The first
+// ring is the exterior ring and the following rings are holes. Every ring must
+// be closed by repeating the first point at the end. A nil polygon is coded as
+// null.
+type Polygon [][]Point
+
+type geoPolygon struct {
+	Type        string        `json:"type" bson:"type"`
+	Coordinates [][][]float64 `json:"coordinates" bson:"coordinates"`
+}
+
+// Validate will validate the polygon.
+func (p Polygon) Validate() error {
+	// check rings
+	if len(p) == 0 {
+		return xo.SF("missing polygon rings")
+	}
+
+	// check rings
+	for _, ring := range p {
+		// check length
+		if len(ring) < 4 {
+			return xo.SF("polygon ring must have at least four points")
+		}
+
+		// check closure
+		if ring[0] != ring[len(ring)-1] {
+			return xo.SF("polygon ring is not closed")
+		}
+
+		// check points
+		for _, point := range ring {
+			err := point.Validate()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p Polygon) geo() geoPolygon {
+	// convert rings
+	coordinates := make([][][]float64, 0, len(p))
+	for _, ring := range p {
+		list := make([][]float64, 0, len(ring))
+		for _, point := range ring {
+			list = append(list, []float64{point.Longitude, point.Latitude})
+		}
+		coordinates = append(coordinates, list)
+	}
+
+	return geoPolygon{
+		Type:        "Polygon",
+		Coordinates: coordinates,
+	}
+}
+
+func (p *Polygon) set(geo geoPolygon) error {
+	// check type
+	if geo.Type != "Polygon" {
+		return xo.F("invalid polygon")
+	}
+
+	// convert rings
+	polygon := make(Polygon, 0, len(geo.Coordinates))
+	for _, list := range geo.Coordinates {
+		ring := make([]Point, 0, len(list))
+		for _, coordinates := range list {
+			if len(coordinates) != 2 {
+				return xo.F("invalid polygon")
+			}
+			ring = append(ring, Point{
+				Longitude: coordinates[0],
+				Latitude:  coordinates[1],
+			})
+		}
+		polygon = append(polygon, ring)
+	}
+
+	// set polygon
+	*p = polygon
+
+	return nil
+}
+
+// MarshalBSONValue implements the bsoncodec.ValueMarshaler interface.
+func (p Polygon) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	// handle nil
+	if p == nil {
+		return bsontype.Null, nil, nil
+	}
+
+	return bson.MarshalValue(p.geo())
+}
+
+// UnmarshalBSONValue implements the bsoncodec.ValueUnmarshaler interface.
+func (p *Polygon) UnmarshalBSONValue(typ bsontype.Type, bytes []byte) error {
+	// handle null
+	if typ == bsontype.Null {
+		*p = nil
+		return nil
+	}
+
+	// decode polygon
+	var geo geoPolygon
+	err := bson.RawValue{Type: typ, Value: bytes}.Unmarshal(&geo)
+	if err != nil {
+		return err
+	}
+
+	return p.set(geo)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p Polygon) MarshalJSON() ([]byte, error) {
+	// handle nil
+	if p == nil {
+		return []byte("null"), nil
+	}
+
+	return json.Marshal(p.geo())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *Polygon) UnmarshalJSON(bytes []byte) error {
+	// handle null
+	if string(bytes) == "null" {
+		*p = nil
+		return nil
+	}
+
+	// decode polygon
+	var geo geoPolygon
+	err := json.Unmarshal(bytes, &geo)
+	if err != nil {
+		return err
+	}
+
+	return p.set(geo)
+}
+
+// Near will return a query partial that matches locations near the specified
+// point ordered by distance. The max distance is specified in meters and
+// ignored if zero. The query partial cannot be used to count documents.
+//
+// Note: The field requires a 2dsphere index.
+func Near(point Point, maxDistance float64) bson.M {
+	// prepare query
+	query := bson.M{
+		"$geometry": point,
+	}
+
+	// set max distance
+	if maxDistance > 0 {
+		query["$maxDistance"] = maxDistance
+	}
+
+	return bson.M{
+		"$nearSphere": query,
+	}
+}
+
+// WithinRadius will return a query partial that matches locations within the
+// specified radius in meters around the specified point.
+func WithinRadius(point Point, radius float64) bson.M {
+	return bson.M{
+		"$geoWithin": bson.M{
+			"$centerSphere": bson.A{
+				bson.A{point.Longitude, point.Latitude},
+				radius / earthRadius,
+			},
+		},
+	}
+}
+
+// Within will return a query partial that matches locations that are within
+// the specified polygon.
+func Within(polygon Polygon) bson.M {
+	return bson.M{
+		"$geoWithin": bson.M{
+			"$geometry": polygon,
+		},
+	}
+}
@@ -0,0 +1,144 @@
+package coal
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+type geoModel struct {
+	Base     `json:"-" bson:",inline" coal:"geos"`
+	Location Point   `json:"location"`
+	Area     Polygon `json:"area"`
+	stick.NoValidation
+}
+
+func TestPoint(t *testing.T) {
+	point := Point{Longitude: 8.5, Latitude: 47.4}
+	assert.NoError(t, point.Validate())
+	assert.Error(t, Point{Longitude: 181}.Validate())
+	assert.Error(t, Point{Latitude: -91}.Validate())
+
+	bytes, err := json.Marshal(point)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type":"Point","coordinates":[8.5,47.4]}`, string(bytes))
+
+	var point2 Point
+	err = json.Unmarshal(bytes, &point2)
+	assert.NoError(t, err)
+	assert.Equal(t, point, point2)
+
+	err = json.Unmarshal([]byte(`{"type":"Polygon","coordinates":[]}`), &point2)
+	assert.Error(t, err)
+
+	doc, err := bson.Marshal(bson.M{"p": point})
+	assert.NoError(t, err)
+
+	var m bson.M
+	err = bson.Unmarshal(doc, &m)
+	assert.NoError(t, err)
+	assert.Equal(t, bson.M{
+		"p": bson.M{
+			"type":        "Point",
+			"coordinates": bson.A{8.5, 47.4},
+		},
+	}, m)
+
+	var out struct{ P Point }
+	err = bson.Unmarshal(doc, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, point, out.P)
+}
+
+func TestPolygon(t *testing.T) {
+	polygon := Polygon{{
+		{Longitude: 0, Latitude: 0},
+		{Longitude: 1, Latitude: 0},
+		{Longitude: 1, Latitude: 1},
+		{Longitude: 0, Latitude: 0},
+	}}
+	assert.NoError(t, polygon.Validate())
+	assert.Error(t, Polygon{}.Validate())
+	assert.Error(t, Polygon{polygon[0][:3]}.Validate())
+	assert.Error(t, Polygon{append(polygon[0][:3:3], Point{Longitude: 2})}.Validate())
+
+	bytes, err := json.Marshal(polygon)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]}`, string(bytes))
+
+	var polygon2 Polygon
+	err = json.Unmarshal(bytes, &polygon2)
+	assert.NoError(t, err)
+	assert.Equal(t, polygon, polygon2)
+
+	bytes, err = json.Marshal(Polygon(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "null", string(bytes))
+
+	err = json.Unmarshal(bytes, &polygon2)
+	assert.NoError(t, err)
+	assert.Nil(t, polygon2)
+
+	model := &geoModel{Area: polygon}
+	doc, err := bson.Marshal(model)
+	assert.NoError(t, err)
+
+	var model2 geoModel
+	err = bson.Unmarshal(doc, &model2)
+	assert.NoError(t, err)
+	assert.Equal(t, polygon, model2.Area)
+
+	doc, err = bson.Marshal(&geoModel{})
+	assert.NoError(t, err)
+
+	var m bson.M
+	err = bson.Unmarshal(doc, &m)
+	assert.NoError(t, err)
+	assert.Nil(t, m["area"])
+
+	model2.Area = polygon
+	err = bson.Unmarshal(doc, &model2)
+	assert.NoError(t, err)
+	assert.Nil(t, model2.Area)
+}
+
+func TestGeoQueries(t *testing.T) {
+	point := Point{Longitude: 1, Latitude: 2}
+
+	assert.Equal(t, bson.M{
+		"$nearSphere": bson.M{
+			"$geometry":    point,
+			"$maxDistance": 100.0,
+		},
+	}, Near(point, 100))
+
+	assert.Equal(t, bson.M{
+		"$geoWithin": bson.M{
+			"$centerSphere": bson.A{bson.A{1.0, 2.0}, 1000.0 / earthRadius},
+		},
+	}, WithinRadius(point, 1000))
+
+	polygon := Polygon{{point, point, point, point}}
+	assert.Equal(t, bson.M{
+		"$geoWithin": bson.M{
+			"$geometry": polygon,
+		},
+	}, Within(polygon))
+}
+
+func TestCatalogAddGeoIndex(t *testing.T) {
+	catalog := NewCatalog(&geoModel{})
+	catalog.AddGeoIndex(&geoModel{}, "Location")
+
+	index := catalog.indexes["geos"][0]
+	assert.Equal(t, bson.D{{Key: "location", Value: "2dsphere"}}, index.Compile().Keys)
+
+	schema := Schema(&geoModel{})
+	properties := schema["properties"].(bson.M)
+	assert.Equal(t, "object", properties["location"].(bson.M)["bsonType"])
+	assert.Equal(t, []string{"object", "null"}, properties["area"].(bson.M)["bsonType"])
+}
@@ -11,7 +11,8 @@ import (
 )
 
 // F is a short-hand function to extract the BSON key of a model field.
-// Additionally, it supports the "-" prefix for retrieving sort keys.
+// Additionally, it supports the "-" prefix for retrieving sort keys and dotted
+// names of nested fields e.g. "Address.City".
 //
 // Note: F will panic if no field has been found.
 func F(m Model, field string) string {
@@ -25,6 +26,9 @@ func F(m Model, field string) string {
 
 	// find field
 	f := GetMeta(m).Fields[field]
+	if f == nil {
+		f = GetMeta(m).NestedFields[field]
+	}
 	if f == nil {
 		panic(fmt.Sprintf(`coal: field "%s" not found on "%s"`, field, GetMeta(m).Name))
 	}
@@ -15,6 +15,13 @@ func TestF(t *testing.T) {
 	assert.PanicsWithValue(t, `coal: field "Foo" not found on "coal.postModel"`, func() {
 		F(&postModel{}, "Foo")
 	})
+
+	assert.Equal(t, "billing_address.city", F(&nestedModel{}, "Billing.City"))
+	assert.Equal(t, "-items.address.street", F(&nestedModel{}, "-Items.Address.Street"))
+
+	assert.PanicsWithValue(t, `coal: field "Address.Foo" not found on "coal.nestedModel"`, func() {
+		F(&nestedModel{}, "Address.Foo")
+	})
 }
 
 func TestL(t *testing.T) {
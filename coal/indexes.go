@@ -0,0 +1,376 @@
+package coal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/256dpi/lungo/bsonkit"
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// IndexAction defines the action of an index change.
+type IndexAction string
+
+// The available index actions.
+const (
+	CreateIndex IndexAction = "create"
+	DropIndex   IndexAction = "drop"
+	ModifyIndex IndexAction = "modify"
+)
+
+// IndexChange describes a single change of an index plan.
+type IndexChange struct {
+	// The action.
+	Action IndexAction
+
+	// The collection.
+	Collection string
+
+	// The name of the existing or created index.
+	Name string
+
+	// The catalog index for create and modify actions.
+	Index *Index
+
+	// The changed properties for modify actions ("unique", "expiry" and
+	// "filter").
+	Changes []string
+
+	// Whether the existing index is a TTL index.
+	ttl bool
+}
+
+// String will return a description of the change.
+func (c IndexChange) String() string {
+	// prepare string
+	str := fmt.Sprintf("%s %s.%s", c.Action, c.Collection, c.Name)
+
+	// add changes
+	if len(c.Changes) > 0 {
+		str += " (" + strings.Join(c.Changes, ", ") + ")"
+	}
+
+	return str
+}
+
+// IndexPlan is a list of index changes.
+type IndexPlan []IndexChange
+
+// String will return a description of the plan with one change per line.
+func (p IndexPlan) String() string {
+	// collect lines
+	lines := make([]string, 0, len(p))
+	for _, change := range p {
+		lines = append(lines, change.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Apply will apply the plan to the provided store. Modified TTL indexes that
+// only differ in their expiry are updated in place using "collMod". Other
+// modified indexes are first created using a temporary name before the existing
+// index is dropped and the index is recreated with its proper name, so that
+// queries are always covered. If the database rejects the temporary index as
+// conflicting, the existing index is dropped and recreated directly.
+func (p IndexPlan) Apply(store *Store) error {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// apply changes
+	for _, change := range p {
+		// get indexes
+		indexes := store.DB().Collection(change.Collection).Indexes()
+
+		// update expiry in place if possible
+		if change.Action == ModifyIndex && !store.Lungo() && change.inPlace() {
+			err := store.DB().RunCommand(ctx, bson.D{
+				{Key: "collMod", Value: change.Collection},
+				{Key: "index", Value: bson.D{
+					{Key: "name", Value: change.Name},
+					{Key: "expireAfterSeconds", Value: int32(change.Index.Expiry / time.Second)},
+				}},
+			}).Err()
+			if err != nil {
+				return xo.W(err)
+			}
+
+			continue
+		}
+
+		// create temporary index (lungo does not allow duplicate keys)
+		if change.Action == ModifyIndex && !store.Lungo() {
+			model := change.Index.Compile()
+			model.Options.SetName(change.Name + "_tmp")
+			tmp, err := indexes.CreateOne(ctx, model)
+			var cmdErr mongo.CommandError
+			if err != nil && !(errors.As(err, &cmdErr) && (cmdErr.Code == 85 || cmdErr.Code == 86)) {
+				return xo.W(err)
+			}
+
+			// replace existing index
+			if err == nil {
+				_, err = indexes.DropOne(ctx, change.Name)
+				if err != nil {
+					return xo.W(err)
+				}
+				_, err = indexes.CreateOne(ctx, change.Index.Compile())
+				if err != nil {
+					return xo.W(err)
+				}
+				_, err = indexes.DropOne(ctx, tmp)
+				if err != nil {
+					return xo.W(err)
+				}
+
+				continue
+			}
+		}
+
+		// drop index
+		if change.Action == DropIndex || change.Action == ModifyIndex {
+			_, err := indexes.DropOne(ctx, change.Name)
+			if err != nil {
+				return xo.W(err)
+			}
+		}
+
+		// create index
+		if change.Action == CreateIndex || change.Action == ModifyIndex {
+			_, err := indexes.CreateOne(ctx, change.Index.Compile())
+			if err != nil {
+				return xo.W(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c IndexChange) inPlace() bool {
+	return len(c.Changes) == 1 && c.Changes[0] == "expiry" && c.ttl && c.Index.Expiry > 0
+}
+
+type existingIndex struct {
+	Name   string  `bson:"name"`
+	Key    bson.D  `bson:"key"`
+	Unique bool    `bson:"unique"`
+	Expiry *int64  `bson:"expireAfterSeconds"`
+	Filter *bson.D `bson:"partialFilterExpression"`
+}
+
+// PlanIndexes will list the existing indexes of all catalog collections and
+// compare them with the added indexes by key, uniqueness, expiry and partial
+// filter. It returns a plan that creates missing, modifies changed and drops
+// stale indexes. Missing collections are planned as having no indexes. If
+// requested, indexes that are not managed by the catalog are kept, e.g. when
+// they have been created by operators or other services.
+func (c *Catalog) PlanIndexes(store *Store, keepUnmanaged bool) (IndexPlan, error) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// collect names
+	names := map[string]bool{}
+	for name := range c.models {
+		names[name] = true
+	}
+	for name := range c.indexes {
+		names[name] = true
+	}
+
+	// sort names
+	list := make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+
+	// prepare plan
+	var plan IndexPlan
+
+	// plan collections
+	for _, name := range list {
+		// list existing indexes, a missing collection has no indexes
+		var existing []existingIndex
+		iter, err := store.DB().Collection(name).Indexes().List(ctx)
+		var cmdErr mongo.CommandError
+		if err != nil && !(errors.As(err, &cmdErr) && cmdErr.Code == 26) {
+			return nil, xo.W(err)
+		}
+
+		// decode existing indexes
+		if err == nil {
+			err = iter.All(ctx, &existing)
+			if err != nil {
+				return nil, xo.W(err)
+			}
+		}
+
+		// prepare matched
+		matched := map[string]bool{}
+
+		// check catalog indexes
+		for i := range c.indexes[name] {
+			// get index and key
+			index := &c.indexes[name][i]
+			key := index.Compile().Keys.(bson.D)
+
+			// find existing index
+			var found *existingIndex
+			for j, ex := range existing {
+				if !matched[ex.Name] && sameIndexKey(ex.Key, key) {
+					found = &existing[j]
+					break
+				}
+			}
+
+			// handle missing
+			if found == nil {
+				plan = append(plan, IndexChange{
+					Action:     CreateIndex,
+					Collection: name,
+					Name:       indexName(key),
+					Index:      index,
+				})
+				continue
+			}
+
+			// set flag
+			matched[found.Name] = true
+
+			// compare index
+			changes, err := compareIndex(found, index)
+			if err != nil {
+				return nil, err
+			}
+
+			// handle changes
+			if len(changes) > 0 {
+				plan = append(plan, IndexChange{
+					Action:     ModifyIndex,
+					Collection: name,
+					Name:       found.Name,
+					Index:      index,
+					Changes:    changes,
+					ttl:        found.Expiry != nil,
+				})
+			}
+		}
+
+		// check unmanaged
+		if keepUnmanaged {
+			continue
+		}
+
+		// drop stale indexes
+		for _, ex := range existing {
+			if ex.Name != "_id_" && !matched[ex.Name] {
+				plan = append(plan, IndexChange{
+					Action:     DropIndex,
+					Collection: name,
+					Name:       ex.Name,
+				})
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// ReconcileIndexes will plan the indexes and apply the plan unless report only
+// is requested. The plan is returned in both cases and can be used in CI to
+// ensure that the database indexes are up-to-date:
+//
+//	plan, err := catalog.ReconcileIndexes(store, false, true)
+//	assert.NoError(t, err)
+//	assert.Empty(t, plan)
+//
+func (c *Catalog) ReconcileIndexes(store *Store, keepUnmanaged, reportOnly bool) (IndexPlan, error) {
+	// plan indexes
+	plan, err := c.PlanIndexes(store, keepUnmanaged)
+	if err != nil {
+		return nil, err
+	}
+
+	// apply plan
+	if !reportOnly {
+		err = plan.Apply(store)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return plan, nil
+}
+
+func compareIndex(existing *existingIndex, index *Index) ([]string, error) {
+	// prepare changes
+	var changes []string
+
+	// compare uniqueness
+	if existing.Unique != index.Unique {
+		changes = append(changes, "unique")
+	}
+
+	// compare expiry
+	var expiry int64
+	if existing.Expiry != nil {
+		expiry = *existing.Expiry
+	}
+	if expiry != int64(index.Expiry/time.Second) {
+		changes = append(changes, "expiry")
+	}
+
+	// compare filter
+	if (existing.Filter == nil) != (index.Filter == nil) {
+		changes = append(changes, "filter")
+	} else if existing.Filter != nil {
+		a, err := bsonkit.Transform(existing.Filter)
+		if err != nil {
+			return nil, xo.W(err)
+		}
+		b, err := bsonkit.Transform(index.Filter)
+		if err != nil {
+			return nil, xo.W(err)
+		}
+		if bsonkit.Compare(*a, *b) != 0 {
+			changes = append(changes, "filter")
+		}
+	}
+
+	return changes, nil
+}
+
+func sameIndexKey(a, b bson.D) bool {
+	// check length
+	if len(a) != len(b) {
+		return false
+	}
+
+	// compare fields and directions
+	for i := range a {
+		if a[i].Key != b[i].Key || bsonkit.Compare(a[i].Value, b[i].Value) != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func indexName(key bson.D) string {
+	// collect parts
+	parts := make([]string, 0, len(key))
+	for _, e := range key {
+		parts = append(parts, fmt.Sprintf("%s_%v", e.Key, e.Value))
+	}
+
+	return strings.Join(parts, "_")
+}
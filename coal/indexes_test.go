@@ -0,0 +1,152 @@
+package coal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestCatalogReconcileIndexes(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		dropAll := func() {
+			_, _ = tester.Store.DB().Collection("posts").Indexes().DropAll(nil)
+			_, _ = tester.Store.DB().Collection("comments").Indexes().DropAll(nil)
+		}
+
+		dropAll()
+		defer dropAll()
+
+		catalog := NewCatalog(&postModel{}, &commentModel{})
+		catalog.AddIndex(&postModel{}, false, 0, "Title")
+		catalog.AddIndex(&postModel{}, false, time.Minute, "Published")
+		catalog.AddPartialIndex(&commentModel{}, false, 0, []string{"Post"}, bson.D{
+			{Key: "Message", Value: "test"},
+		})
+
+		/* initial */
+
+		err := tester.Store.DB().Collection("comments").Drop(nil)
+		assert.NoError(t, err)
+
+		plan, err := catalog.ReconcileIndexes(tester.Store, false, true)
+		assert.NoError(t, err)
+		assert.Equal(t, "create comments.post_id_1\ncreate posts.title_1\ncreate posts.published_1", plan.String())
+
+		plan, err = catalog.ReconcileIndexes(tester.Store, false, false)
+		assert.NoError(t, err)
+		assert.Len(t, plan, 3)
+
+		plan, err = catalog.ReconcileIndexes(tester.Store, false, true)
+		assert.NoError(t, err)
+		assert.Empty(t, plan)
+
+		/* changed */
+
+		catalog = NewCatalog(&postModel{}, &commentModel{})
+		catalog.AddIndex(&postModel{}, true, 0, "Title")
+		catalog.AddIndex(&postModel{}, false, time.Hour, "Published")
+		catalog.AddIndex(&postModel{}, false, 0, "-TextBody")
+		catalog.AddPartialIndex(&commentModel{}, false, 0, []string{"Post"}, bson.D{
+			{Key: "Message", Value: "foo"},
+		})
+
+		plan, err = catalog.ReconcileIndexes(tester.Store, false, true)
+		assert.NoError(t, err)
+		assert.Equal(t, IndexPlan{
+			{
+				Action:     ModifyIndex,
+				Collection: "comments",
+				Name:       "post_id_1",
+				Index:      &catalog.FindIndexes("comments")[0],
+				Changes:    []string{"filter"},
+			},
+			{
+				Action:     ModifyIndex,
+				Collection: "posts",
+				Name:       "title_1",
+				Index:      &catalog.FindIndexes("posts")[0],
+				Changes:    []string{"unique"},
+			},
+			{
+				Action:     ModifyIndex,
+				Collection: "posts",
+				Name:       "published_1",
+				Index:      &catalog.FindIndexes("posts")[1],
+				Changes:    []string{"expiry"},
+				ttl:        true,
+			},
+			{
+				Action:     CreateIndex,
+				Collection: "posts",
+				Name:       "text_body_-1",
+				Index:      &catalog.FindIndexes("posts")[2],
+			},
+		}, plan)
+
+		plan, err = catalog.ReconcileIndexes(tester.Store, false, false)
+		assert.NoError(t, err)
+		assert.Len(t, plan, 4)
+
+		plan, err = catalog.ReconcileIndexes(tester.Store, false, true)
+		assert.NoError(t, err)
+		assert.Empty(t, plan)
+
+		/* unmanaged */
+
+		_, err = tester.Store.DB().Collection("posts").Indexes().CreateOne(nil, mongo.IndexModel{
+			Keys: bson.D{{Key: "text_body", Value: 1}},
+		})
+		assert.NoError(t, err)
+
+		plan, err = catalog.ReconcileIndexes(tester.Store, true, true)
+		assert.NoError(t, err)
+		assert.Empty(t, plan)
+
+		plan, err = catalog.ReconcileIndexes(tester.Store, false, false)
+		assert.NoError(t, err)
+		assert.Equal(t, "drop posts.text_body_1", plan.String())
+
+		/* ttl */
+
+		catalog = NewCatalog(&postModel{}, &commentModel{})
+		catalog.AddIndex(&postModel{}, true, time.Minute, "Title")
+		catalog.AddIndex(&postModel{}, false, time.Hour, "Published")
+		catalog.AddIndex(&postModel{}, false, 0, "-TextBody")
+		catalog.AddPartialIndex(&commentModel{}, false, 0, []string{"Post"}, bson.D{
+			{Key: "Message", Value: "foo"},
+		})
+
+		plan, err = catalog.ReconcileIndexes(tester.Store, false, false)
+		assert.NoError(t, err)
+		assert.Equal(t, IndexPlan{
+			{
+				Action:     ModifyIndex,
+				Collection: "posts",
+				Name:       "title_1",
+				Index:      &catalog.FindIndexes("posts")[0],
+				Changes:    []string{"expiry"},
+			},
+		}, plan)
+		assert.False(t, plan[0].inPlace())
+
+		plan, err = catalog.ReconcileIndexes(tester.Store, false, true)
+		assert.NoError(t, err)
+		assert.Empty(t, plan)
+
+		/* stale */
+
+		catalog = NewCatalog(&postModel{}, &commentModel{})
+		catalog.AddIndex(&postModel{}, true, time.Minute, "Title")
+
+		plan, err = catalog.ReconcileIndexes(tester.Store, false, false)
+		assert.NoError(t, err)
+		assert.Equal(t, "drop comments.post_id_1\ndrop posts.published_1\ndrop posts.text_body_-1", plan.String())
+
+		plan, err = catalog.ReconcileIndexes(tester.Store, false, true)
+		assert.NoError(t, err)
+		assert.Empty(t, plan)
+	})
+}
@@ -0,0 +1,447 @@
+package coal
+
+import (
+	"context"
+	"sort"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+const integrityBatchSize = 1000
+
+// IntegrityIssue describes a broken reference or a has-one violation.
+type IntegrityIssue struct {
+	// The plural name of the referencing model.
+	Model string
+
+	// The id of the referencing document.
+	ID ID
+
+	// The name of the referencing field.
+	Field string
+
+	// The broken reference or the reference that is shared by multiple
+	// documents in case of a has-one violation.
+	Ref Ref
+
+	// Whether the issue is a has-one violation.
+	Duplicate bool
+
+	// Whether the reference has been removed.
+	Repaired bool
+}
+
+// CheckIntegrity will stream all documents of the catalog models and validate
+// their to-one and to-many references against the referenced collections. It
+// will also report documents that violate has-one relationships by referencing
+// the same document as another document. If repair is requested, broken to-one
+// references are unset and broken to-many references are pulled. Has-one
+// violations are only reported. References are checked in batches of
+// documents using one query per field and referenced collection.
+func CheckIntegrity(ctx context.Context, store *Store, catalog *Catalog, repair bool, report func(IntegrityIssue)) error {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/CheckIntegrity")
+	defer span.End()
+
+	// ensure report
+	if report == nil {
+		report = func(IntegrityIssue) {}
+	}
+
+	// index models by collection
+	collections := map[string]Model{}
+	for _, model := range catalog.Models() {
+		collections[GetMeta(model).Collection] = model
+	}
+
+	// get sorted models
+	models := catalog.Models()
+	sort.Slice(models, func(i, j int) bool {
+		return GetMeta(models[i]).PluralName < GetMeta(models[j]).PluralName
+	})
+
+	// check models
+	for _, model := range models {
+		// check references
+		err := checkReferences(ctx, store, catalog, collections, model, repair, report)
+		if err != nil {
+			return err
+		}
+
+		// check has-one relationships
+		err = checkHasOne(ctx, store, catalog, model, report)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkReferences(ctx context.Context, store *Store, catalog *Catalog, collections map[string]Model, model Model, repair bool, report func(IntegrityIssue)) error {
+	// get meta
+	meta := GetMeta(model)
+
+	// collect relationship fields
+	var fields []*Field
+	for _, field := range meta.OrderedFields {
+		if field.ToOne || field.ToMany {
+			fields = append(fields, field)
+		}
+	}
+
+	// check fields
+	if len(fields) == 0 {
+		return nil
+	}
+
+	// find documents
+	iter, err := store.M(model).FindEach(ctx, bson.M{}, nil, 0, 0, false, NoTransaction, NoValidation)
+	if err != nil {
+		return err
+	}
+
+	// ensure close
+	defer iter.Close()
+
+	// iterate documents
+	var batch []Model
+	for iter.Next() {
+		// decode document
+		doc := meta.Make()
+		err = iter.Decode(doc)
+		if err != nil {
+			return err
+		}
+
+		// add document
+		batch = append(batch, doc)
+
+		// check batch if full
+		if len(batch) >= integrityBatchSize {
+			err = checkBatch(ctx, store, catalog, collections, fields, batch, repair, report)
+			if err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	// check error
+	err = iter.Error()
+	if err != nil {
+		return err
+	}
+
+	// check remaining batch
+	err = checkBatch(ctx, store, catalog, collections, fields, batch, repair, report)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func checkBatch(ctx context.Context, store *Store, catalog *Catalog, collections map[string]Model, fields []*Field, batch []Model, repair bool, report func(IntegrityIssue)) error {
+	// check batch
+	if len(batch) == 0 {
+		return nil
+	}
+
+	// collect references
+	refs := make([][][]Ref, len(batch))
+	for i, doc := range batch {
+		refs[i] = make([][]Ref, len(fields))
+		for j, field := range fields {
+			list, err := collectReferences(catalog, doc, field)
+			if err != nil {
+				return err
+			}
+			refs[i][j] = list
+		}
+	}
+
+	// find broken references per field
+	broken := make([]map[Ref]bool, len(fields))
+	for j, field := range fields {
+		// merge references
+		var all []Ref
+		for i := range batch {
+			all = append(all, refs[i][j]...)
+		}
+
+		// find broken references
+		list, err := brokenReferences(ctx, store, collections, field, all)
+		if err != nil {
+			return err
+		}
+
+		// index broken references
+		broken[j] = map[Ref]bool{}
+		for _, ref := range list {
+			broken[j][ref] = true
+		}
+	}
+
+	// handle documents
+	for i, doc := range batch {
+		for j, field := range fields {
+			// get broken references
+			var list []Ref
+			for _, ref := range refs[i][j] {
+				if broken[j][ref] {
+					list = append(list, ref)
+				}
+			}
+
+			// repair references
+			var err error
+			repaired := false
+			if repair && len(list) > 0 {
+				repaired, err = repairReferences(ctx, store, doc, field, list)
+				if err != nil {
+					return err
+				}
+			}
+
+			// report issues
+			for _, ref := range list {
+				report(IntegrityIssue{
+					Model:    GetMeta(doc).PluralName,
+					ID:       doc.ID(),
+					Field:    field.Name,
+					Ref:      ref,
+					Repaired: repaired,
+				})
+			}
+		}
+	}
+
+	return nil
+}
+
+func collectReferences(catalog *Catalog, doc Model, field *Field) ([]Ref, error) {
+	// collect references
+	var refs []Ref
+	switch value := stick.MustGet(doc, field.Name).(type) {
+	case ID:
+		refs = append(refs, Ref{ID: value})
+	case *ID:
+		if value != nil {
+			refs = append(refs, Ref{ID: *value})
+		}
+	case []ID:
+		for _, id := range value {
+			refs = append(refs, Ref{ID: id})
+		}
+	case Ref:
+		refs = append(refs, value)
+	case *Ref:
+		if value != nil {
+			refs = append(refs, *value)
+		}
+	case []Ref:
+		refs = append(refs, value...)
+	}
+
+	// remove zero references
+	list := refs[:0]
+	for _, ref := range refs {
+		if !ref.ID.IsZero() {
+			list = append(list, ref)
+		}
+	}
+	refs = list
+
+	// set collection of static references
+	if !field.Polymorphic {
+		target := catalog.Find(field.RelType)
+		if target == nil {
+			return nil, xo.F("missing model %q in catalog", field.RelType)
+		}
+		for i := range refs {
+			refs[i].Coll = GetMeta(target).Collection
+		}
+	}
+
+	return refs, nil
+}
+
+func brokenReferences(ctx context.Context, store *Store, collections map[string]Model, field *Field, refs []Ref) ([]Ref, error) {
+	// group references by collection
+	var broken []Ref
+	ids := map[string][]ID{}
+	for _, ref := range refs {
+		// check target
+		target := collections[ref.Coll]
+		if target == nil || (field.Polymorphic && len(field.RelTypes) > 0 && !stick.Contains(field.RelTypes, GetMeta(target).PluralName)) {
+			broken = append(broken, ref)
+			continue
+		}
+
+		// add id
+		ids[ref.Coll] = append(ids[ref.Coll], ref.ID)
+	}
+
+	// find existing documents
+	existing := map[Ref]bool{}
+	for coll, list := range ids {
+		result, err := store.M(collections[coll]).Distinct(ctx, "_id", bson.M{
+			"_id": bson.M{
+				"$in": list,
+			},
+		}, false, NoTransaction)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range result {
+			existing[Ref{Coll: coll, ID: id.(ID)}] = true
+		}
+	}
+
+	// collect missing references
+	for _, ref := range refs {
+		if _, ok := ids[ref.Coll]; ok && !existing[ref] {
+			broken = append(broken, ref)
+		}
+	}
+
+	return broken, nil
+}
+
+func repairReferences(ctx context.Context, store *Store, doc Model, field *Field, broken []Ref) (bool, error) {
+	// get value
+	value := stick.MustGet(doc, field.Name)
+
+	// prepare update
+	var update bson.M
+	switch value := value.(type) {
+	case []ID:
+		list := make([]ID, 0, len(value))
+		for _, id := range value {
+			if !refsContain(broken, Ref{Coll: broken[0].Coll, ID: id}) {
+				list = append(list, id)
+			}
+		}
+		update = bson.M{
+			"$set": bson.M{
+				field.Name: list,
+			},
+		}
+	case []Ref:
+		list := make([]Ref, 0, len(value))
+		for _, ref := range value {
+			if !refsContain(broken, ref) {
+				list = append(list, ref)
+			}
+		}
+		update = bson.M{
+			"$set": bson.M{
+				field.Name: list,
+			},
+		}
+	default:
+		update = bson.M{
+			"$unset": bson.M{
+				field.Name: "",
+			},
+		}
+	}
+
+	// update document if unchanged
+	found, err := store.M(doc).UpdateFirst(ctx, nil, bson.M{
+		"_id":      doc.ID(),
+		field.Name: value,
+	}, update, nil, false, NoValidation)
+	if err != nil {
+		return false, err
+	}
+
+	return found, nil
+}
+
+func refsContain(refs []Ref, ref Ref) bool {
+	for _, r := range refs {
+		if r == ref {
+			return true
+		}
+	}
+
+	return false
+}
+
+func checkHasOne(ctx context.Context, store *Store, catalog *Catalog, model Model, report func(IntegrityIssue)) error {
+	// check has-one fields
+	for _, field := range GetMeta(model).OrderedFields {
+		// check field
+		if !field.HasOne {
+			continue
+		}
+
+		// get referencing model
+		referencing := catalog.Find(field.RelType)
+		if referencing == nil {
+			return xo.F("missing model %q in catalog", field.RelType)
+		}
+
+		// get referencing field
+		var inverse *Field
+		for _, f := range GetMeta(referencing).OrderedFields {
+			if f.RelName == field.RelInverse && f.ToOne {
+				inverse = f
+			}
+		}
+		if inverse == nil {
+			return xo.F("missing inverse relationship %q on %q", field.RelInverse, field.RelType)
+		}
+
+		// prepare reference collection
+		coll := GetMeta(model).Collection
+
+		// find duplicates
+		seen := map[ID]bool{}
+		var issues []IntegrityIssue
+		err := store.M(referencing).ProjectEach(ctx, bson.M{}, inverse.Name, nil, 0, 0, false, func(id ID, val interface{}) bool {
+			// get reference
+			var ref ID
+			switch val := val.(type) {
+			case ID:
+				ref = val
+			case *ID:
+				if val == nil {
+					return true
+				}
+				ref = *val
+			default:
+				return true
+			}
+
+			// check reference
+			if seen[ref] {
+				issues = append(issues, IntegrityIssue{
+					Model:     GetMeta(referencing).PluralName,
+					ID:        id,
+					Field:     inverse.Name,
+					Ref:       Ref{Coll: coll, ID: ref},
+					Duplicate: true,
+				})
+			}
+			seen[ref] = true
+
+			return true
+		}, NoTransaction)
+		if err != nil {
+			return err
+		}
+
+		// report issues
+		for _, issue := range issues {
+			report(issue)
+		}
+	}
+
+	return nil
+}
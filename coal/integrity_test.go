@@ -0,0 +1,101 @@
+package coal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		catalog := NewCatalog(modelList...)
+
+		post := tester.Insert(&postModel{}).(*postModel)
+		missing := New()
+
+		comment := tester.Insert(&commentModel{
+			Parent: &missing,
+			Post:   post.ID(),
+		}).(*commentModel)
+		selection := tester.Insert(&selectionModel{
+			Posts: []ID{post.ID(), missing},
+		}).(*selectionModel)
+		note1 := tester.Insert(&noteModel{
+			Post: post.ID(),
+		}).(*noteModel)
+		note2 := tester.Insert(&noteModel{
+			Post: post.ID(),
+		}).(*noteModel)
+		poly := tester.Insert(&polyModel{
+			Ref1: R(post),
+			Ref2: &Ref{Coll: "notes", ID: note1.ID()},
+			Ref3: []Ref{R(selection), {Coll: "notes", ID: missing}},
+		}).(*polyModel)
+
+		var issues []IntegrityIssue
+		err := CheckIntegrity(nil, tester.Store, catalog, false, func(issue IntegrityIssue) {
+			issues = append(issues, issue)
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []IntegrityIssue{
+			{
+				Model: "comments",
+				ID:    comment.ID(),
+				Field: "Parent",
+				Ref:   Ref{Coll: "comments", ID: missing},
+			},
+			{
+				Model: "polys",
+				ID:    poly.ID(),
+				Field: "Ref2",
+				Ref:   Ref{Coll: "notes", ID: note1.ID()},
+			},
+			{
+				Model: "polys",
+				ID:    poly.ID(),
+				Field: "Ref3",
+				Ref:   Ref{Coll: "notes", ID: missing},
+			},
+			{
+				Model:     "notes",
+				ID:        note2.ID(),
+				Field:     "Post",
+				Ref:       Ref{Coll: "posts", ID: post.ID()},
+				Duplicate: true,
+			},
+			{
+				Model: "selections",
+				ID:    selection.ID(),
+				Field: "Posts",
+				Ref:   Ref{Coll: "posts", ID: missing},
+			},
+		}, issues)
+
+		issues = nil
+		err = CheckIntegrity(nil, tester.Store, catalog, true, func(issue IntegrityIssue) {
+			issues = append(issues, issue)
+		})
+		assert.NoError(t, err)
+		assert.Len(t, issues, 5)
+		for _, issue := range issues {
+			assert.Equal(t, !issue.Duplicate, issue.Repaired)
+		}
+
+		assert.Nil(t, tester.Fetch(&commentModel{}, comment.ID()).(*commentModel).Parent)
+		assert.Equal(t, []ID{post.ID()}, tester.Fetch(&selectionModel{}, selection.ID()).(*selectionModel).Posts)
+		poly = tester.Fetch(&polyModel{}, poly.ID()).(*polyModel)
+		assert.Nil(t, poly.Ref2)
+		assert.Equal(t, []Ref{R(selection)}, poly.Ref3)
+
+		issues = nil
+		err = CheckIntegrity(nil, tester.Store, catalog, false, func(issue IntegrityIssue) {
+			issues = append(issues, issue)
+		})
+		assert.NoError(t, err)
+		assert.Len(t, issues, 1)
+		assert.True(t, issues[0].Duplicate)
+
+		err = CheckIntegrity(nil, tester.Store, catalog, false, nil)
+		assert.NoError(t, err)
+	})
+}
@@ -3,15 +3,15 @@ package coal
 import (
 	"context"
 	"reflect"
+	"strings"
 
 	"github.com/256dpi/lungo/bsonkit"
+	"github.com/256dpi/lungo/mongokit"
 	"github.com/256dpi/xo"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// TODO: Validate updates before writing.
-
 // Flags can be used to change the behaviour of operations.
 type Flags int
 
@@ -22,6 +22,12 @@ const (
 
 	// NoValidation will allow storing and retrieving invalid models.
 	NoValidation
+
+	// Validation will validate updates to unlocked or multiple documents,
+	// which are otherwise not validated. Without a lock, the document read for
+	// validation may not be the one that is written, therefore validation is
+	// only enabled by default for locked documents. It requires a transaction.
+	Validation
 )
 
 // Has returns whether the receiver has set all provided flags.
@@ -57,9 +63,11 @@ var returnAfterUpdate = options.FindOneAndUpdate().SetReturnDocument(options.Aft
 // Manager manages operations on collection of documents. It will validate
 // operations and ensure that they are safe under the MongoDB guarantees.
 type Manager struct {
-	meta  *Meta
-	coll  *Collection
-	trans *Translator
+	meta        *Meta
+	coll        *Collection
+	trans       *Translator
+	diagnostics *Diagnostics
+	reporter    func(error)
 }
 
 // C is a short-hand to access the mangers collection.
@@ -106,9 +114,9 @@ func (m *Manager) Find(ctx context.Context, model Model, id ID, lock bool, flags
 	// find document
 	var err error
 	if lock {
-		err = m.coll.FindOneAndUpdate(ctx, filter, incrementLock, returnAfterUpdate).Decode(model)
+		err = m.decodeResult(ctx, m.coll.FindOneAndUpdate(ctx, filter, incrementLock, returnAfterUpdate), model)
 	} else {
-		err = m.coll.FindOne(ctx, filter).Decode(model)
+		err = m.decodeResult(ctx, m.coll.FindOne(ctx, filter), model)
 	}
 	if IsMissing(err) {
 		return false, nil
@@ -116,6 +124,12 @@ func (m *Manager) Find(ctx context.Context, model Model, id ID, lock bool, flags
 		return false, err
 	}
 
+	// decrypt model
+	err = m.decrypt(model)
+	if err != nil {
+		return false, err
+	}
+
 	// validate model
 	if !Merge(flags).Has(NoValidation) {
 		err = model.Validate()
@@ -176,6 +190,13 @@ func (m *Manager) FindFirst(ctx context.Context, model Model, filter bson.M, sor
 		}
 	}
 
+	// diagnose query
+	done, err := m.diagnose(&span, "FindFirst", filterDoc, sortDoc)
+	if err != nil {
+		return false, err
+	}
+	defer done()
+
 	// find document
 	if lock {
 		// prepare options
@@ -185,7 +206,7 @@ func (m *Manager) FindFirst(ctx context.Context, model Model, filter bson.M, sor
 		}
 
 		// find and update
-		err = m.coll.FindOneAndUpdate(ctx, filterDoc, incrementLock, returnAfterUpdate, opts).Decode(model)
+		err = m.decodeResult(ctx, m.coll.FindOneAndUpdate(ctx, filterDoc, incrementLock, returnAfterUpdate, opts), model)
 	} else {
 		// prepare options
 		opts := options.FindOne()
@@ -197,7 +218,7 @@ func (m *Manager) FindFirst(ctx context.Context, model Model, filter bson.M, sor
 		}
 
 		// find
-		err = m.coll.FindOne(ctx, filterDoc, opts).Decode(model)
+		err = m.decodeResult(ctx, m.coll.FindOne(ctx, filterDoc, opts), model)
 	}
 	if IsMissing(err) {
 		return false, nil
@@ -205,6 +226,12 @@ func (m *Manager) FindFirst(ctx context.Context, model Model, filter bson.M, sor
 		return false, err
 	}
 
+	// decrypt model
+	err = m.decrypt(model)
+	if err != nil {
+		return false, err
+	}
+
 	// validate model
 	if !Merge(flags).Has(NoValidation) {
 		err = model.Validate()
@@ -269,6 +296,13 @@ func (m *Manager) FindAll(ctx context.Context, list interface{}, filter bson.M,
 		}
 	}
 
+	// diagnose query
+	done, err := m.diagnose(&span, "FindAll", filterDoc, opts.Sort)
+	if err != nil {
+		return err
+	}
+	defer done()
+
 	// set skip
 	if skip > 0 {
 		opts.SetSkip(skip)
@@ -294,11 +328,19 @@ func (m *Manager) FindAll(ctx context.Context, list interface{}, filter bson.M,
 	}
 
 	// decode all
-	err = iter.All(list)
+	err = m.decodeAll(ctx, iter, list)
 	if err != nil {
 		return err
 	}
 
+	// decrypt models
+	for _, model := range Slice(list) {
+		err = m.decrypt(model)
+		if err != nil {
+			return err
+		}
+	}
+
 	// validate models
 	if !Merge(flags).Has(NoValidation) {
 		for _, model := range Slice(list) {
@@ -359,6 +401,13 @@ func (m *Manager) FindEach(ctx context.Context, filter bson.M, sort []string, sk
 		}
 	}
 
+	// diagnose query
+	done, err := m.diagnose(&span, "FindEach", filterDoc, opts.Sort)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
 	// set skip
 	if skip > 0 {
 		opts.SetSkip(skip)
@@ -390,7 +439,7 @@ func (m *Manager) FindEach(ctx context.Context, filter bson.M, sort []string, sk
 	validate := !Merge(flags).Has(NoValidation)
 
 	return &ManagedIterator{
-		meta:     m.meta,
+		manager:  m,
 		iterator: iter,
 		validate: validate,
 	}, nil
@@ -524,6 +573,13 @@ func (m *Manager) project(ctx context.Context, filter bson.M, field string, sort
 		}
 	}
 
+	// diagnose query
+	done, err := m.diagnose(nil, "Project", filterDoc, opts.Sort)
+	if err != nil {
+		return err
+	}
+	defer done()
+
 	// set skip
 	if skip > 0 {
 		opts.SetSkip(skip)
@@ -565,8 +621,14 @@ func (m *Manager) project(ctx context.Context, filter bson.M, field string, sort
 			return err
 		}
 
+		// decrypt value
+		value, err := m.decryptRaw(field, item[field])
+		if err != nil {
+			return err
+		}
+
 		// yield pair
-		if !fn(item["_id"].(ID), item[field]) {
+		if !fn(item["_id"].(ID), value) {
 			break
 		}
 	}
@@ -609,6 +671,13 @@ func (m *Manager) Count(ctx context.Context, filter bson.M, skip, limit int64, l
 		return 0, err
 	}
 
+	// diagnose query
+	done, err := m.diagnose(&span, "Count", filterDoc, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+
 	// prepare options
 	opts := options.Count()
 
@@ -671,6 +740,13 @@ func (m *Manager) Distinct(ctx context.Context, field string, filter bson.M, loc
 		return nil, err
 	}
 
+	// diagnose query
+	done, err := m.diagnose(&span, "Distinct", filterDoc, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
 	// lock documents
 	if lock {
 		_, err = m.coll.UpdateMany(ctx, filterDoc, incrementLock)
@@ -688,6 +764,79 @@ func (m *Manager) Distinct(ctx context.Context, field string, filter bson.M, loc
 	return result, nil
 }
 
+// Aggregate will run the provided aggregation pipeline and decode the results
+// into the provided list. Field names in the pipeline are translated using
+// Translator.Pipeline. If the list elements are models of the manager, the
+// results are also decrypted and validated.
+//
+// A transaction is required to ensure isolation.
+//
+// NoTransaction: The result may miss documents or include them multiple times
+// if interleaving operations move the documents in the used index.
+func (m *Manager) Aggregate(ctx context.Context, list interface{}, pipeline []bson.M, flags ...Flags) error {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Manager.Aggregate")
+	defer span.End()
+
+	// check list
+	if list == nil {
+		return xo.F("missing list")
+	}
+	lt := reflect.TypeOf(list)
+	if lt.Kind() != reflect.Ptr || lt.Elem().Kind() != reflect.Slice {
+		return xo.F("expected slice pointer")
+	}
+
+	// require transaction if not unsafe
+	if !Merge(flags).Has(NoTransaction) && !HasTransaction(ctx) {
+		return ErrTransactionRequired.Wrap()
+	}
+
+	// translate pipeline
+	pipelineDoc, err := m.trans.Pipeline(pipeline)
+	if err != nil {
+		return err
+	}
+
+	// run aggregation
+	iter, err := m.coll.Aggregate(ctx, pipelineDoc)
+	if err != nil {
+		return err
+	}
+
+	// decode all
+	err = iter.All(list)
+	if err != nil {
+		return err
+	}
+
+	// check models
+	et := lt.Elem().Elem()
+	if et != m.meta.Type && (et.Kind() != reflect.Ptr || et.Elem() != m.meta.Type) {
+		return nil
+	}
+
+	// decrypt models
+	for _, model := range Slice(list) {
+		err = m.decrypt(model)
+		if err != nil {
+			return err
+		}
+	}
+
+	// validate models
+	if !Merge(flags).Has(NoValidation) {
+		for _, model := range Slice(list) {
+			err = model.Validate()
+			if err != nil {
+				return xo.W(err)
+			}
+		}
+	}
+
+	return nil
+}
+
 // Insert will insert the provided document. If the document has a zero id a new
 // id will be generated and assigned.
 func (m *Manager) Insert(ctx context.Context, models Model, flags ...Flags) error {
@@ -741,7 +890,11 @@ func (m *Manager) insert(ctx context.Context, models []Model, flags ...Flags) er
 	// get documents
 	docs := make([]interface{}, 0, len(models))
 	for _, model := range models {
-		docs = append(docs, model)
+		doc, err := m.encode(model)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, doc)
 	}
 
 	// insert documents or document
@@ -787,6 +940,13 @@ func (m *Manager) InsertIfMissing(ctx context.Context, filter bson.M, model Mode
 		return false, err
 	}
 
+	// diagnose query
+	done, err := m.diagnose(&span, "InsertIfMissing", filterDoc, nil)
+	if err != nil {
+		return false, err
+	}
+	defer done()
+
 	// check model
 	if GetMeta(model) != m.meta {
 		return false, ErrMetaMismatch.Wrap()
@@ -808,9 +968,15 @@ func (m *Manager) InsertIfMissing(ctx context.Context, filter bson.M, model Mode
 	// prepare options
 	opts := options.Update().SetUpsert(true)
 
+	// encode model
+	doc, err := m.encode(model)
+	if err != nil {
+		return false, err
+	}
+
 	// prepare update
 	update := bson.M{
-		"$setOnInsert": model,
+		"$setOnInsert": doc,
 	}
 
 	// increment lock
@@ -868,10 +1034,16 @@ func (m *Manager) Replace(ctx context.Context, model Model, lock bool, flags ...
 		model.GetBase().Lock += 1000
 	}
 
+	// encode model
+	doc, err := m.encode(model)
+	if err != nil {
+		return false, err
+	}
+
 	// replace document
 	res, err := m.coll.ReplaceOne(ctx, bson.M{
 		"_id": model.ID(),
-	}, model)
+	}, doc)
 	if err != nil {
 		return false, err
 	}
@@ -922,8 +1094,21 @@ func (m *Manager) ReplaceFirst(ctx context.Context, filter bson.M, model Model,
 		return false, err
 	}
 
+	// diagnose query
+	done, err := m.diagnose(&span, "ReplaceFirst", filterDoc, nil)
+	if err != nil {
+		return false, err
+	}
+	defer done()
+
+	// encode model
+	doc, err := m.encode(model)
+	if err != nil {
+		return false, err
+	}
+
 	// replace document
-	res, err := m.coll.ReplaceOne(ctx, filterDoc, model)
+	res, err := m.coll.ReplaceOne(ctx, filterDoc, doc)
 	if err != nil {
 		return false, err
 	}
@@ -937,7 +1122,14 @@ func (m *Manager) ReplaceFirst(ctx context.Context, filter bson.M, model Model,
 // update did not change the document.
 //
 // A transaction is required for locking.
-func (m *Manager) Update(ctx context.Context, model Model, id ID, update bson.M, lock bool) (bool, error) {
+//
+// Validation: The update is applied to the locked or, if requested, unlocked
+// document in memory to validate the result before writing. A transaction is
+// required for validation and NoValidation skips it for locked documents.
+// Updates that cannot be applied in memory e.g. using "$addToSet", "$pull" or
+// "$each" are validated after writing and the transaction must be aborted if
+// an error is returned.
+func (m *Manager) Update(ctx context.Context, model Model, id ID, update bson.M, lock bool, flags ...Flags) (bool, error) {
 	// trace
 	ctx, span := xo.Trace(ctx, "coal/Manager.Update")
 	defer span.End()
@@ -971,6 +1163,15 @@ func (m *Manager) Update(ctx context.Context, model Model, id ID, update bson.M,
 		}
 	}
 
+	// validate update
+	var validateAfter bool
+	if m.validating(lock, flags) {
+		validateAfter, err = m.validateUpdate(ctx, bson.D{{Key: "_id", Value: id}}, updateDoc, nil, false, false)
+		if err != nil {
+			return false, err
+		}
+	}
+
 	// find and update document
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 	err = m.coll.FindOneAndUpdate(ctx, bson.M{
@@ -982,6 +1183,20 @@ func (m *Manager) Update(ctx context.Context, model Model, id ID, update bson.M,
 		return false, err
 	}
 
+	// decrypt model
+	err = m.decrypt(model)
+	if err != nil {
+		return false, err
+	}
+
+	// validate updated model
+	if validateAfter {
+		err = model.Validate()
+		if err != nil {
+			return false, xo.W(err)
+		}
+	}
+
 	return true, nil
 }
 
@@ -992,9 +1207,16 @@ func (m *Manager) Update(ctx context.Context, model Model, id ID, update bson.M,
 //
 // A transaction is required for locking.
 //
+// Validation: The update is applied to the locked or, if requested, unlocked
+// document in memory to validate the result before writing. A transaction is
+// required for validation and NoValidation skips it for locked documents.
+// Updates that cannot be applied in memory e.g. using "$addToSet", "$pull" or
+// "$each" are validated after writing and the transaction must be aborted if
+// an error is returned.
+//
 // Warning: If the operation depends on interleaving writes to not include or
 // exclude documents from the filter it should be run as part of a transaction.
-func (m *Manager) UpdateFirst(ctx context.Context, model Model, filter, update bson.M, sort []string, lock bool) (bool, error) {
+func (m *Manager) UpdateFirst(ctx context.Context, model Model, filter, update bson.M, sort []string, lock bool, flags ...Flags) (bool, error) {
 	// trace
 	ctx, span := xo.Trace(ctx, "coal/Manager.UpdateFirst")
 	defer span.End()
@@ -1037,6 +1259,13 @@ func (m *Manager) UpdateFirst(ctx context.Context, model Model, filter, update b
 		}
 	}
 
+	// diagnose query
+	done, err := m.diagnose(&span, "UpdateFirst", filterDoc, opts.Sort)
+	if err != nil {
+		return false, err
+	}
+	defer done()
+
 	// increment lock
 	if lock {
 		_, err := bsonkit.Put(&updateDoc, "$inc._lk", 1, false)
@@ -1045,6 +1274,15 @@ func (m *Manager) UpdateFirst(ctx context.Context, model Model, filter, update b
 		}
 	}
 
+	// validate update
+	var validateAfter bool
+	if m.validating(lock, flags) {
+		validateAfter, err = m.validateUpdate(ctx, filterDoc, updateDoc, opts.Sort, false, false)
+		if err != nil {
+			return false, err
+		}
+	}
+
 	// find and update document
 	err = m.coll.FindOneAndUpdate(ctx, filterDoc, updateDoc, opts).Decode(model)
 	if IsMissing(err) {
@@ -1053,6 +1291,20 @@ func (m *Manager) UpdateFirst(ctx context.Context, model Model, filter, update b
 		return false, err
 	}
 
+	// decrypt model
+	err = m.decrypt(model)
+	if err != nil {
+		return false, err
+	}
+
+	// validate updated model
+	if validateAfter {
+		err = model.Validate()
+		if err != nil {
+			return false, xo.W(err)
+		}
+	}
+
 	return true, nil
 }
 
@@ -1063,9 +1315,16 @@ func (m *Manager) UpdateFirst(ctx context.Context, model Model, filter, update b
 //
 // A transaction is required for locking.
 //
+// Validation: If requested, the update is applied to all matched documents in
+// memory to validate the results before writing. A transaction is required for
+// validation.
+// Updates that cannot be applied in memory e.g. using "$addToSet", "$pull" or
+// "$each" are validated after writing and the transaction must be aborted if
+// an error is returned.
+//
 // Warning: If the operation depends on interleaving writes to not include or
 // exclude documents from the filter it should be run as part of a transaction.
-func (m *Manager) UpdateAll(ctx context.Context, filter, update bson.M, lock bool) (int64, error) {
+func (m *Manager) UpdateAll(ctx context.Context, filter, update bson.M, lock bool, flags ...Flags) (int64, error) {
 	// trace
 	ctx, span := xo.Trace(ctx, "coal/Manager.UpdateAll")
 	defer span.End()
@@ -1081,6 +1340,13 @@ func (m *Manager) UpdateAll(ctx context.Context, filter, update bson.M, lock boo
 		return 0, err
 	}
 
+	// diagnose query
+	done, err := m.diagnose(&span, "UpdateAll", filterDoc, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+
 	// translate update
 	updateDoc, err := m.trans.Document(update)
 	if err != nil {
@@ -1095,12 +1361,37 @@ func (m *Manager) UpdateAll(ctx context.Context, filter, update bson.M, lock boo
 		}
 	}
 
+	// validate update
+	var validateAfter []interface{}
+	if m.validating(false, flags) {
+		after, err := m.validateUpdate(ctx, filterDoc, updateDoc, nil, false, true)
+		if err != nil {
+			return 0, err
+		}
+
+		// get matched documents to validate them after the update
+		if after {
+			validateAfter, err = m.coll.Distinct(ctx, "_id", filterDoc)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
 	// update documents
 	res, err := m.coll.UpdateMany(ctx, filterDoc, updateDoc)
 	if err != nil {
 		return 0, err
 	}
 
+	// validate updated documents
+	if len(validateAfter) > 0 {
+		err = m.validateDocuments(ctx, validateAfter)
+		if err != nil {
+			return 0, err
+		}
+	}
+
 	return res.MatchedCount, nil
 }
 
@@ -1112,9 +1403,17 @@ func (m *Manager) UpdateAll(ctx context.Context, filter, update bson.M, lock boo
 //
 // A transaction is required for locking.
 //
+// Validation: The update is applied to the locked or, if requested, unlocked
+// document or the upserted document in memory to validate the result before
+// writing. A transaction is required for validation and NoValidation skips it
+// for locked documents.
+// Updates that cannot be applied in memory e.g. using "$addToSet", "$pull" or
+// "$each" are validated after writing and the transaction must be aborted if
+// an error is returned.
+//
 // Warning: Even with transactions there is a risk for duplicate inserts when
 // the filter is not covered by a unique index.
-func (m *Manager) Upsert(ctx context.Context, model Model, filter, update bson.M, sort []string, lock bool) (bool, error) {
+func (m *Manager) Upsert(ctx context.Context, model Model, filter, update bson.M, sort []string, lock bool, flags ...Flags) (bool, error) {
 	// trace
 	ctx, span := xo.Trace(ctx, "coal/Manager.Upsert")
 	defer span.End()
@@ -1165,6 +1464,28 @@ func (m *Manager) Upsert(ctx context.Context, model Model, filter, update bson.M
 		}
 	}
 
+	// diagnose query
+	done, err := m.diagnose(&span, "Upsert", filterDoc, opts.Sort)
+	if err != nil {
+		return false, err
+	}
+	defer done()
+
+	// validate update
+	var validateAfter bool
+	if m.validating(lock, flags) {
+		validateAfter, err = m.validateUpdate(ctx, filterDoc, updateDoc, opts.Sort, true, false)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// set version on insert
+	err = m.stampUpsert(&updateDoc)
+	if err != nil {
+		return false, err
+	}
+
 	// set token (to determine insert vs. update)
 	token := New()
 	_, err = bsonkit.Put(&updateDoc, "$setOnInsert._tk", token, false)
@@ -1180,6 +1501,20 @@ func (m *Manager) Upsert(ctx context.Context, model Model, filter, update bson.M
 		return false, err
 	}
 
+	// decrypt model
+	err = m.decrypt(model)
+	if err != nil {
+		return false, err
+	}
+
+	// validate updated model
+	if validateAfter {
+		err = model.Validate()
+		if err != nil {
+			return false, xo.W(err)
+		}
+	}
+
 	return model.GetBase().Token == token, nil
 }
 
@@ -1217,6 +1552,12 @@ func (m *Manager) Delete(ctx context.Context, model Model, id ID) (bool, error)
 		return false, err
 	}
 
+	// decrypt model
+	err = m.decrypt(model)
+	if err != nil {
+		return false, err
+	}
+
 	return true, nil
 }
 
@@ -1236,6 +1577,13 @@ func (m *Manager) DeleteAll(ctx context.Context, filter bson.M) (int64, error) {
 		return 0, err
 	}
 
+	// diagnose query
+	done, err := m.diagnose(&span, "DeleteAll", filterDoc, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+
 	// update documents
 	res, err := m.coll.DeleteMany(ctx, filterDoc)
 	if err != nil {
@@ -1282,6 +1630,13 @@ func (m *Manager) DeleteFirst(ctx context.Context, model Model, filter bson.M, s
 		}
 	}
 
+	// diagnose query
+	done, err := m.diagnose(&span, "DeleteFirst", filterDoc, opts.Sort)
+	if err != nil {
+		return false, err
+	}
+	defer done()
+
 	// find and delete document
 	err = m.coll.FindOneAndDelete(ctx, filterDoc, opts).Decode(model)
 	if IsMissing(err) {
@@ -1290,12 +1645,222 @@ func (m *Manager) DeleteFirst(ctx context.Context, model Model, filter bson.M, s
 		return false, err
 	}
 
+	// decrypt model
+	err = m.decrypt(model)
+	if err != nil {
+		return false, err
+	}
+
 	return true, nil
 }
 
+func (m *Manager) validating(lock bool, flags []Flags) bool {
+	// check flags
+	merged := Merge(flags)
+	if merged.Has(NoValidation) {
+		return false
+	}
+
+	return lock || merged.Has(Validation)
+}
+
+func (m *Manager) validateUpdate(ctx context.Context, filter, update bson.D, sort interface{}, upsert, many bool) (bool, error) {
+	// require transaction
+	if !HasTransaction(ctx) {
+		return false, ErrTransactionRequired.Wrap()
+	}
+
+	// normalize filter and update
+	filterDoc, err := bsonkit.Transform(filter)
+	if err != nil {
+		return false, xo.W(err)
+	}
+	updateDoc, err := bsonkit.Transform(update)
+	if err != nil {
+		return false, xo.W(err)
+	}
+
+	// validate after the write if the update cannot be applied in memory
+	if !applicableUpdate(updateDoc) {
+		return true, nil
+	}
+
+	// prepare options
+	opts := options.Find()
+	if sort != nil {
+		opts.SetSort(sort)
+	}
+	if !many {
+		opts.SetLimit(1)
+	}
+
+	// find documents
+	iter, err := m.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return false, err
+	}
+
+	// ensure close
+	defer iter.Close()
+
+	// validate documents
+	var found bool
+	for iter.Next() {
+		// decode document
+		var raw bson.Raw
+		err = iter.Decode(&raw)
+		if err != nil {
+			return false, err
+		}
+
+		// upgrade document
+		doc, err := m.upgradeRaw(raw)
+		if err != nil {
+			return false, err
+		}
+
+		// validate document
+		err = m.validateDocument(doc, filterDoc, updateDoc, false)
+		if err != nil {
+			return false, err
+		}
+
+		found = true
+	}
+
+	// check error
+	err = iter.Error()
+	if err != nil {
+		return false, err
+	}
+
+	// validate upserted document
+	if !found && upsert {
+		// extract document from filter
+		doc, err := mongokit.Extract(filterDoc)
+		if err != nil {
+			return false, xo.W(err)
+		}
+
+		// ensure id
+		if bsonkit.Get(doc, "_id") == bsonkit.Missing {
+			_, err = bsonkit.Put(doc, "_id", New(), true)
+			if err != nil {
+				return false, xo.W(err)
+			}
+		}
+
+		// validate document
+		err = m.validateDocument(doc, filterDoc, updateDoc, true)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+func (m *Manager) validateDocument(doc, filter, update bsonkit.Doc, upsert bool) error {
+	// apply update
+	_, err := mongokit.Apply(doc, filter, update, upsert, nil)
+	if err != nil {
+		return xo.W(err)
+	}
+
+	// decode model
+	model := m.meta.Make()
+	err = bsonkit.Decode(doc, model)
+	if err != nil {
+		return xo.W(err)
+	}
+
+	// decrypt model
+	err = m.decrypt(model)
+	if err != nil {
+		return err
+	}
+
+	// validate model
+	err = model.Validate()
+	if err != nil {
+		return xo.W(err)
+	}
+
+	return nil
+}
+
+func (m *Manager) validateDocuments(ctx context.Context, ids []interface{}) error {
+	// find documents
+	iter, err := m.coll.Find(ctx, bson.M{
+		"_id": bson.M{
+			"$in": ids,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// ensure close
+	defer iter.Close()
+
+	// validate documents
+	for iter.Next() {
+		// decode document
+		var raw bson.Raw
+		err = iter.Decode(&raw)
+		if err != nil {
+			return err
+		}
+
+		// decode model
+		model := m.meta.Make()
+		err = m.decodeRaw(ctx, raw, model)
+		if err != nil {
+			return err
+		}
+
+		// validate model
+		err = model.Validate()
+		if err != nil {
+			return xo.W(err)
+		}
+	}
+
+	// check error
+	err = iter.Error()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func applicableUpdate(update bsonkit.Doc) bool {
+	// check operators
+	for _, op := range *update {
+		// check support
+		if mongokit.FieldUpdateOperators[op.Key] == nil {
+			return false
+		}
+
+		// check push modifiers e.g. "$each"
+		if op.Key == "$push" {
+			fields, _ := op.Value.(bson.D)
+			for _, field := range fields {
+				value, ok := field.Value.(bson.D)
+				if ok && len(value) > 0 && strings.HasPrefix(value[0].Key, "$") {
+					return false
+				}
+			}
+		}
+	}
+
+	return true
+}
+
 // ManagedIterator wraps an iterator to enforce decoding to a model.
 type ManagedIterator struct {
-	meta     *Meta
+	manager  *Manager
 	iterator *Iterator
 	validate bool
 }
@@ -1310,12 +1875,18 @@ func (i *ManagedIterator) Next() bool {
 // Decode will decode the loaded document to the specified model.
 func (i *ManagedIterator) Decode(model Model) error {
 	// check model
-	if GetMeta(model) != i.meta {
+	if GetMeta(model) != i.manager.meta {
 		return ErrMetaMismatch.Wrap()
 	}
 
 	// decode
-	err := i.iterator.Decode(model)
+	err := i.manager.decodeIterator(i.iterator.ctx, i.iterator, model)
+	if err != nil {
+		return err
+	}
+
+	// decrypt
+	err = i.manager.decrypt(model)
 	if err != nil {
 		return err
 	}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"testing"
 
+	"github.com/256dpi/lungo/bsonkit"
+	"github.com/256dpi/xo"
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
 )
@@ -239,6 +241,58 @@ func TestManagerFindAll(t *testing.T) {
 	})
 }
 
+func TestManagerNestedFields(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		_, err := tester.Store.C(&nestedModel{}).DeleteMany(nil, bson.M{})
+		assert.NoError(t, err)
+
+		post := New()
+
+		model1 := *tester.Insert(&nestedModel{
+			Address: addressItem{City: "Berlin"},
+			Items: []lineItem{
+				{Name: "a", Post: post},
+			},
+		}).(*nestedModel)
+
+		model2 := *tester.Insert(&nestedModel{
+			Address: addressItem{City: "Zurich"},
+			Billing: &addressItem{City: "Berlin"},
+			Items: []lineItem{
+				{Name: "b"},
+			},
+		}).(*nestedModel)
+
+		m := tester.Store.M(&nestedModel{})
+
+		var list []nestedModel
+		err = m.FindAll(nil, &list, bson.M{
+			"Address.City": "Berlin",
+		}, nil, 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		assert.Equal(t, []nestedModel{model1}, list)
+
+		err = m.FindAll(nil, &list, bson.M{
+			"Items.Post": post,
+		}, nil, 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		assert.Equal(t, []nestedModel{model1}, list)
+
+		err = m.FindAll(nil, &list, nil, []string{"-Address.City"}, 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		assert.Equal(t, []nestedModel{model2, model1}, list)
+
+		found, err := m.Update(nil, &model2, model2.ID(), bson.M{
+			"$set": bson.M{
+				"Items.0.Name": "c",
+			},
+		}, false)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "c", model2.Items[0].Name)
+	})
+}
+
 func TestManagerFindEach(t *testing.T) {
 	withTester(t, func(t *testing.T, tester *Tester) {
 		post1 := *tester.Insert(&postModel{
@@ -507,6 +561,99 @@ func TestManagerDistinct(t *testing.T) {
 	})
 }
 
+func TestManagerAggregate(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		m := tester.Store.M(&postModel{})
+
+		// error
+		var posts []postModel
+		err := m.Aggregate(nil, &posts, nil)
+		assert.Error(t, err)
+		assert.True(t, ErrTransactionRequired.Is(err))
+
+		// invalid list
+		err = m.Aggregate(nil, posts, nil, NoTransaction)
+		assert.Error(t, err)
+		assert.Equal(t, "expected slice pointer", err.Error())
+
+		// invalid pipeline
+		err = m.Aggregate(nil, &posts, []bson.M{
+			{"$match": bson.M{"foo": "bar"}},
+		}, NoTransaction)
+		assert.Error(t, err)
+		assert.Equal(t, `unknown field "foo"`, err.Error())
+
+		if tester.Store.Lungo() {
+			return
+		}
+
+		post1 := tester.Insert(&postModel{
+			Title:    "foo",
+			TextBody: "a",
+		}).(*postModel)
+
+		tester.Insert(&postModel{
+			Title:    "bar",
+			TextBody: "b",
+		})
+
+		tester.Insert(&postModel{
+			Title:    "foo",
+			TextBody: "c",
+		})
+
+		tester.Insert(&commentModel{
+			Message: "msg",
+			Post:    post1.ID(),
+		})
+
+		// models
+		err = m.Aggregate(nil, &posts, []bson.M{
+			{"$match": bson.M{"Title": "foo"}},
+			{"$sort": bson.M{"TextBody": -1}},
+		}, NoTransaction)
+		assert.NoError(t, err)
+		assert.Len(t, posts, 2)
+		assert.Equal(t, "c", posts[0].TextBody)
+		assert.Equal(t, "a", posts[1].TextBody)
+
+		// group
+		var groups []struct {
+			Title string `bson:"_id"`
+			Count int    `bson:"count"`
+		}
+		err = m.Aggregate(nil, &groups, []bson.M{
+			{"$group": bson.M{"_id": "$Title", "count": bson.M{"$sum": 1}}},
+			{"$sort": bson.M{"_id": 1}},
+		}, NoTransaction)
+		assert.NoError(t, err)
+		assert.Len(t, groups, 2)
+		assert.Equal(t, "bar", groups[0].Title)
+		assert.Equal(t, 1, groups[0].Count)
+		assert.Equal(t, "foo", groups[1].Title)
+		assert.Equal(t, 2, groups[1].Count)
+
+		// lookup
+		var results []struct {
+			Title    string         `bson:"title"`
+			Comments []commentModel `bson:"comments"`
+		}
+		err = m.Aggregate(nil, &results, []bson.M{
+			{"$match": bson.M{"_id": post1.ID()}},
+			{"$lookup": bson.M{
+				"from":         &commentModel{},
+				"localField":   "_id",
+				"foreignField": "Post",
+				"as":           "comments",
+			}},
+		}, NoTransaction)
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Len(t, results[0].Comments, 1)
+		assert.Equal(t, "msg", results[0].Comments[0].Message)
+	})
+}
+
 func TestManagerInsert(t *testing.T) {
 	withTester(t, func(t *testing.T, tester *Tester) {
 		m := tester.Store.M(&postModel{})
@@ -978,6 +1125,215 @@ func TestManagerUpsert(t *testing.T) {
 	})
 }
 
+type validatedModel struct {
+	Base  `json:"-" bson:",inline" coal:"validated"`
+	Title string
+	Count int
+	Tags  []string
+}
+
+func (m *validatedModel) Validate() error {
+	if m.Title == "" {
+		return xo.F("missing title")
+	} else if m.Count > 2 {
+		return xo.F("count too high")
+	} else if len(m.Tags) > 2 {
+		return xo.F("too many tags")
+	}
+
+	return nil
+}
+
+type upgradedModel struct {
+	Base    `json:"-" bson:",inline" coal:"upgraded"`
+	Title   string
+	Count   int
+	Version int `coal:"fire-schema-version"`
+}
+
+func (m *upgradedModel) Validate() error {
+	if m.Title == "" {
+		return xo.F("missing title")
+	}
+
+	return nil
+}
+
+func init() {
+	RegisterUpgrades(&upgradedModel{}, false, func(doc bson.M) error {
+		doc["title"] = doc["name"]
+		delete(doc, "name")
+		return nil
+	})
+}
+
+func TestManagerUpdateValidation(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		tester = NewTester(tester.Store, &validatedModel{}, &upgradedModel{})
+		m := tester.Store.M(&validatedModel{})
+
+		model := tester.Insert(&validatedModel{
+			Title: "foo",
+		}).(*validatedModel)
+
+		// missing transaction
+		found, err := m.Update(nil, nil, model.ID(), bson.M{
+			"$set": bson.M{
+				"Title": "",
+			},
+		}, false, Validation)
+		assert.Error(t, err)
+		assert.True(t, ErrTransactionRequired.Is(err))
+		assert.False(t, found)
+
+		_ = tester.Store.T(nil, false, func(ctx context.Context) error {
+			// invalid update
+			found, err := m.Update(ctx, nil, model.ID(), bson.M{
+				"$set": bson.M{
+					"Title": "",
+				},
+			}, true)
+			assert.Error(t, err)
+			assert.Equal(t, "missing title", err.Error())
+			assert.False(t, found)
+
+			// valid update
+			found, err = m.Update(ctx, nil, model.ID(), bson.M{
+				"$inc": bson.M{
+					"Count": 2,
+				},
+			}, false, Validation)
+			assert.NoError(t, err)
+			assert.True(t, found)
+
+			// invalid update first
+			found, err = m.UpdateFirst(ctx, nil, bson.M{
+				"Title": "foo",
+			}, bson.M{
+				"$inc": bson.M{
+					"Count": 1,
+				},
+			}, nil, true)
+			assert.Error(t, err)
+			assert.Equal(t, "count too high", err.Error())
+			assert.False(t, found)
+
+			// invalid update all
+			n, err := m.UpdateAll(ctx, bson.M{}, bson.M{
+				"$unset": bson.M{
+					"Title": "",
+				},
+			}, false, Validation)
+			assert.Error(t, err)
+			assert.Equal(t, "missing title", err.Error())
+			assert.Zero(t, n)
+
+			// invalid upsert
+			inserted, err := m.Upsert(ctx, nil, bson.M{
+				"Title": "bar",
+			}, bson.M{
+				"$set": bson.M{
+					"Count": 3,
+				},
+			}, nil, false, Validation)
+			assert.Error(t, err)
+			assert.Equal(t, "count too high", err.Error())
+			assert.False(t, inserted)
+
+			return nil
+		})
+
+		assert.Equal(t, "foo", tester.Fetch(&validatedModel{}, model.ID()).(*validatedModel).Title)
+		assert.Equal(t, 1, tester.Count(&validatedModel{}))
+
+		// unvalidated update
+		found, err = m.Update(nil, nil, model.ID(), bson.M{
+			"$inc": bson.M{
+				"Count": 1,
+			},
+		}, false)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, 1, tester.Count(&validatedModel{}, bson.M{
+			"Count": 3,
+		}))
+
+		// unsupported operators (not available on lungo)
+		if !tester.Store.Lungo() {
+			err = tester.Store.T(nil, false, func(ctx context.Context) error {
+				found, err := m.Update(ctx, nil, model.ID(), bson.M{
+					"$addToSet": bson.M{
+						"Tags": bson.M{"$each": bson.A{"a", "b"}},
+					},
+				}, true)
+				assert.NoError(t, err)
+				assert.True(t, found)
+				return err
+			})
+			assert.NoError(t, err)
+
+			err = tester.Store.T(nil, false, func(ctx context.Context) error {
+				_, err := m.UpdateAll(ctx, bson.M{}, bson.M{
+					"$push": bson.M{
+						"Tags": bson.M{"$each": bson.A{"c"}},
+					},
+				}, false, Validation)
+				return err
+			})
+			assert.Error(t, err)
+			assert.Equal(t, "too many tags", err.Error())
+
+			err = tester.Store.T(nil, false, func(ctx context.Context) error {
+				_, err := m.Update(ctx, nil, model.ID(), bson.M{
+					"$pull": bson.M{
+						"Tags": "a",
+					},
+				}, true)
+				return err
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"b"}, tester.Fetch(&validatedModel{}, model.ID()).(*validatedModel).Tags)
+		}
+
+		// upgraded document
+		id := New()
+		_, err = tester.Store.C(&upgradedModel{}).InsertOne(nil, bson.M{
+			"_id":  id,
+			"name": "foo",
+		})
+		assert.NoError(t, err)
+
+		_ = tester.Store.T(nil, false, func(ctx context.Context) error {
+			found, err := tester.Store.M(&upgradedModel{}).Update(ctx, nil, id, bson.M{
+				"$inc": bson.M{
+					"Count": 1,
+				},
+			}, true)
+			assert.NoError(t, err)
+			assert.True(t, found)
+			return nil
+		})
+	})
+}
+
+func TestApplicableUpdate(t *testing.T) {
+	for _, item := range []struct {
+		update bson.M
+		result bool
+	}{
+		{bson.M{"$set": bson.M{"a": 1}}, true},
+		{bson.M{"$push": bson.M{"a": 1}}, true},
+		{bson.M{"$push": bson.M{"a": bson.M{"b": 1}}}, true},
+		{bson.M{"$push": bson.M{"a": bson.M{"$each": bson.A{1}}}}, false},
+		{bson.M{"$addToSet": bson.M{"a": 1}}, false},
+		{bson.M{"$pull": bson.M{"a": 1}}, false},
+	} {
+		doc, err := bsonkit.Transform(item.update)
+		assert.NoError(t, err)
+		assert.Equal(t, item.result, applicableUpdate(doc), item.update)
+	}
+}
+
 func TestManagerDelete(t *testing.T) {
 	withTester(t, func(t *testing.T, tester *Tester) {
 		post := *tester.Insert(&postModel{
@@ -6,6 +6,8 @@ import (
 	"strings"
 	"sync"
 
+	"go.mongodb.org/mongo-driver/bson"
+
 	"github.com/256dpi/fire/stick"
 )
 
@@ -13,6 +15,7 @@ var metaMutex sync.Mutex
 var metaCache = map[reflect.Type]*Meta{}
 
 var baseType = reflect.TypeOf(Base{})
+var intType = reflect.TypeOf(0)
 var toOneType = reflect.TypeOf(ID{})
 var optToOneType = reflect.TypeOf(&ID{})
 var toManyType = reflect.TypeOf([]ID{})
@@ -21,6 +24,8 @@ var hasManyType = reflect.TypeOf(HasMany{})
 var toOneRefType = reflect.TypeOf(Ref{})
 var optToOneRefType = reflect.TypeOf(&Ref{})
 var toManyRefType = reflect.TypeOf([]Ref{})
+var bsonMarshalerType = reflect.TypeOf((*bson.Marshaler)(nil)).Elem()
+var bsonValueMarshalerType = reflect.TypeOf((*bson.ValueMarshaler)(nil)).Elem()
 
 // The HasOne type denotes a has-one relationship in a model declaration.
 //
@@ -53,6 +58,10 @@ type Field struct {
 	// The custom flags.
 	Flags []string
 
+	// The nested fields of a struct, struct pointer or struct slice field. The
+	// name and keys of nested fields are dotted paths e.g. "Address.City".
+	Nested []*Field
+
 	// Whether the field is a pointer and thus optional.
 	Optional bool
 
@@ -104,6 +113,13 @@ type Meta struct {
 	// The flagged fields.
 	FlaggedFields map[string][]*Field
 
+	// The nested fields keyed by their dotted name, BSON key and JSON key.
+	// Nested fields must not be relationships, references to other models
+	// are stored as plain ID attributes.
+	NestedFields         map[string]*Field
+	NestedDatabaseFields map[string]*Field
+	NestedAttributes     map[string]*Field
+
 	// The accessor.
 	Accessor *stick.Accessor
 }
@@ -128,14 +144,17 @@ func GetMeta(model Model) *Meta {
 
 	// create new meta
 	meta = &Meta{
-		Type:           modelType,
-		Name:           modelType.String(),
-		Fields:         make(map[string]*Field),
-		DatabaseFields: make(map[string]*Field),
-		Attributes:     make(map[string]*Field),
-		Relationships:  make(map[string]*Field),
-		FlaggedFields:  make(map[string][]*Field),
-		Accessor:       stick.BuildAccessor(model, "Base"),
+		Type:                 modelType,
+		Name:                 modelType.String(),
+		Fields:               make(map[string]*Field),
+		DatabaseFields:       make(map[string]*Field),
+		Attributes:           make(map[string]*Field),
+		Relationships:        make(map[string]*Field),
+		FlaggedFields:        make(map[string][]*Field),
+		NestedFields:         make(map[string]*Field),
+		NestedDatabaseFields: make(map[string]*Field),
+		NestedAttributes:     make(map[string]*Field),
+		Accessor:             stick.BuildAccessor(model, "Base"),
 	}
 
 	// iterate through all fields
@@ -183,219 +202,382 @@ func GetMeta(model Model) *Meta {
 			continue
 		}
 
-		// parse individual tags
-		coalTags := strings.Split(coalTag, ",")
-		if len(coalTag) == 0 {
-			coalTags = nil
-		}
+		// parse field
+		metaField := parseField(field, i)
 
-		// get field type
-		fieldKind := field.Type.Kind()
-		if fieldKind == reflect.Ptr {
-			fieldKind = field.Type.Elem().Kind()
+		// parse nested fields
+		if !strings.Contains(field.Tag.Get("bson"), "inline") {
+			parseNested(meta, metaField, false, map[reflect.Type]bool{})
 		}
 
-		// prepare field
-		metaField := &Field{
-			Index:    i,
-			Name:     field.Name,
-			Type:     field.Type,
-			Kind:     fieldKind,
-			JSONKey:  stick.JSON.GetKey(field),
-			BSONKey:  stick.BSON.GetKey(field),
-			Optional: field.Type.Kind() == reflect.Ptr,
+		// add field
+		meta.Fields[metaField.Name] = metaField
+		meta.OrderedFields = append(meta.OrderedFields, metaField)
+
+		// add db fields
+		if metaField.BSONKey != "" {
+			// check existence
+			if meta.DatabaseFields[metaField.BSONKey] != nil {
+				panic(fmt.Sprintf(`coal: duplicate BSON key "%s"`, metaField.BSONKey))
+			}
+
+			// add field
+			meta.DatabaseFields[metaField.BSONKey] = metaField
 		}
 
-		// check if field is a valid to-one relationship
-		if field.Type == toOneType || field.Type == optToOneType {
-			if len(coalTags) > 0 && strings.Count(coalTags[0], ":") > 0 {
-				// check tag
-				if strings.Count(coalTags[0], ":") > 1 {
-					panic(`coal: expected to find a tag of the form 'coal:"name:type"' on to-one relationship`)
-				}
+		// add attributes
+		if metaField.JSONKey != "" {
+			// check existence
+			if meta.Attributes[metaField.JSONKey] != nil {
+				panic(fmt.Sprintf(`coal: duplicate JSON key "%s"`, metaField.JSONKey))
+			}
 
-				// parse special to-one relationship tag
-				toOneTag := strings.Split(coalTags[0], ":")
+			// add field
+			meta.Attributes[metaField.JSONKey] = metaField
+		}
 
-				// set relationship data
-				metaField.ToOne = true
-				metaField.RelName = toOneTag[0]
-				metaField.RelType = toOneTag[1]
+		// add relationships
+		if metaField.RelName != "" {
+			// check existence
+			if meta.Relationships[metaField.RelName] != nil {
+				panic(fmt.Sprintf(`coal: duplicate relationship "%s"`, metaField.RelName))
+			}
 
-				// remove tag
-				coalTags = coalTags[1:]
+			// add field
+			meta.Relationships[metaField.RelName] = metaField
+		}
+
+		// check encrypted fields
+		if stick.Contains(metaField.Flags, EncryptedFlag) || stick.Contains(metaField.Flags, DeterministicFlag) {
+			if metaField.Type != stringType && metaField.Type != bytesType {
+				panic(fmt.Sprintf(`coal: encrypted field "%s" must be a string or byte slice`, metaField.Name))
+			} else if metaField.BSONKey == "" {
+				panic(fmt.Sprintf(`coal: encrypted field "%s" must not be virtual`, metaField.Name))
 			}
 		}
 
-		// check if field is a valid to-many relationship
-		if field.Type == toManyType {
-			if len(coalTags) > 0 && strings.Count(coalTags[0], ":") > 0 {
-				// check tag
-				if strings.Count(coalTags[0], ":") > 1 {
-					panic(`coal: expected to find a tag of the form 'coal:"name:type"' on to-many relationship`)
-				}
+		// check personal fields
+		if stick.Contains(metaField.Flags, PersonalFlag) && metaField.BSONKey == "" {
+			panic(fmt.Sprintf(`coal: personal field "%s" must not be virtual`, metaField.Name))
+		}
+
+		// check version field
+		if stick.Contains(metaField.Flags, VersionFlag) && metaField.Type != intType {
+			panic(fmt.Sprintf(`coal: version field "%s" must be an int`, metaField.Name))
+		}
 
-				// parse special to-many relationship tag
-				toManyTag := strings.Split(coalTags[0], ":")
+		// add flagged fields
+		for _, flag := range metaField.Flags {
+			// get list
+			list, _ := meta.FlaggedFields[flag]
 
-				// set relationship data
-				metaField.ToMany = true
-				metaField.RelName = toManyTag[0]
-				metaField.RelType = toManyTag[1]
+			// add field
+			list = append(list, metaField)
 
-				// remove tag
-				coalTags = coalTags[1:]
-			}
+			// save list
+			meta.FlaggedFields[flag] = list
 		}
+	}
 
-		// check if field is a valid polymorphic to-one relationship
-		if field.Type == toOneRefType || field.Type == optToOneRefType {
-			if len(coalTags) > 0 && strings.Count(coalTags[0], ":") > 0 {
-				// check tag
-				if strings.Count(coalTags[0], ":") > 1 {
-					panic(`coal: expected to find a tag of the form 'coal:"name:*|type+type..."' on polymorphic to-one relationship`)
-				}
-
-				// parse special to-one relationship tag
-				toOneTag := strings.Split(coalTags[0], ":")
-
-				// set relationship data
-				metaField.ToOne = true
-				metaField.Polymorphic = true
-				metaField.RelName = toOneTag[0]
-				if toOneTag[1] != "*" {
-					metaField.RelTypes = strings.Split(toOneTag[1], "+")
-				}
-
-				// remove tag
-				coalTags = coalTags[1:]
+	// cache meta
+	metaCache[modelType] = meta
+
+	return meta
+}
+
+func parseField(field reflect.StructField, index int) *Field {
+	// get coal tag
+	coalTag := field.Tag.Get("coal")
+
+	// parse individual tags
+	coalTags := strings.Split(coalTag, ",")
+	if len(coalTag) == 0 {
+		coalTags = nil
+	}
+
+	// get field type
+	fieldKind := field.Type.Kind()
+	if fieldKind == reflect.Ptr {
+		fieldKind = field.Type.Elem().Kind()
+	}
+
+	// prepare field
+	metaField := &Field{
+		Index:    index,
+		Name:     field.Name,
+		Type:     field.Type,
+		Kind:     fieldKind,
+		JSONKey:  stick.JSON.GetKey(field),
+		BSONKey:  stick.BSON.GetKey(field),
+		Optional: field.Type.Kind() == reflect.Ptr,
+	}
+
+	// check if field is a valid to-one relationship
+	if field.Type == toOneType || field.Type == optToOneType {
+		if len(coalTags) > 0 && strings.Count(coalTags[0], ":") > 0 {
+			// check tag
+			if strings.Count(coalTags[0], ":") > 1 {
+				panic(`coal: expected to find a tag of the form 'coal:"name:type"' on to-one relationship`)
 			}
+
+			// parse special to-one relationship tag
+			toOneTag := strings.Split(coalTags[0], ":")
+
+			// set relationship data
+			metaField.ToOne = true
+			metaField.RelName = toOneTag[0]
+			metaField.RelType = toOneTag[1]
+
+			// remove tag
+			coalTags = coalTags[1:]
 		}
+	}
 
-		// check if field is a valid polymorphic to-many relationship
-		if field.Type == toManyRefType {
-			if len(coalTags) > 0 && strings.Count(coalTags[0], ":") > 0 {
-				// check tag
-				if strings.Count(coalTags[0], ":") > 1 {
-					panic(`coal: expected to find a tag of the form 'coal:"name:*|type+type..."' on polymorphic to-many relationship`)
-				}
-
-				// parse special to-many relationship tag
-				toManyTag := strings.Split(coalTags[0], ":")
-
-				// set relationship data
-				metaField.ToMany = true
-				metaField.Polymorphic = true
-				metaField.RelName = toManyTag[0]
-				if toManyTag[1] != "*" {
-					metaField.RelTypes = strings.Split(toManyTag[1], "+")
-				}
-
-				// remove tag
-				coalTags = coalTags[1:]
+	// check if field is a valid to-many relationship
+	if field.Type == toManyType {
+		if len(coalTags) > 0 && strings.Count(coalTags[0], ":") > 0 {
+			// check tag
+			if strings.Count(coalTags[0], ":") > 1 {
+				panic(`coal: expected to find a tag of the form 'coal:"name:type"' on to-many relationship`)
 			}
+
+			// parse special to-many relationship tag
+			toManyTag := strings.Split(coalTags[0], ":")
+
+			// set relationship data
+			metaField.ToMany = true
+			metaField.RelName = toManyTag[0]
+			metaField.RelType = toManyTag[1]
+
+			// remove tag
+			coalTags = coalTags[1:]
 		}
+	}
 
-		// check if field is a valid has-one relationship
-		if field.Type == hasOneType {
+	// check if field is a valid polymorphic to-one relationship
+	if field.Type == toOneRefType || field.Type == optToOneRefType {
+		if len(coalTags) > 0 && strings.Count(coalTags[0], ":") > 0 {
 			// check tag
-			if len(coalTags) != 1 || strings.Count(coalTags[0], ":") != 2 {
-				panic(`coal: expected to find a tag of the form 'coal:"name:type:inverse"' on has-one relationship`)
+			if strings.Count(coalTags[0], ":") > 1 {
+				panic(`coal: expected to find a tag of the form 'coal:"name:*|type+type..."' on polymorphic to-one relationship`)
 			}
 
-			// parse special has-one relationship tag
-			hasOneTag := strings.Split(coalTags[0], ":")
+			// parse special to-one relationship tag
+			toOneTag := strings.Split(coalTags[0], ":")
 
 			// set relationship data
-			metaField.HasOne = true
-			metaField.RelName = hasOneTag[0]
-			metaField.RelType = hasOneTag[1]
-			metaField.RelInverse = hasOneTag[2]
+			metaField.ToOne = true
+			metaField.Polymorphic = true
+			metaField.RelName = toOneTag[0]
+			if toOneTag[1] != "*" {
+				metaField.RelTypes = strings.Split(toOneTag[1], "+")
+			}
 
 			// remove tag
 			coalTags = coalTags[1:]
 		}
+	}
 
-		// check if field is a valid has-many relationship
-		if field.Type == hasManyType {
+	// check if field is a valid polymorphic to-many relationship
+	if field.Type == toManyRefType {
+		if len(coalTags) > 0 && strings.Count(coalTags[0], ":") > 0 {
 			// check tag
-			if len(coalTags) != 1 || strings.Count(coalTags[0], ":") != 2 {
-				panic(`coal: expected to find a tag of the form 'coal:"name:type:inverse"' on has-many relationship`)
+			if strings.Count(coalTags[0], ":") > 1 {
+				panic(`coal: expected to find a tag of the form 'coal:"name:*|type+type..."' on polymorphic to-many relationship`)
 			}
 
-			// parse special has-many relationship tag
-			hasManyTag := strings.Split(coalTags[0], ":")
+			// parse special to-many relationship tag
+			toManyTag := strings.Split(coalTags[0], ":")
 
 			// set relationship data
-			metaField.HasMany = true
-			metaField.RelName = hasManyTag[0]
-			metaField.RelType = hasManyTag[1]
-			metaField.RelInverse = hasManyTag[2]
+			metaField.ToMany = true
+			metaField.Polymorphic = true
+			metaField.RelName = toManyTag[0]
+			if toManyTag[1] != "*" {
+				metaField.RelTypes = strings.Split(toManyTag[1], "+")
+			}
 
 			// remove tag
 			coalTags = coalTags[1:]
 		}
+	}
 
-		// save additional tags as flags
-		metaField.Flags = coalTags
-		if metaField.Flags == nil {
-			metaField.Flags = []string{}
+	// check if field is a valid has-one relationship
+	if field.Type == hasOneType {
+		// check tag
+		if len(coalTags) == 0 || strings.Count(coalTags[0], ":") != 2 {
+			panic(`coal: expected to find a tag of the form 'coal:"name:type:inverse"' on has-one relationship`)
 		}
 
-		// add field
-		meta.Fields[metaField.Name] = metaField
-		meta.OrderedFields = append(meta.OrderedFields, metaField)
+		// parse special has-one relationship tag
+		hasOneTag := strings.Split(coalTags[0], ":")
 
-		// add db fields
-		if metaField.BSONKey != "" {
-			// check existence
-			if meta.DatabaseFields[metaField.BSONKey] != nil {
-				panic(fmt.Sprintf(`coal: duplicate BSON key "%s"`, metaField.BSONKey))
+		// set relationship data
+		metaField.HasOne = true
+		metaField.RelName = hasOneTag[0]
+		metaField.RelType = hasOneTag[1]
+		metaField.RelInverse = hasOneTag[2]
+
+		// remove tag
+		coalTags = coalTags[1:]
+	}
+
+	// check if field is a valid has-many relationship
+	if field.Type == hasManyType {
+		// check tag
+		if len(coalTags) == 0 || strings.Count(coalTags[0], ":") != 2 {
+			panic(`coal: expected to find a tag of the form 'coal:"name:type:inverse"' on has-many relationship`)
+		}
+
+		// parse special has-many relationship tag
+		hasManyTag := strings.Split(coalTags[0], ":")
+
+		// set relationship data
+		metaField.HasMany = true
+		metaField.RelName = hasManyTag[0]
+		metaField.RelType = hasManyTag[1]
+		metaField.RelInverse = hasManyTag[2]
+
+		// remove tag
+		coalTags = coalTags[1:]
+	}
+
+	// save additional tags as flags
+	metaField.Flags = coalTags
+	if metaField.Flags == nil {
+		metaField.Flags = []string{}
+	}
+
+	return metaField
+}
+
+func parseNested(meta *Meta, parent *Field, slice bool, stack map[reflect.Type]bool) {
+	// get struct type
+	typ := nestedType(parent)
+	if typ == nil || stack[typ] {
+		return
+	}
+
+	// push type
+	stack[typ] = true
+	defer delete(stack, typ)
+
+	// check slice
+	slice = slice || parent.Type.Kind() == reflect.Slice
+
+	// iterate through all fields
+	for i := 0; i < typ.NumField(); i++ {
+		// get field
+		field := typ.Field(i)
+
+		// skip unexported, embedded and inlined fields
+		if field.PkgPath != "" || field.Anonymous || strings.Contains(field.Tag.Get("bson"), "inline") {
+			continue
+		}
+
+		// parse field
+		nestedField := parseField(field, i)
+
+		// check relationship
+		if nestedField.RelName != "" {
+			panic(fmt.Sprintf(`coal: nested field "%s.%s" must not be a relationship`, parent.Name, nestedField.Name))
+		}
+
+		// check flags
+		for _, flag := range []string{EncryptedFlag, DeterministicFlag, VersionFlag} {
+			if stick.Contains(nestedField.Flags, flag) {
+				panic(fmt.Sprintf(`coal: nested field "%s.%s" must not be flagged as "%s"`, parent.Name, nestedField.Name, flag))
+			}
+		}
+
+		// prefix name and keys
+		nestedField.Name = parent.Name + "." + nestedField.Name
+		if parent.BSONKey == "" || nestedField.BSONKey == "" {
+			nestedField.BSONKey = ""
+		} else {
+			nestedField.BSONKey = parent.BSONKey + "." + nestedField.BSONKey
+		}
+		if parent.JSONKey == "" || nestedField.JSONKey == "" {
+			nestedField.JSONKey = ""
+		} else {
+			nestedField.JSONKey = parent.JSONKey + "." + nestedField.JSONKey
+		}
+
+		// check personal fields
+		if stick.Contains(nestedField.Flags, PersonalFlag) {
+			if nestedField.BSONKey == "" {
+				panic(fmt.Sprintf(`coal: personal field "%s" must not be virtual`, nestedField.Name))
+			} else if slice {
+				panic(fmt.Sprintf(`coal: personal field "%s" must not be nested in a slice`, nestedField.Name))
 			}
 
 			// add field
-			meta.DatabaseFields[metaField.BSONKey] = metaField
+			meta.FlaggedFields[PersonalFlag] = append(meta.FlaggedFields[PersonalFlag], nestedField)
 		}
 
-		// add attributes
-		if metaField.JSONKey != "" {
+		// add field
+		parent.Nested = append(parent.Nested, nestedField)
+		meta.NestedFields[nestedField.Name] = nestedField
+
+		// add db field
+		if nestedField.BSONKey != "" {
 			// check existence
-			if meta.Attributes[metaField.JSONKey] != nil {
-				panic(fmt.Sprintf(`coal: duplicate JSON key "%s"`, metaField.JSONKey))
+			if meta.NestedDatabaseFields[nestedField.BSONKey] != nil {
+				panic(fmt.Sprintf(`coal: duplicate BSON key "%s"`, nestedField.BSONKey))
 			}
 
 			// add field
-			meta.Attributes[metaField.JSONKey] = metaField
+			meta.NestedDatabaseFields[nestedField.BSONKey] = nestedField
 		}
 
-		// add relationships
-		if metaField.RelName != "" {
+		// add attribute
+		if nestedField.JSONKey != "" {
 			// check existence
-			if meta.Relationships[metaField.RelName] != nil {
-				panic(fmt.Sprintf(`coal: duplicate relationship "%s"`, metaField.RelName))
+			if meta.NestedAttributes[nestedField.JSONKey] != nil {
+				panic(fmt.Sprintf(`coal: duplicate JSON key "%s"`, nestedField.JSONKey))
 			}
 
 			// add field
-			meta.Relationships[metaField.RelName] = metaField
+			meta.NestedAttributes[nestedField.JSONKey] = nestedField
 		}
 
-		// add flagged fields
-		for _, flag := range metaField.Flags {
-			// get list
-			list, _ := meta.FlaggedFields[flag]
+		// parse nested fields
+		parseNested(meta, nestedField, slice, stack)
+	}
+}
 
-			// add field
-			list = append(list, metaField)
+func nestedType(field *Field) reflect.Type {
+	// skip relationships
+	if field.RelName != "" {
+		return nil
+	}
 
-			// save list
-			meta.FlaggedFields[flag] = list
-		}
+	// unwrap slices and pointers
+	typ := field.Type
+	if typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
 	}
 
-	// cache meta
-	metaCache[modelType] = meta
+	// check struct
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
 
-	return meta
+	// skip types with custom encodings
+	ptr := reflect.PtrTo(typ)
+	if ptr.Implements(bsonMarshalerType) || ptr.Implements(bsonValueMarshalerType) {
+		return nil
+	}
+
+	// skip models
+	if typ.NumField() > 0 && typ.Field(0).Type == baseType {
+		return nil
+	}
+
+	return typ
 }
 
 // Make returns a pointer to a new zero initialized model e.g. *Post.
@@ -113,6 +113,9 @@ func TestGetMeta(t *testing.T) {
 				post.Fields["TextBody"],
 			},
 		},
+		NestedFields:         map[string]*Field{},
+		NestedDatabaseFields: map[string]*Field{},
+		NestedAttributes:     map[string]*Field{},
 		Accessor: &stick.Accessor{
 			Name: "coal.postModel",
 			Fields: map[string]*stick.Field{
@@ -203,7 +206,10 @@ func TestGetMeta(t *testing.T) {
 			"parent": comment.Fields["Parent"],
 			"post":   comment.Fields["Post"],
 		},
-		FlaggedFields: map[string][]*Field{},
+		FlaggedFields:        map[string][]*Field{},
+		NestedFields:         map[string]*Field{},
+		NestedDatabaseFields: map[string]*Field{},
+		NestedAttributes:     map[string]*Field{},
 		Accessor: &stick.Accessor{
 			Name: "coal.commentModel",
 			Fields: map[string]*stick.Field{
@@ -265,7 +271,10 @@ func TestGetMeta(t *testing.T) {
 		Relationships: map[string]*Field{
 			"posts": selection.Fields["Posts"],
 		},
-		FlaggedFields: map[string][]*Field{},
+		FlaggedFields:        map[string][]*Field{},
+		NestedFields:         map[string]*Field{},
+		NestedDatabaseFields: map[string]*Field{},
+		NestedAttributes:     map[string]*Field{},
 		Accessor: &stick.Accessor{
 			Name: "coal.selectionModel",
 			Fields: map[string]*stick.Field{
@@ -341,7 +350,10 @@ func TestGetMeta(t *testing.T) {
 			"ref2": poly.Fields["Ref2"],
 			"ref3": poly.Fields["Ref3"],
 		},
-		FlaggedFields: map[string][]*Field{},
+		FlaggedFields:        map[string][]*Field{},
+		NestedFields:         map[string]*Field{},
+		NestedDatabaseFields: map[string]*Field{},
+		NestedAttributes:     map[string]*Field{},
 		Accessor: &stick.Accessor{
 			Name: "coal.polyModel",
 			Fields: map[string]*stick.Field{
@@ -494,6 +506,119 @@ func TestGetMetaErrors(t *testing.T) {
 	})
 }
 
+func TestGetMetaNested(t *testing.T) {
+	meta := GetMeta(&nestedModel{})
+
+	var names []string
+	for name := range meta.NestedFields {
+		names = append(names, name)
+	}
+	assert.ElementsMatch(t, []string{
+		"Address.Street",
+		"Address.City",
+		"Billing.Street",
+		"Billing.City",
+		"Items.Name",
+		"Items.Post",
+		"Items.Address",
+		"Items.Address.Street",
+		"Items.Address.City",
+		"Internal.Street",
+		"Internal.City",
+	}, names)
+
+	assert.Equal(t, &Field{
+		Index:   1,
+		Name:    "Address.City",
+		Type:    reflect.TypeOf(""),
+		Kind:    reflect.String,
+		JSONKey: "address.city",
+		BSONKey: "address.city",
+		Flags:   []string{},
+	}, meta.NestedFields["Address.City"])
+
+	assert.Equal(t, &Field{
+		Index:   1,
+		Name:    "Items.Post",
+		Type:    toOneType,
+		Kind:    reflect.Array,
+		JSONKey: "items.post",
+		BSONKey: "items.post_id",
+		Flags:   []string{},
+	}, meta.NestedFields["Items.Post"])
+
+	assert.Equal(t, []*Field{
+		meta.NestedFields["Items.Name"],
+		meta.NestedFields["Items.Post"],
+		meta.NestedFields["Items.Address"],
+	}, meta.Fields["Items"].Nested)
+
+	assert.Equal(t, meta.NestedFields["Billing.City"], meta.NestedDatabaseFields["billing_address.city"])
+	assert.Equal(t, meta.NestedFields["Billing.City"], meta.NestedAttributes["billing.city"])
+	assert.Equal(t, meta.NestedFields["Items.Address.City"], meta.NestedAttributes["items.address.city"])
+	assert.Equal(t, "internal.city", meta.NestedFields["Internal.City"].BSONKey)
+	assert.Empty(t, meta.NestedFields["Internal.City"].JSONKey)
+	assert.Nil(t, meta.NestedAttributes["internal.city"])
+	assert.Empty(t, meta.Fields["Location"].Nested)
+	assert.Empty(t, GetMeta(&fooModel{}).NestedFields)
+
+	assert.PanicsWithValue(t, `coal: nested field "Item.Posts" must not be a relationship`, func() {
+		type item struct {
+			Posts HasMany `coal:"posts:posts:item"`
+		}
+
+		type invalidModel struct {
+			Base `json:"-" bson:",inline" coal:"ms"`
+			Item item
+			stick.NoValidation
+		}
+
+		GetMeta(&invalidModel{})
+	})
+
+	assert.PanicsWithValue(t, `coal: nested field "Item.Post" must not be a relationship`, func() {
+		type item struct {
+			Post ID `coal:"post:posts"`
+		}
+
+		type invalidModel struct {
+			Base `json:"-" bson:",inline" coal:"ms"`
+			Item item
+			stick.NoValidation
+		}
+
+		GetMeta(&invalidModel{})
+	})
+
+	assert.PanicsWithValue(t, `coal: nested field "Item.Secret" must not be flagged as "fire-encrypted"`, func() {
+		type item struct {
+			Secret string `coal:"fire-encrypted"`
+		}
+
+		type invalidModel struct {
+			Base `json:"-" bson:",inline" coal:"ms"`
+			Item item
+			stick.NoValidation
+		}
+
+		GetMeta(&invalidModel{})
+	})
+
+	assert.PanicsWithValue(t, `coal: personal field "Items.Name" must not be nested in a slice`, func() {
+		type item struct {
+			Name string `coal:"fire-personal"`
+		}
+
+		type invalidModel struct {
+			Base  `json:"-" bson:",inline" coal:"ms"`
+			Items []item
+			stick.NoValidation
+		}
+
+		GetMeta(&invalidModel{})
+	})
+}
+
 func TestMetaMake(t *testing.T) {
 	post := GetMeta(&postModel{}).Make()
 	assert.Equal(t, "*coal.postModel", reflect.TypeOf(post).String())
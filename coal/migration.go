@@ -4,12 +4,15 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/256dpi/xo"
 	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
 )
 
 // Migration is a single migration.
@@ -17,6 +20,16 @@ type Migration struct {
 	// The name.
 	Name string
 
+	// The version used to order migrations. Migrations with the same version
+	// are run in the order they have been added.
+	Version int
+
+	// The optional checksum used to detect changes to already applied
+	// migrations, e.g. a hash of the migration code or a manually maintained
+	// revision. Changes are only detected if a checksum has been recorded and
+	// is configured.
+	Checksum string
+
 	// The timeout.
 	//
 	// Default: 5m.
@@ -30,8 +43,65 @@ type Migration struct {
 	Migrator func(ctx context.Context, store *Store) (int64, int64, error)
 }
 
-// Migrator manages multiple migrations.
+// AppliedMigration records a migration that has been applied.
+type AppliedMigration struct {
+	Base `json:"-" bson:",inline" coal:"migrations"`
+
+	// The name of the migration.
+	Name string `json:"name"`
+
+	// The version of the migration.
+	Version int `json:"version"`
+
+	// The checksum of the migration.
+	Checksum string `json:"checksum"`
+
+	// The time the migration has been applied.
+	Applied time.Time `json:"applied"`
+
+	// The number of matched documents.
+	Matched int64 `json:"matched"`
+
+	// The number of modified documents.
+	Modified int64 `json:"modified"`
+}
+
+// Validate will validate the model.
+func (m *AppliedMigration) Validate() error {
+	return stick.Validate(m, func(v *stick.Validator) {
+		v.Value("Name", false, stick.IsNotZero)
+		v.Value("Applied", false, stick.IsNotZero)
+	})
+}
+
+// AddAppliedMigrationIndexes will add applied migration indexes to the
+// provided catalog.
+func AddAppliedMigrationIndexes(catalog *Catalog) {
+	// index and require name to be unique
+	catalog.AddIndex(&AppliedMigration{}, true, 0, "Name")
+}
+
+// Locker is used to ensure that only one instance runs migrations at a time.
+type Locker interface {
+	// Lock should block until the lock has been acquired.
+	Lock(ctx context.Context) error
+
+	// Unlock should release the lock.
+	Unlock(ctx context.Context) error
+}
+
+// Migrator manages multiple migrations. Applied migrations are recorded in the
+// "migrations" collection and skipped on subsequent runs.
 type Migrator struct {
+	// Whether pending migrations should only be logged.
+	DryRun bool
+
+	// The name of the last migration to run.
+	Until string
+
+	// The locker used to coordinate multiple instances.
+	Locker Locker
+
 	migrations []Migration
 }
 
@@ -42,6 +112,18 @@ func NewMigrator() *Migrator {
 
 // Add will add the provided migration.
 func (m *Migrator) Add(migration Migration) {
+	// check name
+	if migration.Name == "" {
+		panic("coal: missing migration name")
+	}
+
+	// check duplicate
+	for _, mig := range m.migrations {
+		if mig.Name == migration.Name {
+			panic(fmt.Sprintf("coal: duplicate migration %q", migration.Name))
+		}
+	}
+
 	// ensure timeout
 	if migration.Timeout == 0 {
 		migration.Timeout = 5 * time.Minute
@@ -51,38 +133,137 @@ func (m *Migrator) Add(migration Migration) {
 	m.migrations = append(m.migrations, migration)
 }
 
-// Run will run all added migrations.
+// Run will run all added migrations that have not yet been applied in the
+// order of their versions.
 func (m *Migrator) Run(store *Store, logger io.Writer, reporter func(error)) error {
+	// acquire lock
+	if m.Locker != nil {
+		err := m.Locker.Lock(context.Background())
+		if err != nil {
+			return err
+		}
+	}
+
+	// prepare unlock
+	unlock := func() error {
+		if m.Locker != nil {
+			return m.Locker.Unlock(context.Background())
+		}
+		return nil
+	}
+
+	// get pending migrations
+	pending, err := m.pending(store)
+	if err != nil {
+		_ = unlock()
+		return err
+	}
+
 	// run synchronous migrations
-	for _, migration := range m.migrations {
-		if !migration.Async {
-			err := m.run(store, logger, &migration)
-			if err != nil {
-				return err
-			}
+	var async []Migration
+	for _, migration := range pending {
+		if migration.Async {
+			async = append(async, migration)
+			continue
+		}
+		err = m.run(store, logger, &migration)
+		if err != nil {
+			_ = unlock()
+			return err
 		}
 	}
 
+	// release lock if there are no asynchronous migrations
+	if len(async) == 0 {
+		return unlock()
+	}
+
 	// run asynchronous migrations
 	go func() {
-		for _, migration := range m.migrations {
-			if migration.Async {
-				err := m.run(store, logger, &migration)
-				if err != nil {
-					if reporter != nil {
-						reporter(err)
-					}
-
-					return
+		for _, migration := range async {
+			err := m.run(store, logger, &migration)
+			if err != nil {
+				if reporter != nil {
+					reporter(err)
 				}
+
+				break
 			}
 		}
+
+		// release lock
+		err := unlock()
+		if err != nil && reporter != nil {
+			reporter(err)
+		}
 	}()
 
 	return nil
 }
 
+func (m *Migrator) pending(store *Store) ([]Migration, error) {
+	// sort migrations
+	list := make([]Migration, len(m.migrations))
+	copy(list, m.migrations)
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+
+	// truncate migrations
+	if m.Until != "" {
+		found := false
+		for i, migration := range list {
+			if migration.Name == m.Until {
+				list = list[:i+1]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, xo.F("unknown migration %q", m.Until)
+		}
+	}
+
+	// find applied migrations
+	var applied []AppliedMigration
+	err := store.M(&AppliedMigration{}).FindAll(nil, &applied, bson.M{}, nil, 0, 0, false, NoTransaction)
+	if err != nil {
+		return nil, err
+	}
+
+	// index applied migrations
+	index := map[string]AppliedMigration{}
+	for _, migration := range applied {
+		index[migration.Name] = migration
+	}
+
+	// collect pending migrations
+	var pending []Migration
+	for _, migration := range list {
+		record, ok := index[migration.Name]
+		if !ok {
+			pending = append(pending, migration)
+			continue
+		}
+
+		// check checksum
+		if record.Checksum != "" && migration.Checksum != "" && record.Checksum != migration.Checksum {
+			return nil, xo.F("checksum mismatch for applied migration %q", migration.Name)
+		}
+	}
+
+	return pending, nil
+}
+
 func (m *Migrator) run(store *Store, logger io.Writer, migration *Migration) error {
+	// handle dry run
+	if m.DryRun {
+		if logger != nil {
+			_, _ = fmt.Fprintf(logger, "pending migration: %s\n", migration.Name)
+		}
+		return nil
+	}
+
 	// create context
 	ctx, cancel := context.WithTimeout(context.Background(), migration.Timeout)
 	defer cancel()
@@ -102,6 +283,19 @@ func (m *Migrator) run(store *Store, logger io.Writer, migration *Migration) err
 		return err
 	}
 
+	// record migration
+	err = store.M(&AppliedMigration{}).Insert(ctx, &AppliedMigration{
+		Name:     migration.Name,
+		Version:  migration.Version,
+		Checksum: migration.Checksum,
+		Applied:  time.Now(),
+		Matched:  matched,
+		Modified: modified,
+	})
+	if err != nil {
+		return err
+	}
+
 	// print result
 	if logger != nil {
 		_, _ = fmt.Fprintf(logger, "completed migration: %d matched, %d modified\n", matched, modified)
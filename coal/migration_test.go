@@ -83,6 +83,124 @@ func TestMigrator(t *testing.T) {
 	})
 }
 
+type testLocker struct {
+	calls []string
+}
+
+func (l *testLocker) Lock(context.Context) error {
+	l.calls = append(l.calls, "lock")
+	return nil
+}
+
+func (l *testLocker) Unlock(context.Context) error {
+	l.calls = append(l.calls, "unlock")
+	return nil
+}
+
+func TestMigratorState(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		var runs []string
+		migration := func(name string, version int) Migration {
+			return Migration{
+				Name:     name,
+				Version:  version,
+				Checksum: strconv.Itoa(version),
+				Migrator: func(ctx context.Context, store *Store) (int64, int64, error) {
+					runs = append(runs, name)
+					return 2, 1, nil
+				},
+			}
+		}
+
+		/* dry run */
+
+		xo.Test(func(xt *xo.Tester) {
+			m := NewMigrator()
+			m.Add(migration("b", 2))
+			m.Add(migration("a", 1))
+			m.DryRun = true
+
+			err := m.Run(tester.Store, xo.Sink("MIGRATOR"), nil)
+			assert.NoError(t, err)
+			assert.Empty(t, runs)
+			assert.Equal(t, 0, tester.Count(&AppliedMigration{}))
+
+			assert.Equal(t, []string{
+				"pending migration: a",
+				"pending migration: b",
+			}, strings.Split(strings.TrimSpace(xt.Sinks["MIGRATOR"].String), "\n"))
+		})
+
+		/* run until */
+
+		locker := &testLocker{}
+
+		m := NewMigrator()
+		m.Add(migration("c", 3))
+		m.Add(migration("b", 2))
+		m.Add(migration("a", 1))
+		m.Until = "b"
+		m.Locker = locker
+
+		err := m.Run(tester.Store, nil, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, runs)
+		assert.Equal(t, []string{"lock", "unlock"}, locker.calls)
+
+		applied := tester.FindLast(&AppliedMigration{}).(*AppliedMigration)
+		assert.Equal(t, "b", applied.Name)
+		assert.Equal(t, 2, applied.Version)
+		assert.NotEmpty(t, applied.Checksum)
+		assert.False(t, applied.Applied.IsZero())
+		assert.Equal(t, int64(2), applied.Matched)
+		assert.Equal(t, int64(1), applied.Modified)
+
+		/* skip applied */
+
+		m.Until = ""
+
+		err = m.Run(tester.Store, nil, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a", "b", "c"}, runs)
+		assert.Equal(t, 3, tester.Count(&AppliedMigration{}))
+
+		/* unknown until */
+
+		m.Until = "d"
+
+		err = m.Run(tester.Store, nil, nil)
+		assert.Error(t, err)
+		assert.Equal(t, `unknown migration "d"`, err.Error())
+
+		/* checksum mismatch */
+
+		m = NewMigrator()
+		m.Add(migration("a", 4))
+
+		err = m.Run(tester.Store, nil, nil)
+		assert.Error(t, err)
+		assert.Equal(t, `checksum mismatch for applied migration "a"`, err.Error())
+		assert.Equal(t, []string{"a", "b", "c"}, runs)
+
+		/* missing checksum */
+
+		m = NewMigrator()
+		mig := migration("a", 4)
+		mig.Checksum = ""
+		m.Add(mig)
+
+		err = m.Run(tester.Store, nil, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a", "b", "c"}, runs)
+
+		/* duplicate */
+
+		assert.PanicsWithValue(t, `coal: duplicate migration "a"`, func() {
+			m.Add(migration("a", 1))
+		})
+	})
+}
+
 func TestProcessEach(t *testing.T) {
 	withTester(t, func(t *testing.T, tester *Tester) {
 		for i := 0; i < 20; i++ {
@@ -0,0 +1,360 @@
+package coal
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+// PersonalFlag is the flag used to mark fields that contain personal data.
+// Flagged fields are included in exports and overwritten with their zero value
+// or removed if optional when a subject is anonymized. Fields of nested structs
+// may be flagged as well unless they are nested in a slice.
+const PersonalFlag = "fire-personal"
+
+const privacyBatchSize = 1000
+
+// Record is a single document tied to a subject.
+type Record struct {
+	// The model.
+	Model Model
+
+	// The values of the personal fields keyed by field name. Nested fields are
+	// keyed by their dotted name e.g. "Address.City".
+	Personal map[string]interface{}
+}
+
+// Privacy manages the personal data of subjects across the models of a
+// catalog. Models are tied to a subject using reference paths that lead from
+// the model to the subject model.
+type Privacy struct {
+	// The store used to find and update the documents.
+	Store *Store
+
+	// The catalog used to resolve the reference paths.
+	Catalog *Catalog
+
+	// The subject model e.g. a user.
+	Subject Model
+
+	// The function called for every personal field after the document has been
+	// anonymized in the same transaction. The model still holds the original
+	// values. It can be used to release linked resources, e.g. using
+	// blaze.Storage.ReleaseAll.
+	Release func(ctx context.Context, model Model, field string) error
+
+	paths map[string]privacyPath
+}
+
+type privacyPath struct {
+	metas  []*Meta
+	fields []string
+}
+
+// NewPrivacy will create and return a new privacy manager for the provided
+// subject model. The subject model itself is added with an empty path.
+func NewPrivacy(store *Store, catalog *Catalog, subject Model) *Privacy {
+	// prepare privacy
+	privacy := &Privacy{
+		Store:   store,
+		Catalog: catalog,
+		Subject: subject,
+		paths:   map[string]privacyPath{},
+	}
+
+	// add subject
+	privacy.Add(subject)
+
+	return privacy
+}
+
+// Add will add the provided model using the specified reference path. The path
+// lists the to-one or to-many relationship fields that lead from the model to
+// the subject, e.g. "Post", "Author" for a comment that belongs to a post that
+// belongs to a user. Intermediate models are resolved using the catalog.
+//
+// Note: This method panics if the path is invalid.
+func (p *Privacy) Add(model Model, path ...string) {
+	// get meta
+	meta := GetMeta(model)
+
+	// check existence
+	if _, ok := p.paths[meta.PluralName]; ok {
+		panic(fmt.Sprintf(`coal: model "%s" has already been added`, meta.PluralName))
+	}
+
+	// check path
+	current := meta
+	metas := []*Meta{meta}
+	for _, name := range path {
+		// get field
+		field := current.Fields[name]
+		if field == nil || (!field.ToOne && !field.ToMany) || field.Polymorphic {
+			panic(fmt.Sprintf(`coal: field "%s" on "%s" is not a to-one or to-many relationship`, name, current.PluralName))
+		}
+
+		// get related model
+		related := p.Catalog.Find(field.RelType)
+		if related == nil {
+			panic(fmt.Sprintf(`coal: missing model "%s" in catalog`, field.RelType))
+		}
+
+		// advance
+		current = GetMeta(related)
+		metas = append(metas, current)
+	}
+
+	// check subject
+	if current != GetMeta(p.Subject) {
+		panic(fmt.Sprintf(`coal: path of "%s" does not lead to "%s"`, meta.PluralName, GetMeta(p.Subject).PluralName))
+	}
+
+	// add path
+	p.paths[meta.PluralName] = privacyPath{
+		metas:  metas,
+		fields: path,
+	}
+}
+
+// Export will collect all documents tied to the specified subject. The records
+// are ordered by model plural name and document id.
+func (p *Privacy) Export(ctx context.Context, subject ID) ([]Record, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Privacy.Export")
+	defer span.End()
+
+	// collect records
+	var records []Record
+	err := p.Store.T(ctx, true, func(ctx context.Context) error {
+		return p.each(ctx, subject, func(meta *Meta, model Model) error {
+			// collect personal values
+			personal := map[string]interface{}{}
+			for _, field := range meta.FlaggedFields[PersonalFlag] {
+				personal[field.Name] = stick.MustGet(model, field.Name)
+			}
+
+			// add record
+			records = append(records, Record{
+				Model:    model,
+				Personal: personal,
+			})
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// Anonymize will overwrite all personal fields of the documents tied to the
+// specified subject with their zero value in a transaction. Optional fields are
+// removed instead and fields nested in missing structs are skipped. The
+// configured release function is called for every personal field afterwards.
+// It returns the number of anonymized documents.
+func (p *Privacy) Anonymize(ctx context.Context, subject ID) (int, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Privacy.Anonymize")
+	defer span.End()
+
+	// anonymize documents
+	var total int
+	err := p.Store.T(ctx, false, func(ctx context.Context) error {
+		total = 0
+		return p.each(ctx, subject, func(meta *Meta, model Model) error {
+			// get fields
+			fields := meta.FlaggedFields[PersonalFlag]
+			if len(fields) == 0 {
+				return nil
+			}
+
+			// prepare update
+			set := bson.M{}
+			unset := bson.M{}
+			var released []string
+			for _, field := range fields {
+				// skip fields nested in missing structs
+				if !personalPresent(meta, model, field) {
+					continue
+				}
+
+				// unset optional or set zero value
+				if field.Optional {
+					unset[field.Name] = ""
+				} else {
+					set[field.Name] = reflect.Zero(field.Type).Interface()
+				}
+
+				// add field
+				released = append(released, field.Name)
+			}
+
+			// prepare update
+			update := bson.M{}
+			if len(set) > 0 {
+				update["$set"] = set
+			}
+			if len(unset) > 0 {
+				update["$unset"] = unset
+			}
+
+			// update document
+			if len(update) > 0 {
+				found, err := p.Store.M(model).Update(ctx, nil, model.ID(), update, false, NoValidation)
+				if err != nil {
+					return err
+				} else if !found {
+					return xo.F("missing document")
+				}
+			}
+
+			// release fields
+			if p.Release != nil {
+				for _, name := range released {
+					err := p.Release(ctx, model, name)
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			// increment
+			total++
+
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+func (p *Privacy) each(ctx context.Context, subject ID, fn func(*Meta, Model) error) error {
+	// get sorted names
+	names := make([]string, 0, len(p.paths))
+	for name := range p.paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// handle models
+	for _, name := range names {
+		// get path
+		path := p.paths[name]
+		meta := path.metas[0]
+
+		// resolve path backwards starting with the subject
+		ids := []ID{subject}
+		for i := len(path.fields) - 1; i > 0 && len(ids) > 0; i-- {
+			// find ids in batches
+			var next []ID
+			for _, batch := range chunkIDs(ids, privacyBatchSize) {
+				list, err := p.Store.M(path.metas[i].Make()).Distinct(ctx, "_id", bson.M{
+					path.fields[i]: bson.M{
+						"$in": batch,
+					},
+				}, false)
+				if err != nil {
+					return err
+				}
+				for _, item := range list {
+					next = append(next, item.(ID))
+				}
+			}
+
+			// set ids
+			ids = Unique(next)
+		}
+
+		// skip if no documents are tied
+		if len(ids) == 0 {
+			continue
+		}
+
+		// prepare filter
+		field := "_id"
+		if len(path.fields) > 0 {
+			field = path.fields[0]
+		}
+
+		// find documents in batches
+		seen := map[ID]bool{}
+		for _, batch := range chunkIDs(ids, privacyBatchSize) {
+			list := meta.MakeSlice()
+			err := p.Store.M(meta.Make()).FindAll(ctx, list, bson.M{
+				field: bson.M{
+					"$in": batch,
+				},
+			}, []string{"_id"}, 0, 0, false)
+			if err != nil {
+				return err
+			}
+
+			// yield models
+			models := reflect.ValueOf(list).Elem()
+			for i := 0; i < models.Len(); i++ {
+				// get model
+				model := models.Index(i).Interface().(Model)
+
+				// skip models matched by a previous batch
+				if seen[model.ID()] {
+					continue
+				}
+				seen[model.ID()] = true
+
+				// yield model
+				err = fn(meta, model)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func personalPresent(meta *Meta, model Model, field *Field) bool {
+	// check optional parents
+	segments := strings.Split(field.Name, ".")
+	for i := 1; i < len(segments); i++ {
+		// get parent
+		name := strings.Join(segments[:i], ".")
+		parent := meta.Fields[name]
+		if parent == nil {
+			parent = meta.NestedFields[name]
+		}
+
+		// check value
+		if parent.Optional && reflect.ValueOf(stick.MustGet(model, name)).IsNil() {
+			return false
+		}
+	}
+
+	return true
+}
+
+func chunkIDs(ids []ID, size int) [][]ID {
+	// split ids
+	var chunks [][]ID
+	for len(ids) > size {
+		chunks = append(chunks, ids[:size])
+		ids = ids[size:]
+	}
+	if len(ids) > 0 {
+		chunks = append(chunks, ids)
+	}
+
+	return chunks
+}
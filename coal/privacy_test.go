@@ -0,0 +1,179 @@
+package coal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+type memberContact struct {
+	City string `json:"city" coal:"fire-personal"`
+	Zip  string `json:"zip"`
+}
+
+type memberModel struct {
+	Base    `json:"-" bson:",inline" coal:"members"`
+	Name    string         `json:"name" coal:"fire-personal"`
+	Email   string         `json:"email" coal:"fire-personal"`
+	Phone   *string        `json:"phone" coal:"fire-personal"`
+	Role    string         `json:"role"`
+	Contact memberContact  `json:"contact"`
+	Backup  *memberContact `json:"backup"`
+}
+
+func (m *memberModel) Validate() error {
+	return nil
+}
+
+type orderModel struct {
+	Base    `json:"-" bson:",inline" coal:"orders"`
+	Address string `json:"address" coal:"fire-personal"`
+	Total   int    `json:"total"`
+	Member  ID     `json:"-" coal:"member:members"`
+}
+
+func (m *orderModel) Validate() error {
+	return nil
+}
+
+type reviewModel struct {
+	Base   `json:"-" bson:",inline" coal:"reviews"`
+	Text   string `json:"text" coal:"fire-personal"`
+	Orders []ID   `json:"-" coal:"orders:orders"`
+}
+
+func (m *reviewModel) Validate() error {
+	return nil
+}
+
+func TestPrivacy(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		for _, model := range []Model{&memberModel{}, &orderModel{}, &reviewModel{}} {
+			_, err := tester.Store.C(model).DeleteMany(nil, bson.M{})
+			assert.NoError(t, err)
+		}
+
+		catalog := NewCatalog(&memberModel{}, &orderModel{}, &reviewModel{})
+
+		privacy := NewPrivacy(tester.Store, catalog, &memberModel{})
+		privacy.Add(&orderModel{}, "Member")
+		privacy.Add(&reviewModel{}, "Orders", "Member")
+
+		phone := "123"
+		member1 := tester.Insert(&memberModel{Name: "Joe", Email: "joe@example.com", Role: "admin"}).ID()
+		member2 := tester.Insert(&memberModel{
+			Name:    "Jane",
+			Email:   "jane@example.com",
+			Phone:   &phone,
+			Contact: memberContact{City: "Zurich", Zip: "8000"},
+		}).ID()
+		order1 := tester.Insert(&orderModel{Address: "Street 1", Total: 10, Member: member1}).ID()
+		order2 := tester.Insert(&orderModel{Address: "Street 2", Total: 20, Member: member2}).ID()
+		review1 := tester.Insert(&reviewModel{Text: "Great", Orders: []ID{order1, order2}}).ID()
+		review2 := tester.Insert(&reviewModel{Text: "Bad", Orders: []ID{order2}}).ID()
+
+		records, err := privacy.Export(nil, member1)
+		assert.NoError(t, err)
+		assert.Len(t, records, 3)
+		assert.Equal(t, member1, records[0].Model.ID())
+		assert.Equal(t, map[string]interface{}{
+			"Name":         "Joe",
+			"Email":        "joe@example.com",
+			"Phone":        (*string)(nil),
+			"Contact.City": "",
+			"Backup.City":  "",
+		}, records[0].Personal)
+		assert.Equal(t, order1, records[1].Model.ID())
+		assert.Equal(t, map[string]interface{}{
+			"Address": "Street 1",
+		}, records[1].Personal)
+		assert.Equal(t, review1, records[2].Model.ID())
+		assert.Equal(t, map[string]interface{}{
+			"Text": "Great",
+		}, records[2].Personal)
+
+		var released []string
+		privacy.Release = func(ctx context.Context, model Model, field string) error {
+			assert.True(t, HasTransaction(ctx))
+			assert.NotZero(t, stick.MustGet(model, field))
+			released = append(released, GetMeta(model).PluralName+"."+field)
+			return nil
+		}
+
+		n, err := privacy.Anonymize(nil, member2)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, n)
+		assert.ElementsMatch(t, []string{
+			"members.Name",
+			"members.Email",
+			"members.Phone",
+			"members.Contact.City",
+			"orders.Address",
+			"reviews.Text",
+			"reviews.Text",
+		}, released)
+
+		assert.Equal(t, &memberModel{
+			Base:  B(member1),
+			Name:  "Joe",
+			Email: "joe@example.com",
+			Role:  "admin",
+		}, tester.Fetch(&memberModel{}, member1))
+		assert.Equal(t, &memberModel{
+			Base:    B(member2),
+			Contact: memberContact{Zip: "8000"},
+		}, tester.Fetch(&memberModel{}, member2))
+
+		var doc bson.M
+		err = tester.Store.C(&memberModel{}).FindOne(nil, bson.M{"_id": member2}).Decode(&doc)
+		assert.NoError(t, err)
+		assert.NotContains(t, doc, "phone")
+		assert.Equal(t, &orderModel{
+			Base:   B(order2),
+			Total:  20,
+			Member: member2,
+		}, tester.Fetch(&orderModel{}, order2))
+		assert.Equal(t, "Street 1", tester.Fetch(&orderModel{}, order1).(*orderModel).Address)
+		assert.Equal(t, "", tester.Fetch(&reviewModel{}, review1).(*reviewModel).Text)
+		assert.Equal(t, "", tester.Fetch(&reviewModel{}, review2).(*reviewModel).Text)
+
+		n, err = privacy.Anonymize(nil, New())
+		assert.NoError(t, err)
+		assert.Equal(t, 0, n)
+	})
+}
+
+func TestPrivacyAdd(t *testing.T) {
+	catalog := NewCatalog(&memberModel{}, &orderModel{})
+	privacy := NewPrivacy(nil, catalog, &memberModel{})
+
+	assert.PanicsWithValue(t, `coal: model "members" has already been added`, func() {
+		privacy.Add(&memberModel{})
+	})
+
+	assert.PanicsWithValue(t, `coal: field "Address" on "orders" is not a to-one or to-many relationship`, func() {
+		privacy.Add(&orderModel{}, "Address")
+	})
+
+	assert.PanicsWithValue(t, `coal: path of "orders" does not lead to "members"`, func() {
+		privacy.Add(&orderModel{})
+	})
+
+	privacy = NewPrivacy(nil, NewCatalog(&memberModel{}), &memberModel{})
+	assert.PanicsWithValue(t, `coal: missing model "orders" in catalog`, func() {
+		privacy.Add(&reviewModel{}, "Orders", "Member")
+	})
+	type virtualModel struct {
+		Base `json:"-" bson:",inline" coal:"virtuals"`
+		Name string `json:"name" bson:"-" coal:"fire-personal"`
+		stick.NoValidation
+	}
+
+	assert.PanicsWithValue(t, `coal: personal field "Name" must not be virtual`, func() {
+		GetMeta(&virtualModel{})
+	})
+}
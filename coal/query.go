@@ -0,0 +1,418 @@
+package coal
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var systemFieldTypes = map[string]reflect.Type{
+	"_id": toOneType,
+	"_lk": reflect.TypeOf(int64(0)),
+}
+
+// Query is a builder for filter documents. Field names and value types are
+// checked against the model when the query is built.
+type Query struct {
+	model Model
+	items []bson.M
+}
+
+// Q will return a new query for the specified model. The query methods will
+// panic if an unknown field or a value of the wrong type is used.
+//
+//	filter := coal.Q(&Post{}).Where("Title").Eq("foo").Where("Published").Eq(true).M()
+//
+func Q(model Model) *Query {
+	return &Query{
+		model: model,
+	}
+}
+
+// Where will return a condition for the specified field. Multiple conditions
+// are combined using an implicit and.
+func (q *Query) Where(field string) *Condition {
+	return &Condition{
+		query: q,
+		field: field,
+		typ:   queryField(q.model, field),
+	}
+}
+
+// And will add a condition that requires all provided queries to match.
+func (q *Query) And(queries ...*Query) *Query {
+	return q.add("$and", queries)
+}
+
+// Or will add a condition that requires at least one of the provided queries
+// to match.
+func (q *Query) Or(queries ...*Query) *Query {
+	return q.add("$or", queries)
+}
+
+// Nor will add a condition that requires none of the provided queries to match.
+func (q *Query) Nor(queries ...*Query) *Query {
+	return q.add("$nor", queries)
+}
+
+// M will compile the query to a filter document.
+func (q *Query) M() bson.M {
+	// handle single and no items
+	if len(q.items) == 0 {
+		return bson.M{}
+	} else if len(q.items) == 1 {
+		return q.items[0]
+	}
+
+	// merge items if possible
+	doc := bson.M{}
+	for _, item := range q.items {
+		for key := range item {
+			if _, ok := doc[key]; ok {
+				return bson.M{"$and": q.items}
+			}
+			doc[key] = item[key]
+		}
+	}
+
+	return doc
+}
+
+func (q *Query) add(operator string, queries []*Query) *Query {
+	// check queries
+	list := make([]bson.M, 0, len(queries))
+	for _, query := range queries {
+		if GetMeta(query.model) != GetMeta(q.model) {
+			panic(fmt.Sprintf(`coal: query for "%s" used with "%s"`, GetMeta(query.model).Name, GetMeta(q.model).Name))
+		}
+		list = append(list, query.M())
+	}
+
+	// add item
+	q.items = append(q.items, bson.M{operator: list})
+
+	return q
+}
+
+// Condition is a single field condition of a query.
+type Condition struct {
+	query *Query
+	field string
+	typ   reflect.Type
+}
+
+// Eq will match documents where the field equals the value. If the field is a
+// slice, the value may also be a single element.
+func (c *Condition) Eq(value interface{}) *Query {
+	c.check(value, true)
+	return c.add(value)
+}
+
+// Ne will match documents where the field does not equal the value.
+func (c *Condition) Ne(value interface{}) *Query {
+	c.check(value, true)
+	return c.add(bson.M{"$ne": value})
+}
+
+// Gt will match documents where the field is greater than the value.
+func (c *Condition) Gt(value interface{}) *Query {
+	c.check(value, false)
+	return c.add(bson.M{"$gt": value})
+}
+
+// Gte will match documents where the field is greater than or equal to the
+// value.
+func (c *Condition) Gte(value interface{}) *Query {
+	c.check(value, false)
+	return c.add(bson.M{"$gte": value})
+}
+
+// Lt will match documents where the field is less than the value.
+func (c *Condition) Lt(value interface{}) *Query {
+	c.check(value, false)
+	return c.add(bson.M{"$lt": value})
+}
+
+// Lte will match documents where the field is less than or equal to the value.
+func (c *Condition) Lte(value interface{}) *Query {
+	c.check(value, false)
+	return c.add(bson.M{"$lte": value})
+}
+
+// In will match documents where the field equals one of the values.
+func (c *Condition) In(values ...interface{}) *Query {
+	for _, value := range values {
+		c.check(value, true)
+	}
+	return c.add(bson.M{"$in": bson.A(values)})
+}
+
+// Nin will match documents where the field equals none of the values.
+func (c *Condition) Nin(values ...interface{}) *Query {
+	for _, value := range values {
+		c.check(value, true)
+	}
+	return c.add(bson.M{"$nin": bson.A(values)})
+}
+
+// Exists will match documents where the field does or does not exist.
+func (c *Condition) Exists(exists bool) *Query {
+	return c.add(bson.M{"$exists": exists})
+}
+
+// Regex will match documents where the string field matches the pattern.
+func (c *Condition) Regex(pattern, options string) *Query {
+	if derefType(c.typ).Kind() != reflect.String {
+		panic(fmt.Sprintf(`coal: regex used on non-string field "%s"`, c.field))
+	}
+	return c.add(bson.M{"$regex": pattern, "$options": options})
+}
+
+func (c *Condition) add(value interface{}) *Query {
+	c.query.items = append(c.query.items, bson.M{c.field: value})
+	return c.query
+}
+
+func (c *Condition) check(value interface{}, elem bool) {
+	if !checkQueryValue(c.typ, value, elem) {
+		panic(fmt.Sprintf(`coal: invalid value of type %T for field "%s"`, value, c.field))
+	}
+}
+
+// Update is a builder for update documents. Field names and value types are
+// checked against the model when the update is built.
+type Update struct {
+	model Model
+	doc   bson.M
+}
+
+// U will return a new update for the specified model. The update methods will
+// panic if an unknown field or a value of the wrong type is used.
+//
+//	update := coal.U(&Post{}).Set("Title", "foo").Inc("Views", 1).M()
+//
+func U(model Model) *Update {
+	return &Update{
+		model: model,
+		doc:   bson.M{},
+	}
+}
+
+// Set will set the field to the value.
+func (u *Update) Set(field string, value interface{}) *Update {
+	return u.add("$set", field, value, false, false)
+}
+
+// SetOnInsert will set the field to the value if the document is inserted.
+func (u *Update) SetOnInsert(field string, value interface{}) *Update {
+	return u.add("$setOnInsert", field, value, false, false)
+}
+
+// Unset will remove the field.
+func (u *Update) Unset(field string) *Update {
+	queryField(u.model, field)
+	return u.put("$unset", field, "")
+}
+
+// Inc will increment the numeric field by the value.
+func (u *Update) Inc(field string, value interface{}) *Update {
+	return u.add("$inc", field, value, false, true)
+}
+
+// Mul will multiply the numeric field by the value.
+func (u *Update) Mul(field string, value interface{}) *Update {
+	return u.add("$mul", field, value, false, true)
+}
+
+// Max will set the field to the value if the value is greater.
+func (u *Update) Max(field string, value interface{}) *Update {
+	return u.add("$max", field, value, false, false)
+}
+
+// Min will set the field to the value if the value is smaller.
+func (u *Update) Min(field string, value interface{}) *Update {
+	return u.add("$min", field, value, false, false)
+}
+
+// Push will append the value to the slice field.
+func (u *Update) Push(field string, value interface{}) *Update {
+	return u.add("$push", field, value, true, false)
+}
+
+// AddToSet will append the values to the slice field if not yet present.
+// Multiple values are added using "$each".
+func (u *Update) AddToSet(field string, values ...interface{}) *Update {
+	return u.addMany("$addToSet", "$each", field, values)
+}
+
+// Pull will remove all occurrences of the values from the slice field.
+// Multiple values are removed using "$in".
+func (u *Update) Pull(field string, values ...interface{}) *Update {
+	return u.addMany("$pull", "$in", field, values)
+}
+
+// PullWhere will remove all items from the slice field that match the
+// condition. The condition is not checked and must use the BSON keys of the
+// items, e.g. bson.M{"$gte": 5} or bson.M{"name": "foo"}.
+func (u *Update) PullWhere(field string, condition bson.M) *Update {
+	// check slice
+	if derefType(queryField(u.model, field)).Kind() != reflect.Slice {
+		panic(fmt.Sprintf(`coal: $pull used on non-slice field "%s"`, field))
+	}
+
+	return u.put("$pull", field, condition)
+}
+
+// M will compile the update to an update document.
+func (u *Update) M() bson.M {
+	return u.doc
+}
+
+func (u *Update) add(operator, field string, value interface{}, elem, numeric bool) *Update {
+	// check value
+	u.check(operator, field, value, elem, numeric)
+
+	return u.put(operator, field, value)
+}
+
+func (u *Update) check(operator, field string, value interface{}, elem, numeric bool) {
+	// get type
+	typ := queryField(u.model, field)
+
+	// check slice
+	if elem {
+		if derefType(typ).Kind() != reflect.Slice {
+			panic(fmt.Sprintf(`coal: %s used on non-slice field "%s"`, operator, field))
+		}
+		typ = derefType(typ).Elem()
+	}
+
+	// check numeric
+	if numeric && !isNumeric(derefType(typ)) {
+		panic(fmt.Sprintf(`coal: %s used on non-numeric field "%s"`, operator, field))
+	}
+
+	// check value
+	if !checkQueryValue(typ, value, false) {
+		panic(fmt.Sprintf(`coal: invalid value of type %T for field "%s"`, value, field))
+	}
+}
+
+func (u *Update) addMany(operator, modifier, field string, values []interface{}) *Update {
+	// check values
+	if len(values) == 0 {
+		panic(fmt.Sprintf(`coal: %s used without values for field "%s"`, operator, field))
+	}
+
+	// add single value
+	if len(values) == 1 {
+		return u.add(operator, field, values[0], true, false)
+	}
+
+	// check values
+	for _, value := range values {
+		u.check(operator, field, value, true, false)
+	}
+
+	return u.put(operator, field, bson.M{modifier: bson.A(values)})
+}
+
+func (u *Update) put(operator, field string, value interface{}) *Update {
+	// get operator document
+	doc, ok := u.doc[operator].(bson.M)
+	if !ok {
+		doc = bson.M{}
+		u.doc[operator] = doc
+	}
+
+	// check field
+	if _, ok := doc[field]; ok {
+		panic(fmt.Sprintf(`coal: duplicate %s for field "%s"`, operator, field))
+	}
+
+	// set value
+	doc[field] = value
+
+	return u
+}
+
+// S will check the specified sort fields and return them. Fields may be
+// prefixed with "-" for descending order.
+func S(model Model, fields ...string) []string {
+	// check fields
+	for _, field := range fields {
+		queryField(model, strings.TrimPrefix(field, "-"))
+	}
+
+	return fields
+}
+
+func queryField(model Model, field string) reflect.Type {
+	// check system fields
+	if typ, ok := systemFieldTypes[field]; ok {
+		return typ
+	}
+
+	// get field
+	meta := GetMeta(model)
+	f := meta.Fields[field]
+	if f == nil {
+		f = meta.NestedFields[field]
+	}
+	if f == nil {
+		panic(fmt.Sprintf(`coal: field "%s" not found on "%s"`, field, meta.Name))
+	} else if f.BSONKey == "" {
+		panic(fmt.Sprintf(`coal: field "%s" on "%s" is virtual`, field, meta.Name))
+	}
+
+	return f.Type
+}
+
+func checkQueryValue(typ reflect.Type, value interface{}, elem bool) bool {
+	// handle nil
+	if value == nil {
+		switch typ.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+			return true
+		}
+		return false
+	}
+
+	// get value type
+	vt := reflect.TypeOf(value)
+
+	// check type
+	if matchQueryType(vt, typ) || matchQueryType(vt, derefType(typ)) {
+		return true
+	}
+
+	// check element
+	if elem && derefType(typ).Kind() == reflect.Slice {
+		return matchQueryType(vt, derefType(typ).Elem())
+	}
+
+	return false
+}
+
+func matchQueryType(vt, typ reflect.Type) bool {
+	return typ.Kind() == reflect.Interface || vt.AssignableTo(typ) || (isNumeric(vt) && isNumeric(typ))
+}
+
+func derefType(typ reflect.Type) reflect.Type {
+	if typ.Kind() == reflect.Ptr {
+		return typ.Elem()
+	}
+	return typ
+}
+
+func isNumeric(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package coal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestQuery(t *testing.T) {
+	assert.Equal(t, bson.M{}, Q(&postModel{}).M())
+
+	assert.Equal(t, bson.M{
+		"Title":     "foo",
+		"Published": bson.M{"$ne": true},
+	}, Q(&postModel{}).Where("Title").Eq("foo").Where("Published").Ne(true).M())
+
+	assert.Equal(t, bson.M{
+		"$and": []bson.M{
+			{"Title": bson.M{"$gt": "a"}},
+			{"Title": bson.M{"$lt": "z"}},
+		},
+	}, Q(&postModel{}).Where("Title").Gt("a").Where("Title").Lt("z").M())
+
+	id := New()
+	assert.Equal(t, bson.M{
+		"_id": bson.M{"$in": bson.A{id}},
+		"$or": []bson.M{
+			{"Parent": nil},
+			{"Parent": bson.M{"$exists": false}},
+		},
+	}, Q(&commentModel{}).Where("_id").In(id).Or(
+		Q(&commentModel{}).Where("Parent").Eq(nil),
+		Q(&commentModel{}).Where("Parent").Exists(false),
+	).M())
+
+	assert.Equal(t, bson.M{
+		"Posts": id,
+	}, Q(&selectionModel{}).Where("Posts").Eq(id).M())
+
+	assert.Equal(t, bson.M{
+		"Address.City": "Berlin",
+		"Items.Post":   id,
+	}, Q(&nestedModel{}).Where("Address.City").Eq("Berlin").Where("Items.Post").Eq(id).M())
+
+	assert.Equal(t, bson.M{
+		"Title": bson.M{"$regex": "^foo", "$options": "i"},
+	}, Q(&postModel{}).Where("Title").Regex("^foo", "i").M())
+
+	assert.Equal(t, bson.M{
+		"Age": bson.M{"$gte": int64(18)},
+	}, Q(&versionedModel{}).Where("Age").Gte(int64(18)).M())
+
+	assert.PanicsWithValue(t, `coal: field "Foo" not found on "coal.postModel"`, func() {
+		Q(&postModel{}).Where("Foo").Eq("bar")
+	})
+
+	assert.PanicsWithValue(t, `coal: field "Comments" on "coal.postModel" is virtual`, func() {
+		Q(&postModel{}).Where("Comments").Eq("bar")
+	})
+
+	assert.PanicsWithValue(t, `coal: invalid value of type int for field "Title"`, func() {
+		Q(&postModel{}).Where("Title").Eq(42)
+	})
+
+	assert.PanicsWithValue(t, `coal: invalid value of type <nil> for field "Title"`, func() {
+		Q(&postModel{}).Where("Title").Eq(nil)
+	})
+
+	assert.PanicsWithValue(t, `coal: invalid value of type primitive.ObjectID for field "Posts"`, func() {
+		Q(&selectionModel{}).Where("Posts").Gt(id)
+	})
+
+	assert.PanicsWithValue(t, `coal: regex used on non-string field "Published"`, func() {
+		Q(&postModel{}).Where("Published").Regex("foo", "")
+	})
+
+	assert.PanicsWithValue(t, `coal: query for "coal.commentModel" used with "coal.postModel"`, func() {
+		Q(&postModel{}).And(Q(&commentModel{}))
+	})
+}
+
+func TestUpdateBuilder(t *testing.T) {
+	id := New()
+
+	assert.Equal(t, bson.M{
+		"$set": bson.M{
+			"Title": "foo",
+		},
+		"$unset": bson.M{
+			"TextBody": "",
+		},
+	}, U(&postModel{}).Set("Title", "foo").Unset("TextBody").M())
+
+	assert.Equal(t, bson.M{
+		"$inc": bson.M{
+			"Age": 1,
+		},
+		"$max": bson.M{
+			"Version": 2,
+		},
+		"$setOnInsert": bson.M{
+			"First": "foo",
+		},
+	}, U(&versionedModel{}).Inc("Age", 1).Max("Version", 2).SetOnInsert("First", "foo").M())
+
+	assert.Equal(t, bson.M{
+		"$push": bson.M{
+			"Posts": id,
+		},
+	}, U(&selectionModel{}).Push("Posts", id).M())
+
+	assert.Equal(t, bson.M{
+		"$set": bson.M{
+			"Parent": nil,
+		},
+	}, U(&commentModel{}).Set("Parent", nil).M())
+
+	id2 := New()
+	assert.Equal(t, bson.M{
+		"$addToSet": bson.M{
+			"Posts": bson.M{"$each": bson.A{id, id2}},
+		},
+	}, U(&selectionModel{}).AddToSet("Posts", id, id2).M())
+
+	assert.Equal(t, bson.M{
+		"$pull": bson.M{
+			"Posts": id,
+		},
+	}, U(&selectionModel{}).Pull("Posts", id).M())
+
+	assert.Equal(t, bson.M{
+		"$pull": bson.M{
+			"Posts": bson.M{"$in": bson.A{id, id2}},
+		},
+	}, U(&selectionModel{}).Pull("Posts", id, id2).M())
+
+	assert.Equal(t, bson.M{
+		"$pull": bson.M{
+			"Posts": bson.M{"$gte": id},
+		},
+	}, U(&selectionModel{}).PullWhere("Posts", bson.M{"$gte": id}).M())
+
+	assert.PanicsWithValue(t, `coal: $inc used on non-numeric field "Title"`, func() {
+		U(&postModel{}).Inc("Title", 1)
+	})
+
+	assert.PanicsWithValue(t, `coal: $push used on non-slice field "Title"`, func() {
+		U(&postModel{}).Push("Title", "foo")
+	})
+
+	assert.PanicsWithValue(t, `coal: invalid value of type string for field "Posts"`, func() {
+		U(&selectionModel{}).AddToSet("Posts", "foo")
+	})
+
+	assert.PanicsWithValue(t, `coal: invalid value of type string for field "Posts"`, func() {
+		U(&selectionModel{}).AddToSet("Posts", id, "foo")
+	})
+
+	assert.PanicsWithValue(t, `coal: $pull used without values for field "Posts"`, func() {
+		U(&selectionModel{}).Pull("Posts")
+	})
+
+	assert.PanicsWithValue(t, `coal: $pull used on non-slice field "Title"`, func() {
+		U(&postModel{}).PullWhere("Title", bson.M{"$eq": "foo"})
+	})
+
+	assert.PanicsWithValue(t, `coal: duplicate $set for field "Title"`, func() {
+		U(&postModel{}).Set("Title", "foo").Set("Title", "bar")
+	})
+}
+
+func TestSortFields(t *testing.T) {
+	assert.Equal(t, []string{"-Title", "_id"}, S(&postModel{}, "-Title", "_id"))
+
+	assert.PanicsWithValue(t, `coal: field "Foo" not found on "coal.postModel"`, func() {
+		S(&postModel{}, "-Foo")
+	})
+}
+
+func TestQueryManager(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		tester.Insert(&postModel{Title: "a"})
+		tester.Insert(&postModel{Title: "b", Published: true})
+		tester.Insert(&postModel{Title: "c", Published: true})
+
+		var list []postModel
+		err := tester.Store.M(&postModel{}).FindAll(nil, &list, Q(&postModel{}).Where("Published").Eq(true).Or(
+			Q(&postModel{}).Where("Title").Eq("b"),
+			Q(&postModel{}).Where("Title").Gt("b"),
+		).M(), S(&postModel{}, "-Title"), 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		assert.Len(t, list, 2)
+		assert.Equal(t, "c", list[0].Title)
+		assert.Equal(t, "b", list[1].Title)
+
+		n, err := tester.Store.M(&postModel{}).UpdateAll(nil, Q(&postModel{}).Where("Title").In("a", "b").M(), U(&postModel{}).Set("TextBody", "foo").M(), false)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+
+		count := tester.Count(&postModel{}, Q(&postModel{}).Where("TextBody").Eq("foo").M())
+		assert.Equal(t, 2, count)
+	})
+}
@@ -7,12 +7,13 @@ import (
 // Reconcile uses a stream to reconcile changes to a collection. It will
 // automatically load existing models once the underlying stream has been opened.
 // After that it will yield all changes to the collection until the returned
-// stream has been closed.
+// stream has been closed. If the stream has been reset, the error is yielded
+// and all existing models are loaded again.
 func Reconcile(store *Store, model Model, loaded func(), created, updated func(Model), deleted func(ID), errored func(error)) *Stream {
 	// prepare load
 	load := func() error {
 		// get cursor
-		iter, err := store.C(model).Find(nil, bson.M{})
+		iter, err := store.M(model).FindEach(nil, bson.M{}, nil, 0, 0, false, NoTransaction, NoValidation)
 		if err != nil {
 			return err
 		}
@@ -52,6 +53,13 @@ func Reconcile(store *Store, model Model, loaded func(), created, updated func(M
 		// handle events
 		switch event {
 		case Opened:
+			return load()
+		case Reset:
+			// call callback if available
+			if errored != nil {
+				errored(err)
+			}
+
 			return load()
 		case Created:
 			// call callback if available
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 func TestReconcile(t *testing.T) {
@@ -48,3 +49,32 @@ func TestReconcile(t *testing.T) {
 		stream.Close()
 	})
 }
+
+func TestReconcileInvalid(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		_, err := tester.Store.C(&validatedModel{}).DeleteMany(nil, bson.M{})
+		assert.NoError(t, err)
+
+		id := New()
+		_, err = tester.Store.C(&validatedModel{}).InsertOne(nil, bson.M{
+			"_id": id,
+		})
+		assert.NoError(t, err)
+
+		var created []ID
+		done := make(chan struct{})
+		stream := Reconcile(tester.Store, &validatedModel{}, func() {
+			close(done)
+		}, func(model Model) {
+			created = append(created, model.ID())
+		}, nil, nil, func(err error) {
+			panic(err)
+		})
+
+		<-done
+
+		assert.Equal(t, []ID{id}, created)
+
+		stream.Close()
+	})
+}
@@ -0,0 +1,318 @@
+package coal
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/256dpi/fire/stick"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+var marshalerType = reflect.TypeOf((*bson.Marshaler)(nil)).Elem()
+var valueMarshalerType = reflect.TypeOf((*bsoncodec.ValueMarshaler)(nil)).Elem()
+
+// Schema will generate a MongoDB "$jsonSchema" document for the provided model.
+// The schema is derived from the BSON keys and Go types of the model and nested
+// fields as described by the meta. Pointer and slice fields also accept null.
+// Apart from the document id no fields are required, as documents may be
+// stored with older schema versions and missing fields decode to their zero
+// value. Length constraints declared using stick.IsMinLen and stick.IsMaxLen
+// in the model validation are added as "minLength"/"maxLength" for strings and
+// "minItems"/"maxItems" for slices. Encrypted fields are always expected to be
+// stored as strings or, if empty, binary values. Further constraints may be
+// added to the returned document as needed.
+func Schema(model Model) bson.M {
+	// get meta
+	meta := GetMeta(model)
+
+	// describe validation
+	constraints := stick.Describe(meta.Make())
+
+	// prepare properties
+	properties := bson.M{
+		"_id": bson.M{"bsonType": "objectId"},
+		"_lk": bson.M{"bsonType": []string{"int", "long"}},
+		"_tk": bson.M{"bsonType": "objectId"},
+	}
+
+	// add fields
+	for _, field := range meta.OrderedFields {
+		// merge inline fields
+		if strings.Contains(meta.Type.Field(field.Index).Tag.Get("bson"), ",inline") {
+			for key, schema := range typeSchema(field.Type)["properties"].(bson.M) {
+				properties[key] = schema
+			}
+			continue
+		}
+
+		// add field
+		if field.BSONKey != "" {
+			properties[field.BSONKey] = fieldSchema(field, constraints)
+		}
+	}
+
+	// adjust encrypted fields
+	for _, field := range encryptedFields(meta) {
+		if field.Type == bytesType {
+			properties[field.BSONKey] = bson.M{"bsonType": []string{"string", "binData", "null"}}
+		} else {
+			properties[field.BSONKey] = bson.M{"bsonType": "string"}
+		}
+	}
+
+	return bson.M{
+		"bsonType":   "object",
+		"required":   []string{"_id"},
+		"properties": properties,
+	}
+}
+
+func fieldSchema(field *Field, constraints map[string][]stick.Constraint) bson.M {
+	// handle plain fields
+	if len(field.Nested) == 0 {
+		schema := typeSchema(field.Type)
+		applyConstraints(field.Type, schema, constraints[field.Name])
+		return schema
+	}
+
+	// prepare properties
+	properties := bson.M{}
+	for _, nested := range field.Nested {
+		if nested.BSONKey != "" {
+			properties[nested.BSONKey[strings.LastIndex(nested.BSONKey, ".")+1:]] = fieldSchema(nested, constraints)
+		}
+	}
+
+	// prepare schema
+	schema := bson.M{
+		"bsonType":   "object",
+		"properties": properties,
+	}
+
+	// wrap schema
+	switch field.Type.Kind() {
+	case reflect.Ptr:
+		return nullable(schema)
+	case reflect.Slice:
+		if field.Type.Elem().Kind() == reflect.Ptr {
+			schema = nullable(schema)
+		}
+		return bson.M{"bsonType": []string{"array", "null"}, "items": schema}
+	default:
+		return schema
+	}
+}
+
+func applyConstraints(typ reflect.Type, schema bson.M, constraints []stick.Constraint) {
+	// unwrap pointer
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	// skip binary data
+	if typ == bytesType {
+		return
+	}
+
+	// apply constraints
+	for _, constraint := range constraints {
+		// get name and value
+		var name string
+		value := constraint.Value
+		switch typ.Kind() {
+		case reflect.String:
+			name = map[string]string{"minLen": "minLength", "maxLen": "maxLength"}[constraint.Name]
+
+			// stick measures bytes while the schema counts characters, a
+			// string of n bytes has at least n/4 characters
+			if name == "minLength" {
+				value = (value.(int) + 3) / 4
+			}
+		case reflect.Slice, reflect.Array:
+			name = map[string]string{"minLen": "minItems", "maxLen": "maxItems"}[constraint.Name]
+		}
+
+		// set constraint
+		if name != "" {
+			schema[name] = value
+		}
+	}
+}
+
+func structSchema(typ reflect.Type) bson.M {
+	// prepare schema
+	properties := bson.M{}
+
+	// add fields
+	addStructFields(typ, properties)
+
+	return bson.M{
+		"bsonType":   "object",
+		"properties": properties,
+	}
+}
+
+func addStructFields(typ reflect.Type, properties bson.M) {
+	// check fields
+	for i := 0; i < typ.NumField(); i++ {
+		// get field
+		field := typ.Field(i)
+
+		// skip unexported fields
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		// get key
+		key := stick.BSON.GetKey(field)
+		if key == "" {
+			continue
+		}
+
+		// add inline fields
+		if strings.Contains(field.Tag.Get("bson"), ",inline") && field.Type.Kind() == reflect.Struct {
+			addStructFields(field.Type, properties)
+			continue
+		}
+
+		// skip other unexported fields
+		if field.PkgPath != "" {
+			continue
+		}
+
+		// set schema
+		properties[key] = typeSchema(field.Type)
+	}
+}
+
+func typeSchema(typ reflect.Type) bson.M {
+	// handle special types
+	switch typ {
+	case toOneType:
+		return bson.M{"bsonType": "objectId"}
+	case timeType:
+		return bson.M{"bsonType": "date"}
+	case decimalType:
+		return bson.M{"bsonType": "decimal"}
+	case bytesType:
+		return bson.M{"bsonType": []string{"binData", "null"}}
+	case pointType:
+		return geoSchema("Point", "object")
+	case polygonType:
+		return geoSchema("Polygon", []string{"object", "null"})
+	}
+
+	// handle custom marshalers
+	if typ.Implements(marshalerType) || typ.Implements(valueMarshalerType) {
+		return bson.M{}
+	}
+
+	// handle kinds
+	switch typ.Kind() {
+	case reflect.Ptr:
+		return nullable(typeSchema(typ.Elem()))
+	case reflect.String:
+		return bson.M{"bsonType": "string"}
+	case reflect.Bool:
+		return bson.M{"bsonType": "bool"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return bson.M{"bsonType": []string{"int", "long"}}
+	case reflect.Float32, reflect.Float64:
+		return bson.M{"bsonType": "double"}
+	case reflect.Slice:
+		return bson.M{"bsonType": []string{"array", "null"}, "items": typeSchema(typ.Elem())}
+	case reflect.Array:
+		return bson.M{"bsonType": "array", "items": typeSchema(typ.Elem())}
+	case reflect.Map:
+		return bson.M{"bsonType": []string{"object", "null"}}
+	case reflect.Struct:
+		return structSchema(typ)
+	default:
+		return bson.M{}
+	}
+}
+
+func geoSchema(typ string, bsonType interface{}) bson.M {
+	return bson.M{
+		"bsonType": bsonType,
+		"required": []string{"coordinates", "type"},
+		"properties": bson.M{
+			"type":        bson.M{"enum": []string{typ}},
+			"coordinates": bson.M{"bsonType": "array"},
+		},
+	}
+}
+
+func nullable(schema bson.M) bson.M {
+	// add null to type
+	switch typ := schema["bsonType"].(type) {
+	case string:
+		schema["bsonType"] = []string{typ, "null"}
+	case []string:
+		if !stick.Contains(typ, "null") {
+			schema["bsonType"] = append(typ, "null")
+		}
+	}
+
+	return schema
+}
+
+// EnsureSchemas will ensure that all models are validated by the database
+// using a "$jsonSchema" validator generated by Schema. Missing collections are
+// created. The "moderate" validation level is used to allow updates to
+// existing documents that do not yet conform to the schema. The method does nothing if the store is backed by lungo as it does
+// not support document validation.
+func (c *Catalog) EnsureSchemas(store *Store) error {
+	// check lungo
+	if store.Lungo() {
+		return nil
+	}
+
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// get sorted models
+	models := c.Models()
+	sort.Slice(models, func(i, j int) bool {
+		return GetMeta(models[i]).Collection < GetMeta(models[j]).Collection
+	})
+
+	// ensure all schemas
+	for _, model := range models {
+		// get collection
+		coll := GetMeta(model).Collection
+
+		// create collection
+		err := store.DB().RunCommand(ctx, bson.D{
+			{Key: "create", Value: coll},
+		}).Err()
+		var cmdErr mongo.CommandError
+		if err != nil && !(errors.As(err, &cmdErr) && cmdErr.Code == 48) {
+			return xo.W(err)
+		}
+
+		// set validator
+		err = store.DB().RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: coll},
+			{Key: "validator", Value: bson.M{"$jsonSchema": Schema(model)}},
+			{Key: "validationLevel", Value: "moderate"},
+			{Key: "validationAction", Value: "error"},
+		}).Err()
+		if err != nil {
+			return xo.W(err)
+		}
+	}
+
+	return nil
+}
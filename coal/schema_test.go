@@ -0,0 +1,170 @@
+package coal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+type schemaModel struct {
+	Base    `json:"-" bson:",inline" coal:"schemas"`
+	Title   string            `json:"title"`
+	Count   int               `json:"count"`
+	Rate    *float64          `json:"rate"`
+	Tags    []string          `json:"tags"`
+	Data    map[string]string `json:"data" bson:",omitempty"`
+	Amount  Decimal           `json:"amount"`
+	Address struct {
+		Street string  `json:"street"`
+		Zip    *string `json:"zip"`
+	} `json:"address"`
+	Lines []*schemaLine `json:"lines"`
+	Any   interface{}   `json:"any"`
+}
+
+type schemaLine struct {
+	Text string `json:"text"`
+}
+
+func (m *schemaModel) Validate() error {
+	return stick.Validate(m, func(v *stick.Validator) {
+		v.Value("Title", false, stick.IsMinLen(1), stick.IsMaxLen(64))
+		v.Value("Rate", true, stick.IsMinFloat(0))
+		v.Value("Tags", false, stick.IsMaxLen(5))
+		v.NestValue("Address", func() {
+			v.Value("Zip", true, stick.IsMinLen(5), stick.IsMaxLen(10))
+		})
+	})
+}
+
+func TestSchema(t *testing.T) {
+	assert.Equal(t, bson.M{
+		"bsonType": "object",
+		"required": []string{"_id"},
+		"properties": bson.M{
+			"_id": bson.M{"bsonType": "objectId"},
+			"_lk": bson.M{"bsonType": []string{"int", "long"}},
+			"_tk": bson.M{"bsonType": "objectId"},
+			"title": bson.M{
+				"bsonType":  "string",
+				"minLength": 1,
+				"maxLength": 64,
+			},
+			"count": bson.M{"bsonType": []string{"int", "long"}},
+			"rate":  bson.M{"bsonType": []string{"double", "null"}},
+			"tags": bson.M{
+				"bsonType": []string{"array", "null"},
+				"items":    bson.M{"bsonType": "string"},
+				"maxItems": 5,
+			},
+			"data":   bson.M{"bsonType": []string{"object", "null"}},
+			"amount": bson.M{"bsonType": "decimal"},
+			"address": bson.M{
+				"bsonType": "object",
+				"properties": bson.M{
+					"street": bson.M{"bsonType": "string"},
+					"zip": bson.M{
+						"bsonType":  []string{"string", "null"},
+						"minLength": 2,
+						"maxLength": 10,
+					},
+				},
+			},
+			"lines": bson.M{
+				"bsonType": []string{"array", "null"},
+				"items": bson.M{
+					"bsonType": []string{"object", "null"},
+					"properties": bson.M{
+						"text": bson.M{"bsonType": "string"},
+					},
+				},
+			},
+			"any": bson.M{},
+		},
+	}, Schema(&schemaModel{}))
+
+	assert.Equal(t, bson.M{
+		"bsonType": "object",
+		"required": []string{"_id"},
+		"properties": bson.M{
+			"_id": bson.M{"bsonType": "objectId"},
+			"_lk": bson.M{"bsonType": []string{"int", "long"}},
+			"_tk": bson.M{"bsonType": "objectId"},
+			"ref1": bson.M{
+				"bsonType": "object",
+				"properties": bson.M{
+					"coll": bson.M{"bsonType": "string"},
+					"id":   bson.M{"bsonType": "objectId"},
+				},
+			},
+			"ref2": bson.M{
+				"bsonType": []string{"object", "null"},
+				"properties": bson.M{
+					"coll": bson.M{"bsonType": "string"},
+					"id":   bson.M{"bsonType": "objectId"},
+				},
+			},
+			"ref3": bson.M{
+				"bsonType": []string{"array", "null"},
+				"items": bson.M{
+					"bsonType": "object",
+					"properties": bson.M{
+						"coll": bson.M{"bsonType": "string"},
+						"id":   bson.M{"bsonType": "objectId"},
+					},
+				},
+			},
+		},
+	}, Schema(&polyModel{}))
+
+	properties := Schema(&commentModel{})["properties"].(bson.M)
+	assert.Equal(t, bson.M{"bsonType": []string{"objectId", "null"}}, properties["parent"])
+	assert.Equal(t, bson.M{"bsonType": "objectId"}, properties["post_id"])
+
+	properties = Schema(&secretModel{})["properties"].(bson.M)
+	assert.Equal(t, bson.M{"bsonType": "string"}, properties["email"])
+	assert.Equal(t, bson.M{"bsonType": []string{"string", "binData", "null"}}, properties["token"])
+}
+
+func TestCatalogEnsureSchemas(t *testing.T) {
+	catalog := NewCatalog(&schemaModel{}, &postModel{})
+
+	err := catalog.EnsureSchemas(lungoStore)
+	assert.NoError(t, err)
+
+	if mongoStore.Lungo() {
+		return
+	}
+
+	mongoStore.DB().Collection("schemas").Drop(nil)
+	defer mongoStore.DB().Collection("schemas").Drop(nil)
+
+	err = catalog.EnsureSchemas(mongoStore)
+	assert.NoError(t, err)
+
+	_, err = mongoStore.C(&schemaModel{}).InsertOne(nil, &schemaModel{
+		Base:  B(),
+		Title: "foo",
+	})
+	assert.NoError(t, err)
+
+	_, err = mongoStore.DB().Collection("schemas").InsertOne(nil, bson.M{
+		"_id": New(),
+	})
+	assert.NoError(t, err)
+
+	_, err = mongoStore.DB().Collection("schemas").InsertOne(nil, bson.M{
+		"_id":   New(),
+		"title": 42,
+	})
+	assert.Error(t, err)
+
+	_, err = mongoStore.DB().Collection("schemas").InsertOne(nil, bson.M{
+		"_id":   New(),
+		"title": "",
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,367 @@
+package coal
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/256dpi/fire/stick"
+)
+
+// Sample is a single value or event of a series.
+type Sample struct {
+	// The time of the sample.
+	Time time.Time `json:"time"`
+
+	// The value of the sample.
+	Value float64 `json:"value"`
+
+	// Additional event data.
+	Data bson.M `json:"data,omitempty" bson:",omitempty"`
+}
+
+// Bucket stores the samples of a series key within one interval together with
+// pre-aggregated rollups.
+type Bucket struct {
+	Base `json:"-" bson:",inline" coal:"buckets"`
+
+	// The name of the series.
+	Series string `json:"series"`
+
+	// The key within the series.
+	Key string `json:"key"`
+
+	// The start of the interval.
+	Start time.Time `json:"start"`
+
+	// The index of the bucket within the interval. Further buckets are added
+	// to an interval once a bucket has reached the sample limit.
+	Part int `json:"part"`
+
+	// The end of the interval.
+	End time.Time `json:"end"`
+
+	// The time after which the bucket is removed.
+	Expires *time.Time `json:"expires"`
+
+	// The number of samples.
+	Count int64 `json:"count"`
+
+	// The sum of all sample values.
+	Sum float64 `json:"sum"`
+
+	// The smallest sample value.
+	Min float64 `json:"min"`
+
+	// The largest sample value.
+	Max float64 `json:"max"`
+
+	// The samples of the interval. The samples are ordered by insertion and
+	// not loaded by Series.Rollups.
+	Samples []Sample `json:"samples"`
+}
+
+// Validate will validate the model.
+func (b *Bucket) Validate() error {
+	return stick.Validate(b, func(v *stick.Validator) {
+		v.Value("Series", false, stick.IsNotZero)
+		v.Value("Start", false, stick.IsNotZero)
+		v.Value("End", false, stick.IsNotZero)
+	})
+}
+
+// AddBucketIndexes will add bucket indexes to the provided catalog. The TTL
+// index on the expiry field enforces the retention of all series.
+func AddBucketIndexes(catalog *Catalog) {
+	// index and require series, key, start and part to be unique
+	catalog.AddIndex(&Bucket{}, true, 0, "Series", "Key", "Start", "Part")
+
+	// remove expired buckets
+	catalog.AddIndex(&Bucket{}, false, time.Second, "Expires")
+}
+
+// Series appends samples to per-interval buckets to reduce the number of
+// documents stored for event-style data.
+//
+// Note: The indexes should be added using AddBucketIndexes.
+type Series struct {
+	// The store used to persist the buckets.
+	Store *Store
+
+	// The name of the series.
+	Name string
+
+	// The interval covered by one bucket, e.g. time.Hour.
+	Interval time.Duration
+
+	// The duration after the end of a bucket after which it is removed. Zero
+	// keeps the buckets forever.
+	Retention time.Duration
+
+	// The maximum number of samples stored in one bucket. Additional buckets
+	// are created for intervals with more samples to stay well below the
+	// document size limit.
+	//
+	// Default: 1000.
+	Limit int64
+}
+
+// Add will append the provided samples to the buckets of the specified key.
+// Samples without a time are assigned the current time.
+func (s *Series) Add(ctx context.Context, key string, samples ...Sample) error {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Series.Add")
+	defer span.End()
+
+	// check interval
+	if s.Interval <= 0 {
+		return xo.F("invalid interval")
+	}
+
+	// group samples by bucket
+	var starts []time.Time
+	groups := map[time.Time][]Sample{}
+	for _, sample := range samples {
+		// ensure time
+		if sample.Time.IsZero() {
+			sample.Time = time.Now()
+		}
+
+		// truncate to database precision
+		sample.Time = sample.Time.UTC().Truncate(time.Millisecond)
+
+		// add sample
+		start := sample.Time.Truncate(s.Interval)
+		if groups[start] == nil {
+			starts = append(starts, start)
+		}
+		groups[start] = append(groups[start], sample)
+	}
+
+	// get limit
+	limit := s.Limit
+	if limit <= 0 {
+		limit = 1000
+	}
+
+	// get chunk size, lungo does not support the $each modifier and requires
+	// the samples to be appended individually
+	size := int(limit)
+	if s.Store.Lungo() {
+		size = 1
+	}
+
+	// update buckets
+	for _, start := range starts {
+		group := groups[start]
+		for len(group) > 0 {
+			// get chunk
+			n := size
+			if n > len(group) {
+				n = len(group)
+			}
+
+			// append chunk
+			err := s.append(ctx, key, start, group[:n], limit)
+			if err != nil {
+				return err
+			}
+
+			// advance
+			group = group[n:]
+		}
+	}
+
+	return nil
+}
+
+func (s *Series) append(ctx context.Context, key string, start time.Time, samples []Sample, limit int64) error {
+	// compute rollups
+	sum := 0.0
+	min, max := samples[0].Value, samples[0].Value
+	for _, sample := range samples {
+		sum += sample.Value
+		if sample.Value < min {
+			min = sample.Value
+		}
+		if sample.Value > max {
+			max = sample.Value
+		}
+	}
+
+	// prepare insert fields
+	end := start.Add(s.Interval)
+	insert := bson.M{
+		"end": end,
+	}
+	if s.Retention > 0 {
+		insert["expires"] = end.Add(s.Retention)
+	}
+
+	// prepare push
+	var push interface{} = samples[0]
+	if len(samples) > 1 {
+		push = bson.M{
+			"$each": samples,
+		}
+	}
+
+	// prepare update
+	update := bson.M{
+		"$setOnInsert": insert,
+		"$push": bson.M{
+			"samples": push,
+		},
+		"$inc": bson.M{
+			"count": int64(len(samples)),
+			"sum":   sum,
+		},
+		"$min": bson.M{
+			"min": min,
+		},
+		"$max": bson.M{
+			"max": max,
+		},
+	}
+
+	// upsert bucket, retry once if a concurrent upsert inserted the bucket or
+	// filled the last bucket
+	err := s.upsert(ctx, key, start, update, int64(len(samples)), limit)
+	if IsDuplicate(err) && !HasTransaction(ctx) {
+		err = s.upsert(ctx, key, start, update, int64(len(samples)), limit)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Series) upsert(ctx context.Context, key string, start time.Time, update bson.M, n, limit int64) error {
+	// prepare filter
+	filter := bson.M{
+		"series": s.Name,
+		"key":    key,
+		"start":  start,
+	}
+
+	// find last bucket
+	var last Bucket
+	err := s.Store.C(&Bucket{}).FindOne(ctx, filter, options.FindOne().
+		SetSort(bson.M{"part": -1}).
+		SetProjection(bson.M{"part": 1, "count": 1}),
+	).Decode(&last)
+	if err != nil && !IsMissing(err) {
+		return err
+	}
+
+	// use next bucket if the last bucket is full
+	part := last.Part
+	if err == nil && last.Count+n > limit {
+		part++
+	}
+
+	// require space in bucket
+	filter["part"] = part
+	filter["count"] = bson.M{
+		"$lte": limit - n,
+	}
+
+	// upsert bucket
+	_, err = s.Store.C(&Bucket{}).UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Query will return the samples of the specified key that lie within the
+// provided time range, ordered by time. The start is inclusive and the end is
+// exclusive.
+func (s *Series) Query(ctx context.Context, key string, from, to time.Time) ([]Sample, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Series.Query")
+	defer span.End()
+
+	// find buckets
+	buckets, err := s.find(ctx, key, from, to, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// expand buckets
+	var samples []Sample
+	for _, bucket := range buckets {
+		for _, sample := range bucket.Samples {
+			if !sample.Time.Before(from) && sample.Time.Before(to) {
+				samples = append(samples, sample)
+			}
+		}
+	}
+
+	// sort samples
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Time.Before(samples[j].Time)
+	})
+
+	return samples, nil
+}
+
+// Rollups will return the buckets of the specified key that overlap the
+// provided time range, ordered by start and part. Intervals that exceeded the
+// sample limit are covered by multiple buckets. The samples of the buckets are
+// not loaded.
+func (s *Series) Rollups(ctx context.Context, key string, from, to time.Time) ([]Bucket, error) {
+	// trace
+	ctx, span := xo.Trace(ctx, "coal/Series.Rollups")
+	defer span.End()
+
+	return s.find(ctx, key, from, to, bson.M{"samples": 0})
+}
+
+func (s *Series) find(ctx context.Context, key string, from, to time.Time, projection bson.M) ([]Bucket, error) {
+	// check interval
+	if s.Interval <= 0 {
+		return nil, xo.F("invalid interval")
+	}
+
+	// prepare options
+	opts := options.Find().SetSort(bson.D{{Key: "start", Value: 1}, {Key: "part", Value: 1}})
+	if projection != nil {
+		opts.SetProjection(projection)
+	}
+
+	// find buckets
+	iter, err := s.Store.C(&Bucket{}).Find(ctx, bson.M{
+		"series": s.Name,
+		"key":    key,
+		"start": bson.M{
+			"$gte": from.UTC().Truncate(s.Interval),
+			"$lt":  to,
+		},
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// decode buckets
+	var buckets []Bucket
+	err = iter.All(&buckets)
+	if err != nil {
+		return nil, err
+	}
+
+	// convert times
+	for i := range buckets {
+		for j := range buckets[i].Samples {
+			buckets[i].Samples[j].Time = buckets[i].Samples[j].Time.UTC()
+		}
+	}
+
+	return buckets, nil
+}
@@ -0,0 +1,139 @@
+package coal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSeries(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		_, err := tester.Store.C(&Bucket{}).DeleteMany(nil, bson.M{})
+		assert.NoError(t, err)
+
+		series := &Series{
+			Store:     tester.Store,
+			Name:      "temperature",
+			Interval:  time.Hour,
+			Retention: 24 * time.Hour,
+		}
+
+		base := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+		err = series.Add(nil, "room-1",
+			Sample{Time: base.Add(10 * time.Minute), Value: 20},
+			Sample{Time: base.Add(70 * time.Minute), Value: 22},
+			Sample{Time: base.Add(5 * time.Minute), Value: 19, Data: bson.M{"source": "a"}},
+		)
+		assert.NoError(t, err)
+
+		err = series.Add(nil, "room-1", Sample{Time: base.Add(30 * time.Minute), Value: 25})
+		assert.NoError(t, err)
+
+		err = series.Add(nil, "room-2", Sample{Time: base.Add(30 * time.Minute), Value: 5})
+		assert.NoError(t, err)
+
+		assert.Equal(t, 3, tester.Count(&Bucket{}))
+
+		samples, err := series.Query(nil, "room-1", base, base.Add(2*time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, []Sample{
+			{Time: base.Add(5 * time.Minute), Value: 19, Data: bson.M{"source": "a"}},
+			{Time: base.Add(10 * time.Minute), Value: 20},
+			{Time: base.Add(30 * time.Minute), Value: 25},
+			{Time: base.Add(70 * time.Minute), Value: 22},
+		}, samples)
+
+		samples, err = series.Query(nil, "room-1", base.Add(7*time.Minute), base.Add(70*time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, []Sample{
+			{Time: base.Add(10 * time.Minute), Value: 20},
+			{Time: base.Add(30 * time.Minute), Value: 25},
+		}, samples)
+
+		rollups, err := series.Rollups(nil, "room-1", base, base.Add(2*time.Hour))
+		assert.NoError(t, err)
+		assert.Len(t, rollups, 2)
+		assert.Equal(t, base, rollups[0].Start.UTC())
+		assert.Equal(t, base.Add(time.Hour), rollups[0].End.UTC())
+		assert.Equal(t, base.Add(25*time.Hour), rollups[0].Expires.UTC())
+		assert.Equal(t, int64(3), rollups[0].Count)
+		assert.Equal(t, 64.0, rollups[0].Sum)
+		assert.Equal(t, 19.0, rollups[0].Min)
+		assert.Equal(t, 25.0, rollups[0].Max)
+		assert.Nil(t, rollups[0].Samples)
+		assert.Equal(t, int64(1), rollups[1].Count)
+		assert.Equal(t, 22.0, rollups[1].Sum)
+
+		series.Interval = 0
+		err = series.Add(nil, "room-1", Sample{Value: 1})
+		assert.Error(t, err)
+	})
+}
+
+func TestSeriesLimit(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		_, err := tester.Store.C(&Bucket{}).DeleteMany(nil, bson.M{})
+		assert.NoError(t, err)
+
+		series := &Series{
+			Store:    tester.Store,
+			Name:     "clicks",
+			Interval: time.Hour,
+			Limit:    2,
+		}
+
+		base := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+		err = series.Add(nil, "button",
+			Sample{Time: base.Add(1 * time.Minute), Value: 1},
+			Sample{Time: base.Add(2 * time.Minute), Value: 2},
+			Sample{Time: base.Add(3 * time.Minute), Value: 3},
+		)
+		assert.NoError(t, err)
+
+		err = series.Add(nil, "button", Sample{Time: base.Add(4 * time.Minute), Value: 4})
+		assert.NoError(t, err)
+
+		err = series.Add(nil, "button", Sample{Time: base.Add(5 * time.Minute), Value: 5})
+		assert.NoError(t, err)
+
+		rollups, err := series.Rollups(nil, "button", base, base.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Len(t, rollups, 3)
+		for i, rollup := range rollups {
+			assert.Equal(t, i, rollup.Part)
+		}
+		assert.Equal(t, int64(2), rollups[0].Count)
+		assert.Equal(t, int64(2), rollups[1].Count)
+		assert.Equal(t, int64(1), rollups[2].Count)
+		assert.Equal(t, 3.0, rollups[0].Sum)
+		assert.Equal(t, 7.0, rollups[1].Sum)
+		assert.Equal(t, 5.0, rollups[2].Sum)
+
+		samples, err := series.Query(nil, "button", base, base.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Len(t, samples, 5)
+		for i, sample := range samples {
+			assert.Equal(t, float64(i+1), sample.Value)
+		}
+	})
+}
+
+func TestAddBucketIndexes(t *testing.T) {
+	catalog := NewCatalog(&Bucket{})
+	AddBucketIndexes(catalog)
+
+	indexes := catalog.indexes["buckets"]
+	assert.Len(t, indexes, 2)
+	assert.True(t, indexes[0].Unique)
+	assert.Equal(t, bson.D{
+		{Key: "series", Value: int32(1)},
+		{Key: "key", Value: int32(1)},
+		{Key: "start", Value: int32(1)},
+		{Key: "part", Value: int32(1)},
+	}, indexes[0].Compile().Keys)
+	assert.Equal(t, int32(1), *indexes[1].Compile().Options.ExpireAfterSeconds)
+}
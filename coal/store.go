@@ -2,6 +2,7 @@ package coal
 
 import (
 	"context"
+	"errors"
 	"net/url"
 	"strings"
 	"sync"
@@ -12,6 +13,8 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readconcern"
 	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+
+	"github.com/256dpi/fire/stick"
 )
 
 // MustConnect will call Connect and panic on errors.
@@ -109,12 +112,15 @@ func NewStore(client lungo.IClient, defaultDB string, engine *lungo.Engine, repo
 
 // A Store manages the usage of a database client.
 type Store struct {
-	client   lungo.IClient
-	defDB    string
-	engine   *lungo.Engine
-	reporter func(error)
-	colls    sync.Map
-	managers sync.Map
+	client      lungo.IClient
+	defDB       string
+	engine      *lungo.Engine
+	reporter    func(error)
+	encryptor   *Encryptor
+	diagnostics *Diagnostics
+	retry       Retry
+	colls       sync.Map
+	managers    sync.Map
 }
 
 // Client returns the client used by this store.
@@ -122,6 +128,40 @@ func (s *Store) Client() lungo.IClient {
 	return s.client
 }
 
+// Retry configures the retry of transactions that failed with transient
+// errors. Following the MongoDB error label semantics, the whole transaction is
+// retried on "TransientTransactionError" errors while only the commit is retried
+// on "UnknownTransactionCommitResult" errors.
+type Retry struct {
+	// The maximum number of attempts. A value of zero or one disables retries.
+	Attempts int
+
+	// The backoff delays and factor passed to stick.Backoff.
+	MinDelay time.Duration
+	MaxDelay time.Duration
+	Factor   float64
+}
+
+// UseRetry will set the retry configuration used by T. Callbacks may prevent
+// retries of the current transaction using NoRetry.
+func (s *Store) UseRetry(retry Retry) {
+	s.retry = retry
+}
+
+// UseEncryptor will set the encryptor that is used by managers to encrypt and
+// decrypt fields flagged with "fire-encrypted" or "fire-encrypted-deterministic".
+// It should be called before the store is used.
+func (s *Store) UseEncryptor(encryptor *Encryptor) {
+	// set encryptor
+	s.encryptor = encryptor
+
+	// reset managers
+	s.managers.Range(func(key, _ interface{}) bool {
+		s.managers.Delete(key)
+		return true
+	})
+}
+
 // Lungo returns whether the stores uses a lungo instead of a mongo client.
 func (s *Store) Lungo() bool {
 	_, ok := s.client.(*lungo.Client)
@@ -178,6 +218,13 @@ func (s *Store) M(model Model) *Manager {
 		trans: NewTranslator(model),
 	}
 
+	// set encryptor
+	manager.trans.encryptor = s.encryptor
+
+	// set diagnostics
+	manager.diagnostics = s.diagnostics
+	manager.reporter = s.reporter
+
 	// cache collection
 	s.managers.Store(meta, manager)
 
@@ -188,7 +235,9 @@ func (s *Store) M(model Model) *Manager {
 // returns no error the transaction will be committed. If T itself does not
 // return an error the transaction has been committed. The created context must
 // be used with all operations that should be included in the transaction. A
-// read only transaction will always abort the transaction when done.
+// read only transaction will always abort the transaction when done. If
+// enabled using UseRetry, transactions that fail with transient errors are
+// retried and the callback may therefore be called multiple times.
 //
 // A transaction has the effect that the read concern is upgraded to "snapshot"
 // which results in isolated and linearizable reads and writes of the data that
@@ -220,33 +269,71 @@ func (s *Store) T(ctx context.Context, readOnly bool, fn func(tc context.Context
 		SetCausalConsistency(true).
 		SetDefaultReadConcern(readconcern.Snapshot())
 
+	// prepare state
+	state := &transaction{readOnly: readOnly}
+
 	// start transaction
 	return xo.W(s.client.UseSessionWithOptions(ctx, opts, func(sc lungo.ISessionContext) error {
-		// start transaction
-		err := sc.StartTransaction()
-		if err != nil {
-			return xo.W(err)
+		for attempt := 1; ; attempt++ {
+			// run transaction
+			err := s.run(sc, state, readOnly, fn)
+			if err == nil {
+				span.Tag("retries", attempt-1)
+				return nil
+			}
+
+			// check retry
+			if state.noRetry || attempt >= s.retry.Attempts || !hasErrorLabel(err, "TransientTransactionError") {
+				span.Tag("retries", attempt-1)
+				return err
+			}
+
+			// log retry
+			span.Log("retrying transaction after transient error: %s", err.Error())
+
+			// await backoff
+			select {
+			case <-time.After(stick.Backoff(s.retry.MinDelay, s.retry.MaxDelay, s.retry.Factor, attempt-1)):
+			case <-sc.Done():
+				return err
+			}
 		}
+	}))
+}
+
+func (s *Store) run(sc lungo.ISessionContext, state *transaction, readOnly bool, fn func(tc context.Context) error) error {
+	// start transaction
+	err := sc.StartTransaction()
+	if err != nil {
+		return xo.W(err)
+	}
+
+	// call function
+	err = fn(context.WithValue(context.WithValue(sc, hasTransaction, s), transactionState, state))
+	if err != nil {
+		_ = sc.AbortTransaction(sc)
+		return xo.W(err)
+	}
+
+	// abort read only transaction
+	if readOnly {
+		return xo.W(sc.AbortTransaction(sc))
+	}
 
-		// call function
-		err = fn(context.WithValue(sc, hasTransaction, s))
-		if err != nil {
-			_ = sc.AbortTransaction(sc)
+	// commit transaction and retry unknown results
+	for attempt := 1; ; attempt++ {
+		err = sc.CommitTransaction(sc)
+		if err == nil || attempt >= s.retry.Attempts || !hasErrorLabel(err, "UnknownTransactionCommitResult") {
 			return xo.W(err)
 		}
 
-		// abort ort commit transaction
-		if readOnly {
-			err = sc.AbortTransaction(sc)
-		} else {
-			err = sc.CommitTransaction(sc)
-		}
-		if err != nil {
+		// await backoff
+		select {
+		case <-time.After(stick.Backoff(s.retry.MinDelay, s.retry.MaxDelay, s.retry.Factor, attempt-1)):
+		case <-sc.Done():
 			return xo.W(err)
 		}
-
-		return nil
-	}))
+	}
 }
 
 // Close will close the store and its associated client.
@@ -265,9 +352,47 @@ func (s *Store) Close() error {
 	return nil
 }
 
-type contextKey struct{}
+type contextKey int
+
+const (
+	hasTransaction contextKey = iota
+	transactionState
+)
+
+type transaction struct {
+	readOnly bool
+	noRetry  bool
+}
+
+func readOnlyTransaction(ctx context.Context) bool {
+	// get state
+	state, ok := ctx.Value(transactionState).(*transaction)
+
+	return ok && state.readOnly
+}
 
-var hasTransaction = contextKey{}
+// NoRetry will prevent the retry of the transaction carried by the context.
+// It should be called by transaction callbacks before performing side effects
+// that are not idempotent e.g. sending an email.
+func NoRetry(ctx context.Context) {
+	// get state
+	state, ok := ctx.Value(transactionState).(*transaction)
+	if ok {
+		state.noRetry = true
+	}
+}
+
+func hasErrorLabel(err error, label string) bool {
+	// check labels
+	var labeled interface {
+		HasErrorLabel(string) bool
+	}
+	if errors.As(err, &labeled) {
+		return labeled.HasErrorLabel(label)
+	}
+
+	return false
+}
 
 // GetTransaction will return whether the context carries a transaction and the
 // store used to create the transaction.
@@ -4,10 +4,12 @@ import (
 	"context"
 	"io"
 	"testing"
+	"time"
 
 	"github.com/256dpi/xo"
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func TestConnect(t *testing.T) {
@@ -125,3 +127,73 @@ func TestStoreT(t *testing.T) {
 		assert.Equal(t, 2, tester.Count(&postModel{}))
 	})
 }
+
+func TestStoreTRetry(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		transient := mongo.CommandError{
+			Message: "write conflict",
+			Labels:  []string{"TransientTransactionError"},
+		}
+
+		var calls int
+		err := tester.Store.T(nil, false, func(tc context.Context) error {
+			calls++
+			return transient
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+
+		tester.Store.UseRetry(Retry{
+			Attempts: 3,
+			MinDelay: time.Millisecond,
+			MaxDelay: 5 * time.Millisecond,
+		})
+		defer tester.Store.UseRetry(Retry{})
+
+		calls = 0
+		err = tester.Store.T(nil, false, func(tc context.Context) error {
+			calls++
+			if calls < 3 {
+				_, err := tester.Store.C(&postModel{}).InsertOne(tc, &postModel{
+					Base:  B(),
+					Title: "foo",
+				})
+				if err != nil {
+					panic(err)
+				}
+
+				return xo.W(transient)
+			}
+
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+		assert.Equal(t, 0, tester.Count(&postModel{}))
+
+		calls = 0
+		err = tester.Store.T(nil, false, func(tc context.Context) error {
+			calls++
+			return transient
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 3, calls)
+
+		calls = 0
+		err = tester.Store.T(nil, false, func(tc context.Context) error {
+			calls++
+			return io.EOF
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+
+		calls = 0
+		err = tester.Store.T(nil, false, func(tc context.Context) error {
+			calls++
+			NoRetry(tc)
+			return transient
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+	})
+}
@@ -1,8 +1,19 @@
 package coal
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/256dpi/lungo"
+	"github.com/256dpi/lungo/bsonkit"
+	"github.com/256dpi/lungo/mongokit"
 	"github.com/256dpi/xo"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readconcern"
 	"gopkg.in/tomb.v2"
@@ -27,6 +38,13 @@ const (
 	// Resumed is emitted after the stream has been resumed.
 	Resumed Event = "resumed"
 
+	// Reset is emitted instead of resumed if the stream could not be resumed
+	// because the resume token is invalid or its history has been lost. The
+	// stream continues with the current changes and the error that caused the
+	// reset is provided. As changes may have been missed, the receiver should
+	// reconcile its state.
+	Reset Event = "reset"
+
 	// Created is emitted when a document has been created.
 	Created Event = "created"
 
@@ -44,19 +62,55 @@ const (
 	Stopped Event = "stopped"
 )
 
-// Receiver is a callback that receives stream events.
+// Receiver is a callback that receives stream events. Models are decoded like
+// in the manager, which upgrades and decrypts them.
 type Receiver func(event Event, id ID, model Model, err error, token []byte) error
 
+// TokenStore persists the resume token of a stream.
+type TokenStore interface {
+	// Load will return the last saved token or nil if none has been saved.
+	Load(ctx context.Context) ([]byte, error)
+
+	// Save will store the provided token.
+	Save(ctx context.Context, token []byte) error
+}
+
+// StreamOptions defines options for opening a stream.
+type StreamOptions struct {
+	// The token used to resume the stream.
+	Token []byte
+
+	// The store used to load the initial token if none has been provided and
+	// to periodically checkpoint the token.
+	TokenStore TokenStore
+
+	// The interval in which the token is checkpointed.
+	//
+	// Default: 1s.
+	CheckpointInterval time.Duration
+
+	// The pipeline stages applied to the change events by the server. Stores
+	// backed by lungo will only apply "$match" stages on the client side.
+	//
+	// See: MatchOperations, MatchFields.
+	Pipeline []bson.M
+}
+
 // Stream simplifies the handling of change streams to receive changes to
 // documents.
 type Stream struct {
 	store    *Store
 	model    Model
 	token    []byte
+	opts     StreamOptions
 	receiver Receiver
 
-	opened bool
-	tomb   tomb.Tomb
+	opened     bool
+	loaded     bool
+	lost       error
+	checkpoint time.Time
+	saved      []byte
+	tomb       tomb.Tomb
 }
 
 // OpenStream will open a stream and continuously forward events to the specified
@@ -65,14 +119,31 @@ type Stream struct {
 //
 // The stream automatically resumes on errors using an internally stored resume
 // token. Applications that need more control should store the token externally
-// and reopen the stream manually to resume from a specific position.
+// and reopen the stream manually to resume from a specific position. If the
+// stream cannot be resumed from the token, it starts over with the current
+// changes and emits the reset event.
 func OpenStream(store *Store, model Model, token []byte, receiver Receiver) *Stream {
+	return OpenStreamWith(store, model, StreamOptions{Token: token}, receiver)
+}
+
+// OpenStreamWith will open a stream using the provided options and continuously
+// forward events to the specified receiver until the stream is closed. If a
+// token store is configured, the stream will load the initial token from it and
+// checkpoint the token periodically and when stopped.
+func OpenStreamWith(store *Store, model Model, opts StreamOptions, receiver Receiver) *Stream {
+	// set default interval
+	if opts.CheckpointInterval == 0 {
+		opts.CheckpointInterval = time.Second
+	}
+
 	// create stream
 	s := &Stream{
 		store:    store,
 		model:    model,
-		token:    token,
+		token:    opts.Token,
+		opts:     opts,
 		receiver: receiver,
+		loaded:   opts.Token != nil || opts.TokenStore == nil,
 	}
 
 	// open stream
@@ -92,26 +163,92 @@ func (s *Stream) open() error {
 	for {
 		// check if alive
 		if !s.tomb.Alive() {
-			return xo.W(s.receiver(Stopped, Z(), nil, nil, s.token))
+			return s.stop()
 		}
 
 		// tail stream
 		err := s.tail()
 		if ErrStop.Is(err) {
-			return xo.W(s.receiver(Stopped, Z(), nil, nil, s.token))
+			return s.stop()
 		} else if err != nil {
 			err = xo.W(s.receiver(Errored, Z(), nil, err, s.token))
 			if ErrStop.Is(err) {
-				return xo.W(s.receiver(Stopped, Z(), nil, nil, s.token))
+				return s.stop()
 			}
 		}
 	}
 }
 
+func (s *Stream) stop() error {
+	// save final token
+	err := s.save(context.Background(), true)
+	if err != nil {
+		_ = s.receiver(Errored, Z(), nil, err, s.token)
+	}
+
+	return xo.W(s.receiver(Stopped, Z(), nil, nil, s.token))
+}
+
+func (s *Stream) save(ctx context.Context, force bool) error {
+	// check store and token
+	if s.opts.TokenStore == nil || s.token == nil || bytes.Equal(s.token, s.saved) {
+		return nil
+	}
+
+	// check interval
+	if !force && time.Since(s.checkpoint) < s.opts.CheckpointInterval {
+		return nil
+	}
+
+	// save token
+	err := s.opts.TokenStore.Save(ctx, s.token)
+	if err != nil {
+		return err
+	}
+
+	// update state
+	s.checkpoint = time.Now()
+	s.saved = s.token
+
+	return nil
+}
+
 func (s *Stream) tail() error {
 	// prepare context
 	ctx := s.tomb.Context(nil)
 
+	// load token
+	if !s.loaded {
+		token, err := s.opts.TokenStore.Load(ctx)
+		if err != nil {
+			return err
+		}
+		s.token = token
+		s.saved = token
+		s.checkpoint = time.Now()
+		s.loaded = true
+	}
+
+	// prepare pipeline
+	pipeline := s.opts.Pipeline
+	if pipeline == nil {
+		pipeline = []bson.M{}
+	}
+
+	// prepare client side filters
+	var filters []bsonkit.Doc
+	if s.store.Lungo() {
+		for _, stage := range pipeline {
+			if match, ok := stage["$match"]; ok {
+				filter, err := bsonkit.Transform(match)
+				if err != nil {
+					return xo.W(err)
+				}
+				filters = append(filters, filter)
+			}
+		}
+	}
+
 	// prepare opts
 	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
 	if s.token != nil {
@@ -122,7 +259,13 @@ func (s *Stream) tail() error {
 	coll := s.store.DB().Collection(GetMeta(s.model).Collection, options.Collection().SetReadConcern(readconcern.Majority()))
 
 	// open change stream
-	cs, err := coll.Watch(ctx, []bson.M{}, opts)
+	cs, err := coll.Watch(ctx, pipeline, opts)
+	if err != nil && s.token != nil && isHistoryLost(err) {
+		// start over without token
+		s.token = nil
+		s.lost = err
+		cs, err = coll.Watch(ctx, pipeline, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+	}
 	if err != nil {
 		return xo.W(err)
 	}
@@ -131,7 +274,16 @@ func (s *Stream) tail() error {
 	defer cs.Close(ctx)
 
 	// check if stream has been opened before
-	if !s.opened {
+	if s.lost != nil {
+		// signal reset
+		err = s.receiver(Reset, Z(), nil, s.lost, s.token)
+		if err != nil {
+			return xo.W(err)
+		}
+
+		// clear error
+		s.lost = nil
+	} else if !s.opened {
 		// signal opened
 		err = s.receiver(Opened, Z(), nil, nil, s.token)
 		if err != nil {
@@ -149,7 +301,15 @@ func (s *Stream) tail() error {
 	s.opened = true
 
 	// iterate on elements forever
-	for cs.Next(ctx) {
+	for {
+		// get next element
+		ok, err := s.next(ctx, cs)
+		if err != nil {
+			return err
+		} else if !ok {
+			break
+		}
+
 		// decode result
 		var ch change
 		err = cs.Decode(&ch)
@@ -157,6 +317,19 @@ func (s *Stream) tail() error {
 			return xo.W(err)
 		}
 
+		// filter event
+		if len(filters) > 0 {
+			matched, err := matchEvent(cs, filters)
+			if err != nil {
+				return err
+			} else if !matched {
+				// save token
+				s.token = ch.ResumeToken
+
+				continue
+			}
+		}
+
 		// prepare type
 		var event Event
 		switch ch.OperationType {
@@ -185,14 +358,20 @@ func (s *Stream) tail() error {
 				// save token
 				s.token = ch.ResumeToken
 
+				// checkpoint token
+				err = s.save(ctx, false)
+				if err != nil {
+					return err
+				}
+
 				continue
 			}
 
 			// decode document
 			doc = GetMeta(s.model).Make()
-			err = bson.Unmarshal(ch.FullDocument, doc)
+			err = s.store.M(s.model).decodeRaw(ctx, ch.FullDocument, doc)
 			if err != nil {
-				return xo.W(err)
+				return err
 			}
 		}
 
@@ -204,6 +383,21 @@ func (s *Stream) tail() error {
 
 		// save token
 		s.token = ch.ResumeToken
+
+		// checkpoint token
+		err = s.save(ctx, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	// check error
+	err = cs.Err()
+	if err != nil && s.token != nil && isHistoryLost(err) {
+		// start over without token
+		s.token = nil
+		s.lost = err
+		return nil
 	}
 
 	// close stream and check error
@@ -215,6 +409,137 @@ func (s *Stream) tail() error {
 	return nil
 }
 
+func (s *Stream) next(ctx context.Context, cs lungo.IChangeStream) (bool, error) {
+	// wait for the next element if backed by lungo
+	if s.store.Lungo() {
+		return cs.Next(ctx), nil
+	}
+
+	for {
+		// try to get next element
+		if cs.TryNext(ctx) {
+			return true, nil
+		} else if cs.Err() != nil || ctx.Err() != nil {
+			return false, nil
+		}
+
+		// checkpoint the post batch token to keep idle streams resumable
+		token := cs.ResumeToken()
+		if token != nil && !bytes.Equal(token, s.token) {
+			s.token = token
+			err := s.save(ctx, false)
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+}
+
+func isHistoryLost(err error) bool {
+	// check lungo errors
+	if errors.Is(err, lungo.ErrLostOplogPosition) || strings.Contains(err.Error(), "unable to resume change stream") {
+		return true
+	}
+
+	// check mongo errors (InvalidResumeToken, ChangeStreamFatalError and
+	// ChangeStreamHistoryLost)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) {
+		switch cmdErr.Code {
+		case 260, 280, 286:
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchOperations will return a pipeline stage that only passes events of the
+// specified types. Events that invalidate the stream are always passed.
+func MatchOperations(events ...Event) bson.M {
+	// collect operation types
+	types := []string{"drop", "rename", "dropDatabase", "invalidate"}
+	for _, event := range events {
+		switch event {
+		case Created:
+			types = append(types, "insert")
+		case Updated:
+			types = append(types, "update", "replace")
+		case Deleted:
+			types = append(types, "delete")
+		default:
+			panic(fmt.Sprintf(`coal: cannot match event "%s"`, event))
+		}
+	}
+
+	return bson.M{
+		"$match": bson.M{
+			"operationType": bson.M{
+				"$in": types,
+			},
+		},
+	}
+}
+
+// MatchFields will return a pipeline stage that only passes update events that
+// set or unset one of the specified top-level fields. All other events are
+// passed.
+func MatchFields(model Model, fields ...string) bson.M {
+	// prepare conditions
+	conditions := bson.A{
+		bson.M{
+			"operationType": bson.M{
+				"$ne": "update",
+			},
+		},
+	}
+
+	// add fields
+	for _, field := range fields {
+		key := F(model, field)
+		conditions = append(conditions, bson.M{
+			"updateDescription.updatedFields." + key: bson.M{
+				"$exists": true,
+			},
+		}, bson.M{
+			"updateDescription.removedFields": key,
+		})
+	}
+
+	return bson.M{
+		"$match": bson.M{
+			"$or": conditions,
+		},
+	}
+}
+
+func matchEvent(cs lungo.IChangeStream, filters []bsonkit.Doc) (bool, error) {
+	// decode event
+	var event bson.D
+	err := cs.Decode(&event)
+	if err != nil {
+		return false, xo.W(err)
+	}
+
+	// transform event
+	doc, err := bsonkit.Transform(event)
+	if err != nil {
+		return false, xo.W(err)
+	}
+
+	// match filters
+	for _, filter := range filters {
+		matched, err := mongokit.Match(doc, filter)
+		if err != nil {
+			return false, xo.W(err)
+		} else if !matched {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
 type change struct {
 	ResumeToken   bson.Raw `bson:"_id"`
 	OperationType string   `bson:"operationType"`
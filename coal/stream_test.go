@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"io"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func TestStream(t *testing.T) {
@@ -369,40 +371,109 @@ func TestStreamManualResumption(t *testing.T) {
 	})
 }
 
-func TestStreamError(t *testing.T) {
+func TestStreamReset(t *testing.T) {
 	withTester(t, func(t *testing.T, tester *Tester) {
 		time.Sleep(100 * time.Millisecond)
 
-		done := make(chan struct{})
-
-		bytes, err := bson.Marshal(map[string]string{"foo": "bar"})
+		resumeToken, err := bson.Marshal(bson.M{
+			"ts": primitive.Timestamp{T: 1, I: 1},
+		})
 		assert.NoError(t, err)
 
-		i := 1
-		OpenStream(tester.Store, &postModel{}, bytes, func(e Event, id ID, model Model, err error, token []byte) error {
+		open := make(chan struct{})
+		done := make(chan struct{})
+
+		i := 0
+		stream := OpenStream(tester.Store, &postModel{}, resumeToken, func(e Event, id ID, model Model, err error, token []byte) error {
 			i++
 
 			switch i {
 			case 1:
-				assert.Equal(t, Errored, e)
+				assert.Equal(t, Reset, e)
 				assert.Zero(t, id)
 				assert.Nil(t, model)
 				assert.Error(t, err)
+				assert.Nil(t, token)
+
+				close(open)
+			case 2:
+				assert.Equal(t, Created, e)
+				assert.NotZero(t, id)
+				assert.NotNil(t, model)
 				assert.NotNil(t, token)
+
+				return ErrStop.Wrap()
+			case 3:
+				assert.Equal(t, Stopped, e)
+				assert.Zero(t, id)
+				assert.Nil(t, model)
+				assert.NoError(t, err)
+				assert.Nil(t, token)
+
+				close(done)
+			default:
+				panic(e)
+			}
+
+			return nil
+		})
+
+		<-open
+
+		tester.Insert(&postModel{
+			Title: "foo",
+		})
+
+		<-done
+
+		stream.Close()
+	})
+}
+
+func TestStreamError(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		time.Sleep(100 * time.Millisecond)
+
+		open := make(chan struct{})
+		done := make(chan struct{})
+
+		i := 0
+		OpenStreamWith(tester.Store, &postModel{}, StreamOptions{
+			Pipeline: []bson.M{
+				{"$match": bson.M{"$foo": "bar"}},
+			},
+		}, func(e Event, id ID, model Model, err error, token []byte) error {
+			i++
+
+			switch i {
+			case 1:
+				assert.Equal(t, Opened, e)
+				assert.Zero(t, id)
+				assert.Nil(t, model)
+				assert.NoError(t, err)
+				assert.Nil(t, token)
+
+				close(open)
 			case 2:
 				assert.Equal(t, Errored, e)
 				assert.Zero(t, id)
 				assert.Nil(t, model)
 				assert.Error(t, err)
-				assert.NotNil(t, token)
+				assert.Nil(t, token)
+			case 3:
+				assert.Equal(t, Resumed, e)
+				assert.Zero(t, id)
+				assert.Nil(t, model)
+				assert.NoError(t, err)
+				assert.Nil(t, token)
 
 				return ErrStop.Wrap()
-			case 3:
+			case 4:
 				assert.Equal(t, Stopped, e)
 				assert.Zero(t, id)
 				assert.Nil(t, model)
 				assert.NoError(t, err)
-				assert.NotNil(t, token)
+				assert.Nil(t, token)
 
 				close(done)
 			default:
@@ -412,10 +483,15 @@ func TestStreamError(t *testing.T) {
 			return nil
 		})
 
+		<-open
+
+		tester.Insert(&postModel{
+			Title: "foo",
+		})
+
 		<-done
 
 		time.Sleep(100 * time.Millisecond)
-
 	})
 }
 
@@ -482,3 +558,156 @@ func TestStreamInvalidation(t *testing.T) {
 		stream.Close()
 	})
 }
+
+type memoryTokenStore struct {
+	mutex sync.Mutex
+	token []byte
+	saves int
+}
+
+func (s *memoryTokenStore) Load(context.Context) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.token, nil
+}
+
+func (s *memoryTokenStore) Save(_ context.Context, token []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.token = token
+	s.saves++
+	return nil
+}
+
+func TestStreamTokenStore(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		time.Sleep(100 * time.Millisecond)
+
+		store := &memoryTokenStore{}
+
+		open := make(chan struct{})
+		done := make(chan struct{})
+
+		tokens := map[string][]byte{}
+		stream := OpenStreamWith(tester.Store, &postModel{}, StreamOptions{
+			TokenStore:         store,
+			CheckpointInterval: time.Hour,
+		}, func(e Event, id ID, model Model, err error, token []byte) error {
+			switch e {
+			case Opened:
+				assert.Nil(t, token)
+				close(open)
+			case Created:
+				tokens[model.(*postModel).Title] = token
+				if model.(*postModel).Title == "bar" {
+					return ErrStop.Wrap()
+				}
+			case Stopped:
+				close(done)
+			}
+
+			return nil
+		})
+
+		<-open
+
+		tester.Insert(&postModel{
+			Title: "foo",
+		})
+
+		tester.Insert(&postModel{
+			Title: "bar",
+		})
+
+		<-done
+		stream.Close()
+
+		assert.Equal(t, 1, store.saves)
+		assert.Equal(t, tokens["foo"], store.token)
+
+		tester.Insert(&postModel{
+			Title: "baz",
+		})
+
+		open = make(chan struct{})
+		done = make(chan struct{})
+
+		var titles []string
+		stream = OpenStreamWith(tester.Store, &postModel{}, StreamOptions{
+			TokenStore: store,
+		}, func(e Event, id ID, model Model, err error, token []byte) error {
+			switch e {
+			case Opened:
+				assert.Equal(t, tokens["foo"], token)
+				close(open)
+			case Created:
+				titles = append(titles, model.(*postModel).Title)
+				if model.(*postModel).Title == "baz" {
+					return ErrStop.Wrap()
+				}
+			case Stopped:
+				close(done)
+			}
+
+			return nil
+		})
+
+		<-open
+		<-done
+		stream.Close()
+
+		assert.Equal(t, []string{"bar", "baz"}, titles)
+		assert.Equal(t, 2, store.saves)
+		assert.Equal(t, tokens["bar"], store.token)
+	})
+}
+
+func TestStreamPipeline(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		time.Sleep(100 * time.Millisecond)
+
+		open := make(chan struct{})
+		done := make(chan struct{})
+
+		var events []string
+		stream := OpenStreamWith(tester.Store, &postModel{}, StreamOptions{
+			Pipeline: []bson.M{
+				MatchOperations(Updated, Deleted),
+				MatchFields(&postModel{}, "Title"),
+			},
+		}, func(e Event, id ID, model Model, err error, token []byte) error {
+			switch e {
+			case Opened:
+				close(open)
+			case Updated:
+				events = append(events, string(e)+":"+model.(*postModel).Title)
+			case Deleted:
+				events = append(events, string(e))
+				return ErrStop.Wrap()
+			case Stopped:
+				close(done)
+			}
+
+			return nil
+		})
+
+		<-open
+
+		post := tester.Insert(&postModel{
+			Title: "foo",
+		}).(*postModel)
+
+		tester.Update(post, bson.M{"$set": bson.M{"Published": true}})
+		tester.Update(post, bson.M{"$set": bson.M{"Title": "bar"}})
+		tester.Delete(post)
+
+		<-done
+		stream.Close()
+
+		assert.Equal(t, []string{"updated:bar", "deleted"}, events)
+	})
+
+	assert.PanicsWithValue(t, `coal: cannot match event "opened"`, func() {
+		MatchOperations(Opened)
+	})
+}
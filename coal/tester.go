@@ -12,6 +12,8 @@ type Tester struct {
 
 	// The registered models.
 	Models []Model
+
+	fixtures map[string]ID
 }
 
 // NewTester returns a new tester. If no store is provided one will be created.
@@ -160,8 +162,11 @@ func (t *Tester) Delete(model Model) {
 }
 
 // Clean will remove the collections of models that have been registered and
-// reset the header map.
+// forget the loaded fixtures.
 func (t *Tester) Clean() {
+	// reset fixtures
+	t.fixtures = nil
+
 	for _, model := range t.Models {
 		// remove all is faster than dropping the collection
 		_, err := t.Store.M(model).DeleteAll(nil, bson.M{})
@@ -28,7 +28,9 @@ var systemFields = map[string]bool{
 // Translator is capable of translating query, update and sort documents from
 // struct field names to database fields names.
 type Translator struct {
-	meta *Meta
+	meta      *Meta
+	encryptor *Encryptor
+	extra     map[string]bool
 }
 
 // NewTranslator will return a translator for the specified model.
@@ -64,6 +66,14 @@ func (t *Translator) Document(query bson.M) (bson.D, error) {
 		return nil, err
 	}
 
+	// encrypt
+	if len(encryptedFields(t.meta)) > 0 {
+		err = t.encrypt(doc, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return doc, err
 }
 
@@ -82,6 +92,251 @@ func (t *Translator) Sort(fields []string) (bson.D, error) {
 	return doc, nil
 }
 
+// Pipeline will convert the provided aggregation pipeline and translate all
+// field names and field references in the "$match", "$sort", "$project",
+// "$group", "$lookup", "$unwind" and "$addFields" stages. Fields added by
+// "$lookup" and "$addFields" stages may be referenced by following stages.
+// Stages that follow a "$group", "$project" or any other stage that changes the
+// shape of the documents are not translated and must use database field names.
+//
+// The "from" field of a "$lookup" stage may be set to a model to also
+// translate the "foreignField" field using that model.
+func (t *Translator) Pipeline(pipeline []bson.M) (bson.A, error) {
+	// prepare translator
+	sub := &Translator{
+		meta:      t.meta,
+		encryptor: t.encryptor,
+		extra:     map[string]bool{},
+	}
+
+	// translate stages
+	out := make(bson.A, 0, len(pipeline))
+	translate := true
+	for _, stage := range pipeline {
+		// check stage
+		if len(stage) != 1 {
+			return nil, xo.F("invalid pipeline stage")
+		}
+
+		// get operator and value
+		var op string
+		var value interface{}
+		for key, val := range stage {
+			op, value = key, val
+		}
+
+		// check operator
+		if unsafeOperators[op] {
+			return nil, xo.F("unsafe operator %q", op)
+		}
+
+		// pass through stage if shape changed
+		if !translate {
+			doc, err := sub.convert(stage)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, doc)
+			continue
+		}
+
+		// translate stage
+		translated, err := sub.stage(op, value)
+		if err != nil {
+			return nil, err
+		}
+
+		// add stage
+		out = append(out, bson.D{{Key: op, Value: translated}})
+
+		// check shape
+		switch op {
+		case "$match", "$sort", "$lookup", "$unwind", "$addFields", "$set", "$limit", "$skip", "$sample":
+		default:
+			translate = false
+		}
+	}
+
+	return out, nil
+}
+
+func (t *Translator) stage(op string, value interface{}) (interface{}, error) {
+	// handle lookup
+	if op == "$lookup" {
+		return t.lookup(value)
+	}
+
+	// convert value
+	doc, err := t.convert(bson.M{"v": value})
+	if err != nil {
+		return nil, err
+	}
+	converted := doc[0].Value
+
+	// translate stage
+	switch op {
+	case "$match":
+		// translate filter
+		match, ok := converted.(bson.D)
+		if !ok {
+			return nil, xo.F("invalid $match stage")
+		}
+		err = t.value(match, false)
+		if err != nil {
+			return nil, err
+		}
+
+		// encrypt filter
+		if len(encryptedFields(t.meta)) > 0 {
+			err = t.encrypt(match, true)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return match, nil
+	case "$sort":
+		// translate keys
+		sort, ok := converted.(bson.D)
+		if !ok {
+			return nil, xo.F("invalid $sort stage")
+		}
+		for i := range sort {
+			err = t.field(&sort[i].Key)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return sort, nil
+	case "$project", "$addFields", "$set":
+		// translate keys and references
+		fields, ok := converted.(bson.D)
+		if !ok {
+			return nil, xo.F("invalid %s stage", op)
+		}
+		for i := range fields {
+			if op == "$project" {
+				err = t.field(&fields[i].Key)
+				if err != nil {
+					return nil, err
+				}
+			}
+			fields[i].Value, err = t.references(fields[i].Value)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// add fields
+		if op != "$project" {
+			for _, field := range fields {
+				t.extra[field.Key] = true
+			}
+		}
+
+		return fields, nil
+	case "$group", "$unwind":
+		// translate references
+		return t.references(converted)
+	default:
+		return converted, nil
+	}
+}
+
+func (t *Translator) lookup(value interface{}) (interface{}, error) {
+	// get lookup
+	lookup, ok := value.(bson.M)
+	if !ok {
+		return nil, xo.F("invalid $lookup stage")
+	}
+
+	// copy lookup
+	out := bson.M{}
+	for key, value := range lookup {
+		out[key] = value
+	}
+
+	// translate local field
+	if local, ok := out["localField"].(string); ok {
+		err := t.field(&local)
+		if err != nil {
+			return nil, err
+		}
+		out["localField"] = local
+	}
+
+	// translate foreign field if model is available
+	if model, ok := out["from"].(Model); ok {
+		out["from"] = GetMeta(model).Collection
+		if foreign, ok := out["foreignField"].(string); ok {
+			err := NewTranslator(model).field(&foreign)
+			if err != nil {
+				return nil, err
+			}
+			out["foreignField"] = foreign
+		}
+	}
+
+	// add field
+	if as, ok := out["as"].(string); ok {
+		t.extra[as] = true
+	}
+
+	return t.convert(out)
+}
+
+func (t *Translator) references(value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case string:
+		// check reference
+		if !strings.HasPrefix(value, "$") || strings.HasPrefix(value, "$$") {
+			return value, nil
+		}
+
+		// translate nested field
+		nested := value[1:]
+		if strings.Contains(nested, ".") && t.nested(&nested) == nil {
+			return "$" + nested, nil
+		}
+
+		// translate root field
+		path := strings.SplitN(value[1:], ".", 2)
+		err := t.field(&path[0])
+		if err != nil {
+			return nil, err
+		}
+
+		return "$" + strings.Join(path, "."), nil
+	case bson.D:
+		for i := range value {
+			// check operator
+			if unsafeOperators[value[i].Key] {
+				return nil, xo.F("unsafe operator %q", value[i].Key)
+			}
+
+			// translate value
+			var err error
+			value[i].Value, err = t.references(value[i].Value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return value, nil
+	case bson.A:
+		for i := range value {
+			var err error
+			value[i], err = t.references(value[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+		return value, nil
+	default:
+		return value, nil
+	}
+}
+
 func (t *Translator) value(value interface{}, skipTranslation bool) error {
 	// translate document
 	if doc, ok := value.(bson.D); ok {
@@ -135,11 +390,21 @@ func (t *Translator) field(field *string) error {
 		return nil
 	}
 
+	// check if extra
+	if t.extra[strings.Split(*field, ".")[0]] {
+		return nil
+	}
+
 	// check if system
 	if systemFields[*field] {
 		return nil
 	}
 
+	// check nested
+	if strings.Contains(*field, ".") {
+		return t.nested(field)
+	}
+
 	// check meta
 	structField := t.meta.Fields[*field]
 	if structField == nil {
@@ -154,6 +419,58 @@ func (t *Translator) field(field *string) error {
 	return nil
 }
 
+func (t *Translator) nested(field *string) error {
+	// split path and collect field segments, array indexes and positional
+	// operators are kept as is
+	segments := strings.Split(*field, ".")
+	names := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		if !isArrayIndex(segment) {
+			names = append(names, segment)
+		}
+	}
+	path := strings.Join(names, ".")
+
+	// check if known
+	nestedField := t.meta.NestedDatabaseFields[path]
+	if nestedField == nil {
+		// check meta
+		nestedField = t.meta.NestedFields[path]
+		if nestedField == nil {
+			return xo.F("unknown field %q", *field)
+		} else if nestedField.BSONKey == "" {
+			return xo.F("virtual field %q", *field)
+		}
+	}
+
+	// replace field segments
+	keys := strings.Split(nestedField.BSONKey, ".")
+	for i := range segments {
+		if !isArrayIndex(segments[i]) {
+			segments[i], keys = keys[0], keys[1:]
+		}
+	}
+	*field = strings.Join(segments, ".")
+
+	return nil
+}
+
+func isArrayIndex(segment string) bool {
+	// check positional operators
+	if segment == "$" || strings.HasPrefix(segment, "$[") {
+		return true
+	}
+
+	// check number
+	for _, r := range segment {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return segment != ""
+}
+
 func (t *Translator) convert(in bson.M) (bson.D, error) {
 	// attempt fast conversion
 	doc, err := bsonkit.Convert(in)
@@ -202,6 +202,85 @@ func TestTranslatorDocument(t *testing.T) {
 	assert.Equal(t, `unknown field "Title.foo"`, err.Error())
 }
 
+func TestTranslatorNested(t *testing.T) {
+	trans := NewTranslator(&nestedModel{})
+	post := New()
+
+	// filter
+	doc, err := trans.Document(bson.M{
+		"Address.City":         "Berlin",
+		"billing_address.city": "Paris",
+		"Items.Post":           post,
+		"Items.0.Address.City": bson.M{"$ne": "Rome"},
+	})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, bson.D{
+		{Key: "address.city", Value: "Berlin"},
+		{Key: "billing_address.city", Value: "Paris"},
+		{Key: "items.post_id", Value: post},
+		{Key: "items.0.address.city", Value: bson.D{{Key: "$ne", Value: "Rome"}}},
+	}, doc)
+
+	// update
+	doc, err = trans.Document(bson.M{
+		"$set": bson.M{
+			"Items.$.Name":            "foo",
+			"Items.$[item].Post":      post,
+			"Billing.Street":          "Main",
+			"Items.$[].Address.City":  "Berlin",
+			"Items.10.Address.Street": "Main",
+		},
+	})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, bson.D{
+		{Key: "items.$.name", Value: "foo"},
+		{Key: "items.$[item].post_id", Value: post},
+		{Key: "billing_address.street", Value: "Main"},
+		{Key: "items.$[].address.city", Value: "Berlin"},
+		{Key: "items.10.address.street", Value: "Main"},
+	}, doc[0].Value)
+
+	// sort
+	doc, err = trans.Sort([]string{"Address.City", "-Items.Name"})
+	assert.NoError(t, err)
+	assert.Equal(t, bson.D{
+		{Key: "address.city", Value: int32(1)},
+		{Key: "items.name", Value: int32(-1)},
+	}, doc)
+
+	// reference
+	pipeline, err := trans.Pipeline([]bson.M{
+		{"$group": bson.M{"_id": "$Address.City"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, bson.A{
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$address.city"},
+		}}},
+	}, pipeline)
+
+	// unknown
+	_, err = trans.Document(bson.M{
+		"Address.Foo": "bar",
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `unknown field "Address.Foo"`, err.Error())
+
+	// mixed
+	_, err = trans.Document(bson.M{
+		"Address.city": "bar",
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `unknown field "Address.city"`, err.Error())
+
+	// opaque
+	_, err = trans.Document(bson.M{
+		"Location.Foo": "bar",
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `unknown field "Location.Foo"`, err.Error())
+}
+
 func TestTranslatorSort(t *testing.T) {
 	trans := NewTranslator(&postModel{})
 
@@ -301,3 +380,118 @@ func BenchmarkTranslatorSort(b *testing.B) {
 		}
 	}
 }
+
+func TestTranslatorPipeline(t *testing.T) {
+	trans := NewTranslator(&postModel{})
+
+	// empty
+	doc, err := trans.Pipeline(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, bson.A{}, doc)
+
+	// stages
+	doc, err = trans.Pipeline([]bson.M{
+		{"$match": bson.M{"Published": true}},
+		{"$lookup": bson.M{
+			"from":         &commentModel{},
+			"localField":   "_id",
+			"foreignField": "Post",
+			"as":           "comments",
+		}},
+		{"$unwind": "$comments"},
+		{"$addFields": bson.M{"length": bson.M{"$strLenCP": "$TextBody"}}},
+		{"$match": bson.M{"comments.message": "foo", "length": bson.M{"$gt": 5}}},
+		{"$sort": bson.D{{Key: "TextBody", Value: -1}}},
+		{"$group": bson.M{
+			"_id":   "$Title",
+			"total": bson.M{"$sum": "$length"},
+			"count": bson.M{"$sum": 1},
+		}},
+		{"$sort": bson.M{"total": 1}},
+		{"$limit": 5},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, bson.A{
+		bson.D{{Key: "$match", Value: bson.D{
+			{Key: "published", Value: true},
+		}}},
+		bson.D{{Key: "$lookup", Value: bson.D{
+			{Key: "as", Value: "comments"},
+			{Key: "foreignField", Value: "post_id"},
+			{Key: "from", Value: "comments"},
+			{Key: "localField", Value: "_id"},
+		}}},
+		bson.D{{Key: "$unwind", Value: "$comments"}},
+		bson.D{{Key: "$addFields", Value: bson.D{
+			{Key: "length", Value: bson.D{{Key: "$strLenCP", Value: "$text_body"}}},
+		}}},
+		bson.D{{Key: "$match", Value: bson.D{
+			{Key: "comments.message", Value: "foo"},
+			{Key: "length", Value: bson.D{{Key: "$gt", Value: int64(5)}}},
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{
+			{Key: "text_body", Value: int64(-1)},
+		}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$title"},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: int64(1)}}},
+			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$length"}}},
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{
+			{Key: "total", Value: int64(1)},
+		}}},
+		bson.D{{Key: "$limit", Value: int64(5)}},
+	}, doc)
+
+	// project
+	doc, err = trans.Pipeline([]bson.M{
+		{"$project": bson.M{"Title": 1, "body": "$TextBody.foo"}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `unknown field "body"`, err.Error())
+
+	doc, err = trans.Pipeline([]bson.M{
+		{"$project": bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "TextBody", Value: "$TextBody.foo"},
+			{Key: "Title", Value: 1},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, bson.A{
+		bson.D{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: int64(0)},
+			{Key: "text_body", Value: "$text_body.foo"},
+			{Key: "title", Value: int64(1)},
+		}}},
+	}, doc)
+
+	// unknown field
+	doc, err = trans.Pipeline([]bson.M{
+		{"$match": bson.M{"foo": "bar"}},
+	})
+	assert.Error(t, err)
+	assert.Nil(t, doc)
+	assert.Equal(t, `unknown field "foo"`, err.Error())
+
+	// unknown reference
+	_, err = trans.Pipeline([]bson.M{
+		{"$group": bson.M{"_id": "$foo"}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `unknown field "foo"`, err.Error())
+
+	// unsafe operator
+	_, err = trans.Pipeline([]bson.M{
+		{"$match": bson.M{"$where": "true"}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `unsafe operator "$where"`, err.Error())
+
+	// invalid stage
+	_, err = trans.Pipeline([]bson.M{
+		{"$match": bson.M{}, "$sort": bson.M{}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, `invalid pipeline stage`, err.Error())
+}
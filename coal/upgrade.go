@@ -0,0 +1,370 @@
+package coal
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/256dpi/lungo"
+	"github.com/256dpi/lungo/bsonkit"
+	"github.com/256dpi/xo"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+// VersionFlag marks the integer field that stores the schema version of a
+// document.
+const VersionFlag = "fire-schema-version"
+
+// Upgrade is a function that upgrades a raw document by one version. Encrypted
+// fields are provided as stored in the database.
+type Upgrade func(doc bson.M) error
+
+type upgradeChain struct {
+	field     *Field
+	steps     []Upgrade
+	writeBack bool
+}
+
+var upgradeMutex sync.RWMutex
+var upgradeChains = map[*Meta]*upgradeChain{}
+
+// RegisterUpgrades will register the upgrade chain for the specified model. The
+// model must have an integer field flagged with "fire-schema-version". The step
+// at index i upgrades documents from version i to version i+1, which makes the
+// length of the chain the current version. Documents without a version are
+// considered to be at version zero.
+//
+// The manager will upgrade documents with an older version when decoding them
+// in Find, FindFirst, FindAll and FindEach. If write back is enabled, upgraded
+// documents are written back to the database unless they have been modified in
+// the meantime. Only the fields changed by the upgrade are written back.
+// Documents read in read only transactions are not written back as these
+// transactions are always aborted. New, replaced and upserted documents are
+// always stored with the current version.
+//
+// Note: Documents written directly to the collection must set the version
+// field, otherwise they are upgraded again when read.
+func RegisterUpgrades(model Model, writeBack bool, steps ...Upgrade) {
+	// get meta
+	meta := GetMeta(model)
+
+	// get field
+	fields := meta.FlaggedFields[VersionFlag]
+	if len(fields) != 1 {
+		panic(fmt.Sprintf(`coal: expected one field flagged as "%s" on "%s"`, VersionFlag, meta.Name))
+	}
+
+	// acquire mutex
+	upgradeMutex.Lock()
+	defer upgradeMutex.Unlock()
+
+	// check existing
+	if upgradeChains[meta] != nil {
+		panic(fmt.Sprintf(`coal: upgrades already registered for "%s"`, meta.Name))
+	}
+
+	// add chain
+	upgradeChains[meta] = &upgradeChain{
+		field:     fields[0],
+		steps:     steps,
+		writeBack: writeBack,
+	}
+}
+
+// CurrentVersion will return the current schema version of the specified model
+// as defined by the registered upgrade chain.
+func CurrentVersion(model Model) int {
+	// get chain
+	chain := getUpgradeChain(GetMeta(model))
+	if chain == nil {
+		return 0
+	}
+
+	return len(chain.steps)
+}
+
+func getUpgradeChain(meta *Meta) *upgradeChain {
+	// acquire mutex
+	upgradeMutex.RLock()
+	defer upgradeMutex.RUnlock()
+
+	return upgradeChains[meta]
+}
+
+func (c *upgradeChain) upgrade(doc bson.M) (bool, error) {
+	// get version
+	key := c.field.BSONKey
+	var version int
+	switch v := doc[key].(type) {
+	case int32:
+		version = int(v)
+	case int64:
+		version = int(v)
+	case float64:
+		version = int(v)
+	}
+
+	// upgrade document
+	upgraded := version < len(c.steps)
+	for version < len(c.steps) {
+		err := c.steps[version](doc)
+		if err != nil {
+			return false, xo.W(err)
+		}
+		version++
+		doc[key] = version
+	}
+
+	return upgraded, nil
+}
+
+func (m *Manager) stampVersion(model Model) {
+	// set current version
+	chain := getUpgradeChain(m.meta)
+	if chain != nil {
+		stick.MustSet(model, chain.field.Name, len(chain.steps))
+	}
+}
+
+func (m *Manager) stampUpsert(update *bson.D) error {
+	// get chain
+	chain := getUpgradeChain(m.meta)
+	if chain == nil {
+		return nil
+	}
+
+	// skip if the update already sets the version
+	key := chain.field.BSONKey
+	for _, op := range []string{"$set", "$setOnInsert", "$unset", "$inc", "$max", "$min"} {
+		if bsonkit.Get(update, op+"."+key) != bsonkit.Missing {
+			return nil
+		}
+	}
+
+	// set current version on insert
+	_, err := bsonkit.Put(update, "$setOnInsert."+key, len(chain.steps), false)
+	if err != nil {
+		return xo.WF(err, "unable to set version")
+	}
+
+	return nil
+}
+
+func (m *Manager) upgradeRaw(raw bson.Raw) (bsonkit.Doc, error) {
+	// transform directly if not versioned
+	chain := getUpgradeChain(m.meta)
+	if chain == nil {
+		doc, err := bsonkit.Transform(raw)
+		if err != nil {
+			return nil, xo.W(err)
+		}
+		return doc, nil
+	}
+
+	// decode document
+	var doc bson.M
+	err := bson.Unmarshal(raw, &doc)
+	if err != nil {
+		return nil, xo.W(err)
+	}
+
+	// upgrade document
+	_, err = chain.upgrade(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// transform document
+	res, err := bsonkit.Transform(doc)
+	if err != nil {
+		return nil, xo.W(err)
+	}
+
+	return res, nil
+}
+
+func (m *Manager) decodeRaw(ctx context.Context, raw bson.Raw, model Model) error {
+	// decode document
+	chain := getUpgradeChain(m.meta)
+	if chain == nil {
+		err := bson.Unmarshal(raw, model)
+		if err != nil {
+			return xo.W(err)
+		}
+	} else {
+		err := m.upgradeDecode(ctx, chain, raw, model)
+		if err != nil {
+			return err
+		}
+	}
+
+	// decrypt model
+	return m.decrypt(model)
+}
+
+func (m *Manager) decodeResult(ctx context.Context, res lungo.ISingleResult, model Model) error {
+	// decode directly if not versioned
+	chain := getUpgradeChain(m.meta)
+	if chain == nil {
+		return res.Decode(model)
+	}
+
+	// decode document
+	var raw bson.Raw
+	err := res.Decode(&raw)
+	if err != nil {
+		return err
+	}
+
+	// upgrade and decode document
+	return m.upgradeDecode(ctx, chain, raw, model)
+}
+
+func (m *Manager) decodeAll(ctx context.Context, iter *Iterator, list interface{}) error {
+	// decode directly if not versioned
+	chain := getUpgradeChain(m.meta)
+	if chain == nil {
+		return iter.All(list)
+	}
+
+	// decode documents
+	var docs []bson.Raw
+	err := iter.All(&docs)
+	if err != nil {
+		return err
+	}
+
+	// get slice
+	slice := reflect.ValueOf(list).Elem()
+	slice.Set(slice.Slice(0, 0))
+
+	// upgrade and decode documents
+	for _, doc := range docs {
+		model := m.meta.Make()
+		err = m.upgradeDecode(ctx, chain, doc, model)
+		if err != nil {
+			return err
+		}
+		if slice.Type().Elem().Kind() == reflect.Ptr {
+			slice.Set(reflect.Append(slice, reflect.ValueOf(model)))
+		} else {
+			slice.Set(reflect.Append(slice, reflect.ValueOf(model).Elem()))
+		}
+	}
+
+	return nil
+}
+
+func (m *Manager) decodeIterator(ctx context.Context, iter *Iterator, model Model) error {
+	// decode directly if not versioned
+	chain := getUpgradeChain(m.meta)
+	if chain == nil {
+		return iter.Decode(model)
+	}
+
+	// decode document
+	var raw bson.Raw
+	err := iter.Decode(&raw)
+	if err != nil {
+		return err
+	}
+
+	// upgrade and decode document
+	return m.upgradeDecode(ctx, chain, raw, model)
+}
+
+func (m *Manager) upgradeDecode(ctx context.Context, chain *upgradeChain, raw bson.Raw, model Model) error {
+	// decode document
+	var doc bson.M
+	err := bson.Unmarshal(raw, &doc)
+	if err != nil {
+		return xo.W(err)
+	}
+
+	// upgrade document
+	_, hasVersion := doc[chain.field.BSONKey]
+	upgraded, err := chain.upgrade(doc)
+	if err != nil {
+		return err
+	}
+
+	// write back document if upgraded, read only transactions are always
+	// aborted and would discard the write
+	if chain.writeBack && upgraded && !readOnlyTransaction(ctx) {
+		err = m.writeBack(ctx, raw, doc, chain.field.BSONKey, hasVersion)
+		if err != nil {
+			return err
+		}
+	}
+
+	// encode document
+	bytes, err := bson.Marshal(doc)
+	if err != nil {
+		return xo.W(err)
+	}
+
+	// decode model
+	err = bson.Unmarshal(bytes, model)
+	if err != nil {
+		return xo.W(err)
+	}
+
+	return nil
+}
+
+func (m *Manager) writeBack(ctx context.Context, raw bson.Raw, doc bson.M, key string, hasVersion bool) error {
+	// decode original document
+	var before bson.M
+	err := bson.Unmarshal(raw, &before)
+	if err != nil {
+		return xo.W(err)
+	}
+
+	// prepare filter
+	filter := bson.M{
+		"_id": doc["_id"],
+		key:   raw.Lookup(key),
+	}
+	if !hasVersion {
+		filter[key] = bson.M{"$exists": false}
+	}
+
+	// collect changed fields and require their original values
+	set := bson.M{key: doc[key]}
+	unset := bson.M{}
+	for name, value := range doc {
+		if name == key || name == "_id" {
+			continue
+		}
+		if old, ok := before[name]; !ok {
+			set[name] = value
+			filter[name] = bson.M{"$exists": false}
+		} else if !reflect.DeepEqual(old, value) {
+			set[name] = value
+			filter[name] = raw.Lookup(name)
+		}
+	}
+	for name := range before {
+		if _, ok := doc[name]; !ok && name != key {
+			unset[name] = true
+			filter[name] = raw.Lookup(name)
+		}
+	}
+
+	// prepare update
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	// update document
+	_, err = m.coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
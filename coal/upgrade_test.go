@@ -0,0 +1,276 @@
+package coal
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/256dpi/fire/stick"
+)
+
+type versionedModel struct {
+	Base    `json:"-" bson:",inline" coal:"versioned"`
+	First   string `json:"first"`
+	Last    string `json:"last"`
+	Age     int    `json:"age"`
+	Version int    `json:"-" bson:"_v" coal:"fire-schema-version"`
+	stick.NoValidation
+}
+
+type lazyModel struct {
+	Base    `json:"-" bson:",inline" coal:"lazies"`
+	Title   string `json:"title"`
+	Version int    `json:"-" coal:"fire-schema-version"`
+	stick.NoValidation
+}
+
+var lazyHook func(doc bson.M)
+
+func init() {
+	RegisterUpgrades(&versionedModel{}, false, func(doc bson.M) error {
+		parts := strings.SplitN(doc["name"].(string), " ", 2)
+		doc["first"] = parts[0]
+		doc["last"] = parts[1]
+		delete(doc, "name")
+		return nil
+	}, func(doc bson.M) error {
+		if doc["age"] == nil {
+			doc["age"] = 18
+		}
+		return nil
+	})
+
+	RegisterUpgrades(&lazyModel{}, true, func(doc bson.M) error {
+		if lazyHook != nil {
+			lazyHook(doc)
+		}
+		doc["title"] = strings.ToUpper(doc["title"].(string))
+		return nil
+	})
+}
+
+func TestUpgrade(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		assert.Equal(t, 2, CurrentVersion(&versionedModel{}))
+		assert.Equal(t, 0, CurrentVersion(&postModel{}))
+
+		id1 := New()
+		_, err := tester.Store.C(&versionedModel{}).InsertOne(nil, bson.M{
+			"_id":  id1,
+			"name": "John Doe",
+		})
+		assert.NoError(t, err)
+
+		id2 := New()
+		_, err = tester.Store.C(&versionedModel{}).InsertOne(nil, bson.M{
+			"_id":   id2,
+			"first": "Jane",
+			"last":  "Doe",
+			"_v":    1,
+		})
+		assert.NoError(t, err)
+
+		var model versionedModel
+		found, err := tester.Store.M(&versionedModel{}).Find(nil, &model, id1, false)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, versionedModel{
+			Base:    Base{DocID: id1},
+			First:   "John",
+			Last:    "Doe",
+			Age:     18,
+			Version: 2,
+		}, model)
+
+		model = versionedModel{}
+		found, err = tester.Store.M(&versionedModel{}).FindFirst(nil, &model, bson.M{
+			"_id": id2,
+		}, nil, 0, false)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "Jane", model.First)
+		assert.Equal(t, 18, model.Age)
+
+		var list []*versionedModel
+		err = tester.Store.M(&versionedModel{}).FindAll(nil, &list, bson.M{}, []string{"_id"}, 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		assert.Len(t, list, 2)
+		assert.Equal(t, "John", list[0].First)
+		assert.Equal(t, "Jane", list[1].First)
+
+		iter, err := tester.Store.M(&versionedModel{}).FindEach(nil, bson.M{}, []string{"_id"}, 0, 0, false, NoTransaction)
+		assert.NoError(t, err)
+		var names []string
+		for iter.Next() {
+			var model versionedModel
+			assert.NoError(t, iter.Decode(&model))
+			names = append(names, model.First+" "+model.Last)
+		}
+		assert.NoError(t, iter.Error())
+		iter.Close()
+		assert.Equal(t, []string{"John Doe", "Jane Doe"}, names)
+
+		var raw bson.M
+		err = tester.Store.C(&versionedModel{}).FindOne(nil, bson.M{"_id": id1}).Decode(&raw)
+		assert.NoError(t, err)
+		assert.Equal(t, "John Doe", raw["name"])
+
+		model3 := tester.Insert(&versionedModel{
+			First: "Jim",
+			Age:   42,
+		}).(*versionedModel)
+		assert.Equal(t, 2, model3.Version)
+		model3 = tester.Fetch(&versionedModel{}, model3.ID()).(*versionedModel)
+		assert.Equal(t, 42, model3.Age)
+	})
+}
+
+func TestUpgradeWriteBack(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+
+		id := New()
+		_, err := tester.Store.C(&lazyModel{}).InsertOne(nil, bson.M{
+			"_id":   id,
+			"title": "foo",
+		})
+		assert.NoError(t, err)
+
+		model := tester.Fetch(&lazyModel{}, id).(*lazyModel)
+		assert.Equal(t, "FOO", model.Title)
+		assert.Equal(t, 1, model.Version)
+
+		var raw bson.M
+		err = tester.Store.C(&lazyModel{}).FindOne(nil, bson.M{"_id": id}).Decode(&raw)
+		assert.NoError(t, err)
+		assert.Equal(t, "FOO", raw["title"])
+		assert.Equal(t, int32(1), raw["version"])
+
+		model = tester.Fetch(&lazyModel{}, id).(*lazyModel)
+		assert.Equal(t, "FOO", model.Title)
+
+		id = New()
+		_, err = tester.Store.C(&lazyModel{}).InsertOne(nil, bson.M{
+			"_id":   id,
+			"title": "bar",
+		})
+		assert.NoError(t, err)
+
+		err = tester.Store.T(nil, true, func(ctx context.Context) error {
+			var model lazyModel
+			found, err := tester.Store.M(&lazyModel{}).Find(ctx, &model, id, false)
+			assert.True(t, found)
+			assert.Equal(t, "BAR", model.Title)
+			assert.NoError(t, err)
+
+			var raw bson.M
+			err = tester.Store.C(&lazyModel{}).FindOne(ctx, bson.M{"_id": id}).Decode(&raw)
+			assert.Equal(t, "bar", raw["title"])
+			return err
+		})
+		assert.NoError(t, err)
+
+		raw = nil
+		err = tester.Store.C(&lazyModel{}).FindOne(nil, bson.M{"_id": id}).Decode(&raw)
+		assert.NoError(t, err)
+		assert.Equal(t, "bar", raw["title"])
+		assert.Nil(t, raw["version"])
+	})
+}
+
+func TestUpgradeWriteBackConflict(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		defer func() {
+			lazyHook = nil
+		}()
+
+		id := New()
+		_, err := tester.Store.C(&lazyModel{}).InsertOne(nil, bson.M{
+			"_id":   id,
+			"title": "foo",
+		})
+		assert.NoError(t, err)
+
+		lazyHook = func(bson.M) {
+			_, err := tester.Store.C(&lazyModel{}).UpdateOne(nil, bson.M{"_id": id}, bson.M{
+				"$set": bson.M{"note": "bar"},
+			})
+			assert.NoError(t, err)
+		}
+
+		model := tester.Fetch(&lazyModel{}, id).(*lazyModel)
+		assert.Equal(t, "FOO", model.Title)
+
+		var raw bson.M
+		err = tester.Store.C(&lazyModel{}).FindOne(nil, bson.M{"_id": id}).Decode(&raw)
+		assert.NoError(t, err)
+		assert.Equal(t, "FOO", raw["title"])
+		assert.Equal(t, "bar", raw["note"])
+		assert.Equal(t, int32(1), raw["version"])
+
+		id = New()
+		_, err = tester.Store.C(&lazyModel{}).InsertOne(nil, bson.M{
+			"_id":   id,
+			"title": "foo",
+		})
+		assert.NoError(t, err)
+
+		lazyHook = func(bson.M) {
+			_, err := tester.Store.C(&lazyModel{}).UpdateOne(nil, bson.M{"_id": id}, bson.M{
+				"$set": bson.M{"title": "baz"},
+			})
+			assert.NoError(t, err)
+		}
+
+		model = tester.Fetch(&lazyModel{}, id).(*lazyModel)
+		assert.Equal(t, "FOO", model.Title)
+
+		raw = nil
+		err = tester.Store.C(&lazyModel{}).FindOne(nil, bson.M{"_id": id}).Decode(&raw)
+		assert.NoError(t, err)
+		assert.Equal(t, "baz", raw["title"])
+		assert.Nil(t, raw["version"])
+	})
+}
+
+func TestUpgradeUpsert(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		var model lazyModel
+		inserted, err := tester.Store.M(&lazyModel{}).Upsert(nil, &model, bson.M{
+			"Title": "hello",
+		}, bson.M{
+			"$set": bson.M{
+				"Title": "hello",
+			},
+		}, nil, false)
+		assert.NoError(t, err)
+		assert.True(t, inserted)
+		assert.Equal(t, 1, model.Version)
+
+		model = *tester.Fetch(&lazyModel{}, model.ID()).(*lazyModel)
+		assert.Equal(t, "hello", model.Title)
+		assert.Equal(t, 1, model.Version)
+	})
+}
+
+func TestRegisterUpgradesPanics(t *testing.T) {
+	assert.PanicsWithValue(t, `coal: expected one field flagged as "fire-schema-version" on "coal.postModel"`, func() {
+		RegisterUpgrades(&postModel{}, false)
+	})
+
+	assert.PanicsWithValue(t, `coal: upgrades already registered for "coal.lazyModel"`, func() {
+		RegisterUpgrades(&lazyModel{}, false)
+	})
+
+	type invalidModel struct {
+		Base    `json:"-" bson:",inline" coal:"invalid"`
+		Version string `json:"-" coal:"fire-schema-version"`
+		stick.NoValidation
+	}
+
+	assert.PanicsWithValue(t, `coal: version field "Version" must be an int`, func() {
+		GetMeta(&invalidModel{})
+	})
+}
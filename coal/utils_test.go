@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"github.com/256dpi/xo"
+
+	"github.com/256dpi/fire/stick"
 )
 
 type postModel struct {
@@ -65,10 +67,31 @@ func (m *polyModel) Validate() error {
 	return nil
 }
 
+type addressItem struct {
+	Street string `json:"street"`
+	City   string `json:"city"`
+}
+
+type lineItem struct {
+	Name    string      `json:"name"`
+	Post    ID          `json:"post" bson:"post_id"`
+	Address addressItem `json:"address"`
+}
+
+type nestedModel struct {
+	Base     `json:"-" bson:",inline" coal:"nesteds"`
+	Address  addressItem  `json:"address"`
+	Billing  *addressItem `json:"billing" bson:"billing_address"`
+	Items    []lineItem   `json:"items"`
+	Location Point        `json:"location"`
+	Internal addressItem  `json:"-" bson:"internal"`
+	stick.NoValidation
+}
+
 var mongoStore = MustConnect("mongodb://0.0.0.0/test-fire-coal", xo.Panic)
 var lungoStore = MustOpen(nil, "test-fire-coal", xo.Panic)
 
-var modelList = []Model{&postModel{}, &commentModel{}, &selectionModel{}, &noteModel{}, &polyModel{}, &fooModel{}}
+var modelList = []Model{&postModel{}, &commentModel{}, &selectionModel{}, &noteModel{}, &polyModel{}, &fooModel{}, &AppliedMigration{}, &versionedModel{}, &lazyModel{}}
 
 func withTester(t *testing.T, fn func(*testing.T, *Tester)) {
 	t.Run("Mongo", func(t *testing.T) {
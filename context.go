@@ -146,14 +146,18 @@ type Context struct {
 	Sorting []string
 
 	// Only the whitelisted readable fields are exposed to the client as
-	// attributes and relationships.
+	// attributes and relationships. Nested fields (e.g. "Address.City") may be
+	// listed to only expose parts of an attribute.
 	//
 	// Usage: Reduce Only
 	// Availability: Authorizers
 	// Operations: !Delete, !ResourceAction, !CollectionAction
 	ReadableFields []string
 
-	// Only the whitelisted writable fields can be altered by requests.
+	// Only the whitelisted writable fields can be altered by requests. Nested
+	// fields (e.g. "Address.City") may be listed to only allow changes to parts
+	// of an attribute. Items of nested slices cannot be added or removed unless
+	// the whole field is writable.
 	//
 	// Usage: Reduce Only
 	// Availability: Authorizers
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,6 +21,10 @@ import (
 	"github.com/256dpi/fire/stick"
 )
 
+var idType = reflect.TypeOf(coal.ID{})
+var optIDType = reflect.TypeOf(coal.N())
+var idsType = reflect.TypeOf([]coal.ID{})
+
 // A Controller provides a JSON API based interface to a model.
 //
 // Database transactions are automatically used for list, find, create, update
@@ -40,11 +45,17 @@ type Controller struct {
 	Supported Matcher
 
 	// Filters is a list of fields that are filterable. Only fields that are
-	// exposed and indexed should be made filterable.
+	// exposed and indexed should be made filterable. Nested fields are listed
+	// by their dotted name e.g. "Address.City" and filtered by their dotted
+	// attribute key e.g. "filter[address.city]". Filterable coal.Point
+	// fields support "filter[field][within]=lng,lat,meters" (circle) and
+	// "filter[field][within]=lng,lat,lng,lat,..." (polygon) queries which
+	// require a 2dsphere index. The results are not sorted by distance.
 	Filters []string
 
 	// Sorters is a list of fields that are sortable. Only fields that are
-	// exposed and indexed should be made sortable.
+	// exposed and indexed should be made sortable. Nested fields are listed by
+	// their dotted name as well.
 	Sorters []string
 
 	// Properties is a mapping of model properties to attribute keys. These properties
@@ -157,6 +168,16 @@ type Controller struct {
 	// a TTL index to delete the documents automatically after some timeout.
 	SoftDelete bool
 
+	// CascadeDepth defines the maximum depth of cascaded deletes and soft
+	// deletes. Cascade rules are declared on has-one and has-many relationship
+	// fields using the "fire-restrict", "fire-cascade-delete", "fire-nullify"
+	// and "fire-cascade-soft-delete" flags and are enforced within the delete
+	// transaction. Documents that are reached multiple times are only processed
+	// once.
+	//
+	// Default: 8.
+	CascadeDepth int
+
 	parser     jsonapi.Parser
 	meta       *coal.Meta
 	properties map[string]func(coal.Model) (interface{}, error)
@@ -232,6 +253,18 @@ func (c *Controller) prepare() {
 		c.WriteTimeout = 30 * time.Second
 	}
 
+	// set default cascade depth
+	if c.CascadeDepth == 0 {
+		c.CascadeDepth = 8
+	}
+
+	// check cascade rules
+	for _, field := range c.meta.OrderedFields {
+		if field.HasOne || field.HasMany {
+			cascadeRule(field)
+		}
+	}
+
 	// check soft delete field
 	if c.SoftDelete {
 		fieldName := coal.L(c.Model, "fire-soft-delete", true)
@@ -332,26 +365,35 @@ func (c *Controller) handle(prefix string, ctx *Context, selector bson.M, write
 		selector = bson.M{}
 	}
 
-	// prepare context
-	ctx.Selector = selector
-	ctx.Filters = []bson.M{}
-	ctx.ReadableFields = c.initialFields(false, ctx.JSONAPIRequest)
-	ctx.WritableFields = c.initialFields(true, nil)
-	ctx.ReadableProperties = c.initialProperties(ctx.JSONAPIRequest)
-	ctx.RelationshipFilters = map[string][]bson.M{}
-
 	// set store
 	ctx.Store = c.Store
 
 	// run operation with transaction if not an action
 	if !ctx.Operation.Action() {
-		xo.AbortIf(c.Store.T(ctx.Context, ctx.Operation.Read(), func(tc context.Context) error {
+		// keep initial data
+		data := ctx.Data
+
+		xo.AbortIf(c.Store.T(ctx.Context, ctx.Operation.Read(), func(tc context.Context) (err error) {
+			// reset context as the transaction may be retried
+			ctx.Data = stick.Map{}
+			for key, value := range data {
+				ctx.Data[key] = value
+			}
+			c.prepareContext(ctx, selector)
+
+			// return aborts as errors to allow retries
+			defer xo.Resume(func(e error) {
+				err = e
+			})
+
 			ctx.With(tc, func() {
 				c.runOperation(ctx)
 			})
+
 			return nil
 		}))
 	} else {
+		c.prepareContext(ctx, selector)
 		c.runOperation(ctx)
 	}
 
@@ -361,6 +403,22 @@ func (c *Controller) handle(prefix string, ctx *Context, selector bson.M, write
 	}
 }
 
+func (c *Controller) prepareContext(ctx *Context, selector bson.M) {
+	// prepare context
+	ctx.Selector = selector
+	ctx.Filters = []bson.M{}
+	ctx.Sorting = nil
+	ctx.ReadableFields = c.initialFields(false, ctx.JSONAPIRequest)
+	ctx.WritableFields = c.initialFields(true, nil)
+	ctx.ReadableProperties = c.initialProperties(ctx.JSONAPIRequest)
+	ctx.RelationshipFilters = map[string][]bson.M{}
+	ctx.Model = nil
+	ctx.Models = nil
+	ctx.Original = nil
+	ctx.Response = nil
+	ctx.ResponseCode = 0
+}
+
 func (c *Controller) runOperation(ctx *Context) {
 	// call specific handlers
 	switch ctx.JSONAPIRequest.Intent {
@@ -741,6 +799,19 @@ func (c *Controller) deleteResource(ctx *Context) {
 	// run validators
 	c.runCallbacks(c.Validators, ctx, http.StatusBadRequest)
 
+	// cascade delete
+	err = c.cascade(ctx, c.Model, []coal.ID{ctx.Model.ID()}, c.SoftDelete, 0, map[coal.Ref]bool{
+		coal.R(ctx.Model): true,
+	})
+	if xo.IsSafe(err) {
+		xo.Abort(&jsonapi.Error{
+			Status: http.StatusBadRequest,
+			Detail: err.Error(),
+		})
+	} else if err != nil {
+		xo.Abort(err)
+	}
+
 	// check if soft delete has been enabled
 	if c.SoftDelete {
 		// get soft delete field
@@ -1481,14 +1552,8 @@ func (c *Controller) loadModels(ctx *Context) {
 				xo.Abort(jsonapi.BadRequest(fmt.Sprintf(`invalid filter "%s"`, name)))
 			}
 
-			// handle boolean values
-			if field.Kind == reflect.Bool && len(values) == 1 {
-				ctx.Filters = append(ctx.Filters, bson.M{field.BSONKey: values[0] == "true"})
-				continue
-			}
-
-			// handle string values
-			ctx.Filters = append(ctx.Filters, bson.M{field.BSONKey: bson.M{"$in": values}})
+			// set attribute filter
+			ctx.Filters = append(ctx.Filters, c.attributeFilter(field, values))
 			continue
 		}
 
@@ -1499,21 +1564,39 @@ func (c *Controller) loadModels(ctx *Context) {
 				xo.Abort(jsonapi.BadRequest(fmt.Sprintf(`invalid filter "%s"`, name)))
 			}
 
-			// convert to object ids
-			var ids []coal.ID
-			for _, str := range values {
-				refID, err := coal.FromHex(str)
-				if err != nil {
-					xo.Abort(jsonapi.BadRequest("relationship filter value is not an object id"))
-				}
-				ids = append(ids, refID)
+			// set relationship filter
+			ctx.Filters = append(ctx.Filters, c.relationshipFilter(field, values))
+			continue
+		}
+
+		// handle nested filters
+		if field := c.meta.NestedAttributes[name]; field != nil {
+			// check whitelist
+			if !stick.Contains(c.Filters, field.Name) || field.Polymorphic {
+				xo.Abort(jsonapi.BadRequest(fmt.Sprintf(`invalid filter "%s"`, name)))
 			}
 
-			// set relationship filter
-			ctx.Filters = append(ctx.Filters, bson.M{field.BSONKey: bson.M{"$in": ids}})
+			// set reference or attribute filter
+			if field.Type == idType || field.Type == optIDType || field.Type == idsType {
+				ctx.Filters = append(ctx.Filters, c.relationshipFilter(field, values))
+			} else {
+				ctx.Filters = append(ctx.Filters, c.attributeFilter(field, values))
+			}
 			continue
 		}
 
+		// handle geo filters
+		if i := strings.Index(name, "]["); i > 0 {
+			field := c.meta.Attributes[name[:i]]
+			if field == nil {
+				field = c.meta.NestedAttributes[name[:i]]
+			}
+			if field != nil {
+				ctx.Filters = append(ctx.Filters, c.geoFilter(field, name[i+2:], values))
+				continue
+			}
+		}
+
 		// raise an error on a unsupported filter
 		xo.Abort(jsonapi.BadRequest(fmt.Sprintf(`invalid filter "%s"`, name)))
 	}
@@ -1528,6 +1611,9 @@ func (c *Controller) loadModels(ctx *Context) {
 
 		// find field
 		field := c.meta.Attributes[normalizedSorter]
+		if field == nil {
+			field = c.meta.NestedAttributes[normalizedSorter]
+		}
 		if field == nil {
 			xo.Abort(jsonapi.BadRequest(fmt.Sprintf(`invalid sorter "%s"`, normalizedSorter)))
 		}
@@ -1574,33 +1660,103 @@ func (c *Controller) loadModels(ctx *Context) {
 	ctx.Models = coal.Slice(models)
 }
 
-func (c *Controller) assignData(ctx *Context, res *jsonapi.Resource) {
-	// trace
-	ctx.Tracer.Push("fire/Controller.assignData")
-	defer ctx.Tracer.Pop()
+func (c *Controller) attributeFilter(field *coal.Field, values []string) bson.M {
+	// handle boolean values
+	if field.Kind == reflect.Bool && len(values) == 1 {
+		return bson.M{field.BSONKey: values[0] == "true"}
+	}
 
-	// prepare whitelist
-	var whitelist []string
+	// handle string values
+	return bson.M{field.BSONKey: bson.M{"$in": values}}
+}
 
-	// covert field names to attributes and relationships
-	for _, field := range ctx.WritableFields {
-		// get field
-		f := c.meta.Fields[field]
-		if f == nil {
-			xo.Abort(xo.F("unknown writable field %s", field))
+func (c *Controller) relationshipFilter(field *coal.Field, values []string) bson.M {
+	// convert to object ids
+	var ids []coal.ID
+	for _, str := range values {
+		refID, err := coal.FromHex(str)
+		if err != nil {
+			xo.Abort(jsonapi.BadRequest("relationship filter value is not an object id"))
 		}
+		ids = append(ids, refID)
+	}
 
-		// add attributes and relationships
-		if f.JSONKey != "" {
-			whitelist = append(whitelist, f.JSONKey)
-		} else if f.RelName != "" {
-			whitelist = append(whitelist, f.RelName)
+	return bson.M{field.BSONKey: bson.M{"$in": ids}}
+}
+
+func (c *Controller) geoFilter(field *coal.Field, operator string, values []string) bson.M {
+	// check whitelist, type and operator
+	if !stick.Contains(c.Filters, field.Name) || field.Type != reflect.TypeOf(coal.Point{}) || operator != "within" {
+		xo.Abort(jsonapi.BadRequest(fmt.Sprintf(`invalid filter "%s][%s"`, field.JSONKey, operator)))
+	}
+
+	// parse numbers
+	numbers := make([]float64, 0, len(values))
+	for _, value := range values {
+		num, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			xo.Abort(jsonapi.BadRequest("geo filter value is not a number"))
 		}
+		numbers = append(numbers, num)
+	}
+
+	// handle circles
+	if len(numbers) == 3 {
+		// check distance
+		if numbers[2] <= 0 {
+			xo.Abort(jsonapi.BadRequest("within filter expects a positive distance"))
+		}
+
+		// prepare point
+		point := coal.Point{Longitude: numbers[0], Latitude: numbers[1]}
+		err := point.Validate()
+		if err != nil {
+			xo.Abort(jsonapi.BadRequest(err.Error()))
+		}
+
+		return bson.M{field.BSONKey: coal.WithinRadius(point, numbers[2])}
+	}
+
+	// check values
+	if len(numbers) < 6 || len(numbers)%2 != 0 {
+		xo.Abort(jsonapi.BadRequest("within filter expects a point and distance or at least three coordinate pairs"))
+	}
+
+	// prepare ring
+	var ring []coal.Point
+	for i := 0; i < len(numbers); i += 2 {
+		ring = append(ring, coal.Point{Longitude: numbers[i], Latitude: numbers[i+1]})
 	}
 
+	// close ring if necessary
+	if ring[0] != ring[len(ring)-1] {
+		ring = append(ring, ring[0])
+	}
+
+	// validate polygon
+	polygon := coal.Polygon{ring}
+	err := polygon.Validate()
+	if err != nil {
+		xo.Abort(jsonapi.BadRequest(err.Error()))
+	}
+
+	return bson.M{field.BSONKey: coal.Within(polygon)}
+}
+
+func (c *Controller) assignData(ctx *Context, res *jsonapi.Resource) {
+	// trace
+	ctx.Tracer.Push("fire/Controller.assignData")
+	defer ctx.Tracer.Pop()
+
+	// prepare whitelist
+	whitelist, nested := c.whitelistFields(ctx.WritableFields, "writable")
+
 	// prepare fields to verify read only access
 	verifyReadOnly := make([]string, 0, len(res.Attributes)+len(res.Relationships))
 
+	// prepare fields to verify nested read only access
+	verifyNested := make([]*coal.Field, 0, len(nested))
+
 	// collect properties
 	properties := make([]string, 0, len(c.Properties))
 	for _, key := range c.Properties {
@@ -1624,7 +1780,10 @@ func (c *Controller) assignData(ctx *Context, res *jsonapi.Resource) {
 		}
 
 		// check whitelist
-		if !stick.Contains(whitelist, name) {
+		if nested[name] != nil {
+			// verify nested read only access
+			verifyNested = append(verifyNested, field)
+		} else if !stick.Contains(whitelist, name) {
 			// ignore violation if tolerated or verify read only access
 			if stick.Contains(c.TolerateViolations, field.Name) {
 				continue
@@ -1637,9 +1796,38 @@ func (c *Controller) assignData(ctx *Context, res *jsonapi.Resource) {
 		attributes[name] = value
 	}
 
+	// get original
+	original := ctx.Original
+	if original == nil {
+		original = c.meta.Make()
+	}
+
 	// map attributes to struct
 	xo.AbortIf(attributes.Assign(ctx.Model))
 
+	// verify nested read only fields
+	for _, field := range verifyNested {
+		// get old and new values without the writable nested fields
+		oldValue, err := jsonapi.StructToMap(original, []string{field.JSONKey})
+		xo.AbortIf(err)
+		newValue, err := jsonapi.StructToMap(ctx.Model, []string{field.JSONKey})
+		xo.AbortIf(err)
+		oldValue[field.JSONKey] = stripNested(oldValue[field.JSONKey], nested[field.JSONKey])
+		newValue[field.JSONKey] = stripNested(newValue[field.JSONKey], nested[field.JSONKey])
+
+		// check values
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+
+		// restore value if tolerated or raise error
+		if stick.Contains(c.TolerateViolations, field.Name) {
+			stick.MustSet(ctx.Model, field.Name, stick.MustGet(original, field.Name))
+		} else {
+			xo.Abort(jsonapi.BadRequestPointer("field is not writable", field.Name))
+		}
+	}
+
 	// iterate relationships
 	for name, rel := range res.Relationships {
 		// get relationship
@@ -1743,6 +1931,46 @@ func (c *Controller) assignRelationship(ctx *Context, rel *jsonapi.Document, fie
 	}
 }
 
+func (c *Controller) whitelistFields(fields []string, kind string) ([]string, map[string][]string) {
+	// prepare whitelist
+	whitelist := make([]string, 0, len(fields))
+
+	// prepare nested whitelist
+	nested := map[string][]string{}
+
+	// covert field names to attributes and relationships
+	for _, field := range fields {
+		// add nested attributes
+		if f := c.meta.NestedFields[field]; f != nil {
+			if f.JSONKey != "" {
+				i := strings.Index(f.JSONKey, ".")
+				nested[f.JSONKey[:i]] = append(nested[f.JSONKey[:i]], f.JSONKey[i+1:])
+			}
+			continue
+		}
+
+		// get field
+		f := c.meta.Fields[field]
+		if f == nil {
+			xo.Abort(xo.F("unknown %s field %s", kind, field))
+		}
+
+		// add attributes and relationships
+		if f.JSONKey != "" {
+			whitelist = append(whitelist, f.JSONKey)
+		} else if f.RelName != "" {
+			whitelist = append(whitelist, f.RelName)
+		}
+	}
+
+	// remove fully whitelisted attributes
+	for _, key := range whitelist {
+		delete(nested, key)
+	}
+
+	return whitelist, nested
+}
+
 func (c *Controller) preloadRelationships(ctx *Context, models []coal.Model) map[string]map[coal.ID][]coal.ID {
 	// trace
 	ctx.Tracer.Push("fire/Controller.preloadRelationships")
@@ -1756,6 +1984,11 @@ func (c *Controller) preloadRelationships(ctx *Context, models []coal.Model) map
 
 	// covert field names to relationships
 	for _, field := range ctx.ReadableFields {
+		// skip nested fields
+		if c.meta.NestedFields[field] != nil {
+			continue
+		}
+
 		// get field
 		f := c.meta.Fields[field]
 		if f == nil {
@@ -1905,28 +2138,23 @@ func (c *Controller) constructResource(ctx *Context, model coal.Model, relations
 	// do not trace this call
 
 	// prepare whitelist
-	whitelist := make([]string, 0, len(ctx.ReadableFields))
-
-	// covert field names to attributes and relationships
-	for _, field := range ctx.ReadableFields {
-		// get field
-		f := c.meta.Fields[field]
-		if f == nil {
-			xo.Abort(xo.F("unknown readable field %s", field))
-		}
+	whitelist, nested := c.whitelistFields(ctx.ReadableFields, "readable")
 
-		// add attributes and relationships
-		if f.JSONKey != "" {
-			whitelist = append(whitelist, f.JSONKey)
-		} else if f.RelName != "" {
-			whitelist = append(whitelist, f.RelName)
-		}
+	// add partially readable attributes
+	attributes := whitelist
+	for key := range nested {
+		attributes = append(attributes, key)
 	}
 
 	// create map from model
-	m, err := jsonapi.StructToMap(model, whitelist)
+	m, err := jsonapi.StructToMap(model, attributes)
 	xo.AbortIf(err)
 
+	// filter partially readable attributes
+	for key, paths := range nested {
+		m[key] = filterNested(m[key], paths)
+	}
+
 	// prepare resource
 	resource := &jsonapi.Resource{
 		Type:          c.meta.PluralName,
@@ -2187,3 +2415,81 @@ func (c *Controller) runAction(a *Action, ctx *Context, errorStatus int) {
 		xo.Abort(err)
 	}
 }
+
+func filterNested(value interface{}, paths []string) interface{} {
+	// filter maps and slices
+	switch value := value.(type) {
+	case map[string]interface{}:
+		// keep whitelisted keys
+		m := make(map[string]interface{}, len(paths))
+		for key, item := range value {
+			full, sub := matchNested(key, paths)
+			if full {
+				m[key] = item
+			} else if len(sub) > 0 {
+				m[key] = filterNested(item, sub)
+			}
+		}
+
+		return m
+	case []interface{}:
+		// filter items
+		list := make([]interface{}, len(value))
+		for i, item := range value {
+			list[i] = filterNested(item, paths)
+		}
+
+		return list
+	default:
+		return value
+	}
+}
+
+func stripNested(value interface{}, paths []string) interface{} {
+	// strip maps and slices
+	switch value := value.(type) {
+	case map[string]interface{}:
+		// remove whitelisted keys
+		m := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			full, sub := matchNested(key, paths)
+			if len(sub) > 0 {
+				m[key] = stripNested(item, sub)
+			} else if !full {
+				m[key] = item
+			}
+		}
+
+		return m
+	case []interface{}:
+		// strip items
+		list := make([]interface{}, len(value))
+		for i, item := range value {
+			list[i] = stripNested(item, paths)
+		}
+
+		return list
+	default:
+		return value
+	}
+}
+
+func matchNested(key string, paths []string) (bool, []string) {
+	// match paths
+	var full bool
+	var sub []string
+	for _, path := range paths {
+		if path == key {
+			full = true
+		} else if strings.HasPrefix(path, key+".") {
+			sub = append(sub, path[len(key)+1:])
+		}
+	}
+
+	// ignore sub paths if fully matched
+	if full {
+		sub = nil
+	}
+
+	return full, sub
+}
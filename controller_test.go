@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/256dpi/jsonapi/v2"
 	"github.com/256dpi/serve"
@@ -13,6 +14,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/tidwall/gjson"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 
 	"github.com/256dpi/fire/coal"
 	"github.com/256dpi/fire/stick"
@@ -2413,6 +2415,90 @@ func TestFiltering(t *testing.T) {
 	})
 }
 
+func TestGeoFiltering(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		tester.Assign("", &Controller{
+			Model:   &placeModel{},
+			Store:   tester.Store,
+			Filters: []string{"Name", "Location"},
+		})
+
+		// create places
+		zurich := tester.Insert(&placeModel{
+			Name:     "zurich",
+			Location: coal.Point{Longitude: 8.5417, Latitude: 47.3769},
+		}).ID().Hex()
+		tester.Insert(&placeModel{
+			Name:     "berlin",
+			Location: coal.Point{Longitude: 13.405, Latitude: 52.52},
+		})
+
+		// test invalid filters
+		for _, item := range []struct {
+			query  string
+			detail string
+		}{
+			{"filter[name][within]=1,2,3", `invalid filter \"name][within\"`},
+			{"filter[location][foo]=1,2", `invalid filter \"location][foo\"`},
+			{"filter[location][near]=1,2,3", `invalid filter \"location][near\"`},
+			{"filter[location][within]=a,b,c", `geo filter value is not a number`},
+			{"filter[location][within]=1,2", `within filter expects a point and distance or at least three coordinate pairs`},
+			{"filter[location][within]=1,2,0", `within filter expects a positive distance`},
+			{"filter[location][within]=1,200,3", `invalid latitude`},
+			{"filter[location][within]=1,2,3,4", `within filter expects a point and distance or at least three coordinate pairs`},
+			{"filter[location][within]=1,2,3,4,1,2", `polygon ring must have at least four points`},
+		} {
+			tester.Request("GET", "places?"+item.query, "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+				assert.Equal(t, http.StatusBadRequest, r.Result().StatusCode, tester.DebugRequest(rq, r))
+				assert.JSONEq(t, `{
+					"errors":[{
+						"status": "400",
+						"title": "bad request",
+						"detail": "`+item.detail+`"
+					}]
+				}`, r.Body.String(), tester.DebugRequest(rq, r))
+			})
+		}
+
+		// lungo does not support geo queries
+		if tester.Store.Lungo() {
+			return
+		}
+
+		// expected result
+		result := `{
+			"data": [
+				{
+					"type": "places",
+					"id": "` + zurich + `",
+					"attributes": {
+						"name": "zurich",
+						"location": {
+							"type": "Point",
+							"coordinates": [8.5417, 47.3769]
+						}
+					}
+				}
+			],
+			"links": {
+				"self": "/places"
+			}
+		}`
+
+		// get places within a circle
+		tester.Request("GET", "places?filter[location][within]=8.5,47.4,10000", "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, result, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+
+		// get places within a polygon
+		tester.Request("GET", "places?filter[location][within]=8,47,9,47,9,48,8,48", "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, result, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+	})
+}
+
 func TestSorting(t *testing.T) {
 	withTester(t, func(t *testing.T, tester *Tester) {
 		tester.Assign("", &Controller{
@@ -6146,3 +6232,281 @@ func TestTransactions(t *testing.T) {
 		assert.Equal(t, []string{"foo", "foo"}, errs)
 	})
 }
+
+func TestTransactionRetry(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		tester.Store.UseRetry(coal.Retry{
+			Attempts: 3,
+			MinDelay: time.Millisecond,
+			MaxDelay: 5 * time.Millisecond,
+		})
+		defer tester.Store.UseRetry(coal.Retry{})
+
+		var calls int
+		tester.Assign("", &Controller{
+			Model: &postModel{},
+			Store: tester.Store,
+			Validators: L{
+				C("foo", All(), func(ctx *Context) error {
+					calls++
+					assert.Nil(t, ctx.Data["attempt"])
+					ctx.Data["attempt"] = calls
+					if calls == 1 {
+						return mongo.CommandError{
+							Message: "write conflict",
+							Labels:  []string{"TransientTransactionError"},
+						}
+					}
+					return nil
+				}),
+			},
+		})
+
+		tester.Request("POST", "posts", `{
+			"data": {
+				"type": "posts",
+				"attributes": {
+					"title": "Post 1"
+				}
+			}
+		}`, func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusCreated, r.Result().StatusCode, tester.DebugRequest(rq, r))
+		})
+
+		assert.Equal(t, 2, calls)
+		assert.Equal(t, 1, tester.Count(&postModel{}))
+	})
+}
+
+func TestNestedFilteringAndSorting(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		tester.Assign("", &Controller{
+			Model:   &venueModel{},
+			Store:   tester.Store,
+			Filters: []string{"Address.City", "Rooms.Post"},
+			Sorters: []string{"Name", "Address.City"},
+		})
+
+		post := coal.New()
+
+		// create venues
+		venue1 := tester.Insert(&venueModel{
+			Name: "venue-1",
+			Address: venueAddress{
+				Street: "Main",
+				City:   "Berlin",
+			},
+			Rooms: []venueRoom{
+				{Name: "room-1", Post: post},
+			},
+		}).ID().Hex()
+		venue2 := tester.Insert(&venueModel{
+			Name: "venue-2",
+			Address: venueAddress{
+				City: "Zurich",
+			},
+		}).ID().Hex()
+
+		// test invalid filters and sorters
+		for _, item := range []struct {
+			query  string
+			detail string
+		}{
+			{"filter[address.street]=Main", `invalid filter \"address.street\"`},
+			{"filter[address.foo]=bar", `invalid filter \"address.foo\"`},
+			{"filter[rooms.post]=foo", `relationship filter value is not an object id`},
+			{"sort=address.street", `unsupported sorter \"address.street\"`},
+			{"sort=address.foo", `invalid sorter \"address.foo\"`},
+		} {
+			tester.Request("GET", "venues?"+item.query, "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+				assert.Equal(t, http.StatusBadRequest, r.Result().StatusCode, tester.DebugRequest(rq, r))
+				assert.JSONEq(t, `{
+					"errors":[{
+						"status": "400",
+						"title": "bad request",
+						"detail": "`+item.detail+`"
+					}]
+				}`, r.Body.String(), tester.DebugRequest(rq, r))
+			})
+		}
+
+		// expected result
+		result := `{
+			"data": [
+				{
+					"type": "venues",
+					"id": "` + venue1 + `",
+					"attributes": {
+						"name": "venue-1",
+						"address": {
+							"street": "Main",
+							"city": "Berlin"
+						},
+						"rooms": [
+							{
+								"name": "room-1",
+								"post": "` + post.Hex() + `"
+							}
+						]
+					}
+				}
+			],
+			"links": {
+				"self": "/venues"
+			}
+		}`
+
+		// filter by nested attribute
+		tester.Request("GET", "venues?filter[address.city]=Berlin", "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, result, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+
+		// filter by nested relationship
+		tester.Request("GET", "venues?filter[rooms.post]="+post.Hex(), "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, result, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+
+		// sort by nested attribute
+		tester.Request("GET", "venues?sort=-address.city", "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+
+			list := gjson.Get(r.Body.String(), "data.#.id").Array()
+			assert.Len(t, list, 2)
+			assert.Equal(t, venue2, list[0].String())
+			assert.Equal(t, venue1, list[1].String())
+		})
+	})
+}
+
+func TestNestedWhitelisting(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *Tester) {
+		tester.Assign("", &Controller{
+			Model: &venueModel{},
+			Store: tester.Store,
+			Authorizers: L{
+				C("TestNestedWhitelisting", All(), func(ctx *Context) error {
+					ctx.ReadableFields = []string{"Name", "Address.City", "Rooms.Name"}
+					ctx.WritableFields = []string{"Address.City", "Rooms.Name"}
+					return nil
+				}),
+			},
+		})
+
+		post := coal.New()
+
+		// create venue
+		venue := tester.Insert(&venueModel{
+			Name: "venue",
+			Address: venueAddress{
+				Street: "Main",
+				City:   "Berlin",
+			},
+			Rooms: []venueRoom{
+				{Name: "room", Post: post},
+			},
+		}).ID().Hex()
+
+		// get venue
+		tester.Request("GET", "venues/"+venue, "", func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"data": {
+					"type": "venues",
+					"id": "`+venue+`",
+					"attributes": {
+						"name": "venue",
+						"address": {
+							"city": "Berlin"
+						},
+						"rooms": [
+							{
+								"name": "room"
+							}
+						]
+					}
+				},
+				"links": {
+					"self": "/venues/`+venue+`"
+				}
+			}`, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+
+		// attempt to update protected nested fields
+		for _, item := range []struct {
+			attributes string
+			pointer    string
+		}{
+			{`{"address": {"street": "Side", "city": "Zurich"}}`, "Address"},
+			{`{"rooms": [{"name": "room", "post": "` + coal.New().Hex() + `"}]}`, "Rooms"},
+			{`{"rooms": [{"name": "room", "post": "` + post.Hex() + `"}, {"name": "other"}]}`, "Rooms"},
+		} {
+			tester.Request("PATCH", "venues/"+venue, `{
+				"data": {
+					"type": "venues",
+					"id": "`+venue+`",
+					"attributes": `+item.attributes+`
+				}
+			}`, func(r *httptest.ResponseRecorder, rq *http.Request) {
+				assert.Equal(t, http.StatusBadRequest, r.Result().StatusCode, tester.DebugRequest(rq, r))
+				assert.JSONEq(t, `{
+					"errors": [{
+						"status": "400",
+						"title": "bad request",
+						"detail": "field is not writable",
+						"source": {
+							"pointer": "`+item.pointer+`"
+						}
+					}]
+				}`, r.Body.String(), tester.DebugRequest(rq, r))
+			})
+		}
+
+		// update writable nested fields
+		tester.Request("PATCH", "venues/"+venue, `{
+			"data": {
+				"type": "venues",
+				"id": "`+venue+`",
+				"attributes": {
+					"address": {
+						"street": "Main",
+						"city": "Zurich"
+					},
+					"rooms": [
+						{
+							"name": "hall",
+							"post": "`+post.Hex()+`"
+						}
+					]
+				}
+			}
+		}`, func(r *httptest.ResponseRecorder, rq *http.Request) {
+			assert.Equal(t, http.StatusOK, r.Result().StatusCode, tester.DebugRequest(rq, r))
+			assert.JSONEq(t, `{
+				"data": {
+					"type": "venues",
+					"id": "`+venue+`",
+					"attributes": {
+						"name": "venue",
+						"address": {
+							"city": "Zurich"
+						},
+						"rooms": [
+							{
+								"name": "hall"
+							}
+						]
+					}
+				},
+				"links": {
+					"self": "/venues/`+venue+`"
+				}
+			}`, r.Body.String(), tester.DebugRequest(rq, r))
+		})
+
+		model := tester.Fetch(&venueModel{}, coal.MustFromHex(venue)).(*venueModel)
+		assert.Equal(t, venueAddress{Street: "Main", City: "Zurich"}, model.Address)
+		assert.Equal(t, []venueRoom{{Name: "hall", Post: post}}, model.Rooms)
+	})
+}
@@ -0,0 +1,62 @@
+package glut
+
+import (
+	"context"
+	"time"
+
+	"github.com/256dpi/fire/coal"
+	"github.com/256dpi/fire/stick"
+)
+
+type migrationLock struct {
+	Base `json:"-" glut:"coal/migrator,0"`
+	stick.NoValidation
+}
+
+type migrationLocker struct {
+	store   *coal.Store
+	timeout time.Duration
+	value   migrationLock
+}
+
+// MigrationLocker will return a locker that can be used with a coal.Migrator
+// to ensure that only one instance runs migrations at a time. The lock is
+// automatically released after the specified timeout if the instance does not
+// unlock it, the timeout should therefore cover the duration of all migrations.
+func MigrationLocker(store *coal.Store, timeout time.Duration) coal.Locker {
+	return &migrationLocker{
+		store:   store,
+		timeout: timeout,
+	}
+}
+
+// Lock implements the coal.Locker interface.
+func (l *migrationLocker) Lock(ctx context.Context) error {
+	// ensure context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	for attempt := 0; ; attempt++ {
+		// attempt lock
+		locked, err := Lock(ctx, l.store, &l.value, l.timeout)
+		if err != nil {
+			return err
+		} else if locked {
+			return nil
+		}
+
+		// await retry
+		select {
+		case <-time.After(stick.Backoff(10*time.Millisecond, time.Second, 2, attempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Unlock implements the coal.Locker interface.
+func (l *migrationLocker) Unlock(ctx context.Context) error {
+	_, err := Unlock(ctx, l.store, &l.value)
+	return err
+}
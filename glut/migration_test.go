@@ -0,0 +1,52 @@
+package glut
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/256dpi/fire/coal"
+)
+
+func TestMigrationLocker(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *coal.Tester) {
+		locker1 := MigrationLocker(tester.Store, time.Minute)
+		locker2 := MigrationLocker(tester.Store, time.Minute)
+
+		err := locker1.Lock(nil)
+		assert.NoError(t, err)
+
+		var locked int32
+		done := make(chan struct{})
+		go func() {
+			err := locker2.Lock(context.Background())
+			assert.NoError(t, err)
+			atomic.StoreInt32(&locked, 1)
+			close(done)
+		}()
+
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(t, int32(0), atomic.LoadInt32(&locked))
+
+		err = locker1.Unlock(nil)
+		assert.NoError(t, err)
+
+		<-done
+		assert.Equal(t, int32(1), atomic.LoadInt32(&locked))
+
+		err = locker2.Unlock(nil)
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err = locker1.Lock(nil)
+		assert.NoError(t, err)
+
+		err = locker2.Lock(ctx)
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+}
@@ -0,0 +1,56 @@
+package glut
+
+import (
+	"context"
+
+	"github.com/256dpi/fire/coal"
+	"github.com/256dpi/fire/stick"
+)
+
+type streamToken struct {
+	Base  `json:"-" glut:"coal/stream/,0"`
+	Name  string `json:"-"`
+	Token []byte `json:"token"`
+	stick.NoValidation
+}
+
+func (t *streamToken) GetExtension() (string, error) {
+	return t.Name, nil
+}
+
+type tokenStore struct {
+	store *coal.Store
+	name  string
+}
+
+// TokenStore will return a token store that persists the resume token of a
+// coal.Stream in a value identified by the specified name.
+func TokenStore(store *coal.Store, name string) coal.TokenStore {
+	return &tokenStore{
+		store: store,
+		name:  name,
+	}
+}
+
+// Load implements the coal.TokenStore interface.
+func (s *tokenStore) Load(ctx context.Context) ([]byte, error) {
+	// get value
+	value := streamToken{Name: s.name}
+	_, err := Get(ctx, s.store, &value)
+	if err != nil {
+		return nil, err
+	}
+
+	return value.Token, nil
+}
+
+// Save implements the coal.TokenStore interface.
+func (s *tokenStore) Save(ctx context.Context, token []byte) error {
+	// set value
+	_, err := Set(ctx, s.store, &streamToken{
+		Name:  s.name,
+		Token: token,
+	})
+
+	return err
+}
@@ -0,0 +1,38 @@
+package glut
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/256dpi/fire/coal"
+)
+
+func TestTokenStore(t *testing.T) {
+	withTester(t, func(t *testing.T, tester *coal.Tester) {
+		store1 := TokenStore(tester.Store, "foo")
+		store2 := TokenStore(tester.Store, "bar")
+
+		token, err := store1.Load(nil)
+		assert.NoError(t, err)
+		assert.Nil(t, token)
+
+		err = store1.Save(nil, []byte("foo"))
+		assert.NoError(t, err)
+
+		token, err = store1.Load(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("foo"), token)
+
+		token, err = store2.Load(nil)
+		assert.NoError(t, err)
+		assert.Nil(t, token)
+
+		err = store1.Save(nil, []byte("bar"))
+		assert.NoError(t, err)
+
+		token, err = store1.Load(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("bar"), token)
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
@@ -64,6 +65,26 @@ func (g *Group) Add(controllers ...*Controller) {
 	}
 }
 
+// Controllers will return the added controllers sorted by their resource name.
+func (g *Group) Controllers() []*Controller {
+	// collect names
+	names := make([]string, 0, len(g.controllers))
+	for name := range g.controllers {
+		names = append(names, name)
+	}
+
+	// sort names
+	sort.Strings(names)
+
+	// collect controllers
+	list := make([]*Controller, 0, len(names))
+	for _, name := range names {
+		list = append(list, g.controllers[name])
+	}
+
+	return list
+}
+
 // Handle allows to add an action as a group action. Group actions will only be
 // run when no controller matches the request.
 func (g *Group) Handle(name string, a *GroupAction) {
@@ -32,6 +32,16 @@ func TestGroupAdd(t *testing.T) {
 	})
 }
 
+func TestGroupControllers(t *testing.T) {
+	group := NewGroup(xo.Panic)
+	assert.Empty(t, group.Controllers())
+
+	posts := &Controller{Model: &postModel{}}
+	comments := &Controller{Model: &commentModel{}}
+	group.Add(posts, comments)
+	assert.Equal(t, []*Controller{comments, posts}, group.Controllers())
+}
+
 func TestGroupEndpointMissingResource(t *testing.T) {
 	withTester(t, func(t *testing.T, tester *Tester) {
 		tester.Handler = NewGroup(xo.Panic).Endpoint("api")
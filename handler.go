@@ -8,6 +8,9 @@ import (
 
 // A Callback is called during the request processing flow of a controller.
 type Callback struct {
+	// The name of the callback.
+	Name string
+
 	// The matcher that decides whether the callback should be run.
 	Matcher Matcher
 
@@ -16,6 +19,10 @@ type Callback struct {
 	// If returned errors are marked with Safe() they will be included in the
 	// returned JSON-API error.
 	Handler Handler
+
+	// The value the callback has been created from, e.g. an authorization
+	// strategy. It allows inspecting the callback.
+	Origin interface{}
 }
 
 // L is a short-hand type to create a list of callbacks.
@@ -30,6 +37,7 @@ func C(name string, m Matcher, h Handler) *Callback {
 	}
 
 	return &Callback{
+		Name:    name,
 		Matcher: m,
 		Handler: func(ctx *Context) error {
 			// trace
@@ -75,8 +75,8 @@ func (s *Stream) open(manager *manager, reporter func(error)) {
 			return nil
 		}
 
-		// handle errors
-		if e == coal.Errored {
+		// handle errors and resets
+		if e == coal.Errored || e == coal.Reset {
 			// report error
 			reporter(err)
 
@@ -3,6 +3,8 @@ package stick
 import (
 	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -96,25 +98,41 @@ func BuildAccessor(v Accessible, ignore ...string) *Accessor {
 }
 
 // Get will lookup the specified field on the accessible and return its value
-// and whether the field was found at all.
+// and whether the field was found at all. The name may be a dotted path to a
+// field of a nested struct or an item of a slice e.g. "Address.City" or
+// "Items.0.Name". Nil pointers on the path yield the zero value of the field.
 func Get(acc Accessible, name string) (interface{}, bool) {
+	// split path
+	path := strings.Split(name, ".")
+
 	// find field
-	field := GetAccessor(acc).Fields[name]
+	field := GetAccessor(acc).Fields[path[0]]
 	if field == nil {
 		return nil, false
 	}
 
 	// get value
-	value := reflect.ValueOf(acc).Elem().Field(field.Index).Interface()
+	value := reflect.ValueOf(acc).Elem().Field(field.Index)
 
-	return value, true
+	// walk path
+	value, ok := walk(value, path[1:], true)
+	if !ok {
+		return nil, false
+	}
+
+	return value.Interface(), true
 }
 
 // Set will set the specified field on the accessible with the provided value
-// and return whether the field has been found and the value has been set.
+// and return whether the field has been found and the value has been set. The
+// name may be a dotted path as supported by Get, but all pointers on the path
+// must be set.
 func Set(acc Accessible, name string, value interface{}) bool {
+	// split path
+	path := strings.Split(name, ".")
+
 	// find field
-	field := GetAccessor(acc).Fields[name]
+	field := GetAccessor(acc).Fields[path[0]]
 	if field == nil {
 		return false
 	}
@@ -122,12 +140,18 @@ func Set(acc Accessible, name string, value interface{}) bool {
 	// get value
 	fieldValue := reflect.ValueOf(acc).Elem().Field(field.Index)
 
+	// walk path
+	fieldValue, ok := walk(fieldValue, path[1:], false)
+	if !ok {
+		return false
+	}
+
 	// get value value
 	valueValue := reflect.ValueOf(value)
 
 	// correct untyped nil values
-	if value == nil && field.Type.Kind() == reflect.Ptr {
-		valueValue = reflect.Zero(field.Type)
+	if value == nil && fieldValue.Kind() == reflect.Ptr {
+		valueValue = reflect.Zero(fieldValue.Type())
 	}
 
 	// check type
@@ -141,6 +165,48 @@ func Set(acc Accessible, name string, value interface{}) bool {
 	return true
 }
 
+func walk(value reflect.Value, path []string, zero bool) (reflect.Value, bool) {
+	for _, segment := range path {
+		// unwrap pointers
+		for value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				if !zero {
+					return reflect.Value{}, false
+				}
+				value = reflect.Zero(value.Type().Elem())
+			} else {
+				value = value.Elem()
+			}
+		}
+
+		// get nested value
+		switch value.Kind() {
+		case reflect.Struct:
+			// find exported field
+			field, ok := value.Type().FieldByName(segment)
+			if !ok || field.PkgPath != "" {
+				return reflect.Value{}, false
+			}
+
+			// get field
+			value = value.FieldByIndex(field.Index)
+		case reflect.Slice, reflect.Array:
+			// parse index
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= value.Len() {
+				return reflect.Value{}, false
+			}
+
+			// get item
+			value = value.Index(index)
+		default:
+			return reflect.Value{}, false
+		}
+	}
+
+	return value, true
+}
+
 // MustGet will call Get and panic if the operation failed.
 func MustGet(acc Accessible, name string) interface{} {
 	// get value
@@ -13,6 +13,18 @@ type accessible struct {
 	BasicAccess
 }
 
+type nestedItem struct {
+	Name string
+	Tags []string
+}
+
+type nestedAccessible struct {
+	Item    nestedItem
+	OptItem *nestedItem
+	Items   []nestedItem
+	BasicAccess
+}
+
 func TestBuildAccessor(t *testing.T) {
 	acc := &accessible{}
 
@@ -49,6 +61,43 @@ func TestGet(t *testing.T) {
 	assert.False(t, ok)
 }
 
+func TestGetNested(t *testing.T) {
+	acc := &nestedAccessible{
+		Item: nestedItem{
+			Name: "foo",
+		},
+		Items: []nestedItem{
+			{Name: "bar", Tags: []string{"a", "b"}},
+		},
+	}
+
+	value, ok := Get(acc, "Item.Name")
+	assert.Equal(t, "foo", value)
+	assert.True(t, ok)
+
+	value, ok = Get(acc, "OptItem.Name")
+	assert.Equal(t, "", value)
+	assert.True(t, ok)
+
+	value, ok = Get(acc, "Items.0.Name")
+	assert.Equal(t, "bar", value)
+	assert.True(t, ok)
+
+	value, ok = Get(acc, "Items.0.Tags.1")
+	assert.Equal(t, "b", value)
+	assert.True(t, ok)
+
+	value, ok = Get(acc, "Items.0")
+	assert.Equal(t, acc.Items[0], value)
+	assert.True(t, ok)
+
+	for _, name := range []string{"Item.Missing", "Item.Name.Foo", "Items.1.Name", "Items.x.Name", "Items.-1"} {
+		value, ok = Get(acc, name)
+		assert.Nil(t, value, name)
+		assert.False(t, ok, name)
+	}
+}
+
 func TestMustGet(t *testing.T) {
 	acc := &accessible{}
 	assert.Equal(t, "", MustGet(acc, "String"))
@@ -75,6 +124,36 @@ func TestSet(t *testing.T) {
 	assert.False(t, ok)
 }
 
+func TestSetNested(t *testing.T) {
+	acc := &nestedAccessible{
+		Items: []nestedItem{
+			{Name: "bar"},
+		},
+	}
+
+	ok := Set(acc, "Item.Name", "foo")
+	assert.True(t, ok)
+	assert.Equal(t, "foo", acc.Item.Name)
+
+	ok = Set(acc, "Items.0.Name", "baz")
+	assert.True(t, ok)
+	assert.Equal(t, "baz", acc.Items[0].Name)
+
+	ok = Set(acc, "OptItem.Name", "foo")
+	assert.False(t, ok)
+
+	acc.OptItem = &nestedItem{}
+	ok = Set(acc, "OptItem.Name", "foo")
+	assert.True(t, ok)
+	assert.Equal(t, "foo", acc.OptItem.Name)
+
+	ok = Set(acc, "Items.1.Name", "foo")
+	assert.False(t, ok)
+
+	ok = Set(acc, "Item.Name", 1)
+	assert.False(t, ok)
+}
+
 func TestSetNil(t *testing.T) {
 	acc := &accessible{}
 
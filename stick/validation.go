@@ -7,6 +7,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"unicode"
 	"unicode/utf8"
 
@@ -54,11 +55,43 @@ func (e ValidationError) Error() string {
 	return err
 }
 
+// Constraint describes a declared rule that can be expressed without running
+// it, e.g. in a database schema.
+type Constraint struct {
+	Name  string
+	Value interface{}
+}
+
+var describing sync.Map
+
+// Describe will run the validation of the provided object and return the
+// constraints declared by its rules keyed by the field path. Rule errors are
+// ignored. Currently, only IsMinLen ("minLen") and IsMaxLen ("maxLen") used with
+// Validator.Value are described.
+func Describe(obj interface {
+	Accessible
+	Validatable
+}) map[string][]Constraint {
+	// prepare constraints
+	constraints := map[string][]Constraint{}
+
+	// register object
+	describing.Store(obj, constraints)
+	defer describing.Delete(obj)
+
+	// run validation
+	_ = obj.Validate()
+
+	return constraints
+}
+
 // Validator is used to validate an object.
 type Validator struct {
-	obj   Accessible
-	path  []string
-	error ValidationError
+	obj      Accessible
+	path     []string
+	prefix   []string
+	error    ValidationError
+	describe map[string][]Constraint
 }
 
 // Validate will validate the provided accessible using the specified validator
@@ -67,6 +100,13 @@ func Validate(obj Accessible, fn func(v *Validator)) error {
 	// prepare validator
 	val := &Validator{obj: obj}
 
+	// check description
+	if reflect.ValueOf(obj).Kind() == reflect.Ptr {
+		if constraints, ok := describing.Load(obj); ok {
+			val.describe = constraints.(map[string][]Constraint)
+		}
+	}
+
 	// run validator
 	fn(val)
 
@@ -85,11 +125,25 @@ func (v *Validator) Nest(field string, fn func()) {
 	v.path = v.path[:len(v.path)-1]
 }
 
+// NestValue nest validation under the specified field. Unlike Nest, values are
+// also accessed relative to the field, which may be a nested struct or a dotted
+// path to a slice item e.g. "Address" or "Items.0".
+func (v *Validator) NestValue(field string, fn func()) {
+	// push
+	v.prefix = append(v.prefix, field)
+
+	// yield
+	v.Nest(field, fn)
+
+	// pop
+	v.prefix = v.prefix[:len(v.prefix)-1]
+}
+
 // Value will validate the value at the named field using the provided rules.
 // If the value is optional it will be skipped if nil or unwrapped if present.
 func (v *Validator) Value(name string, optional bool, rules ...Rule) {
 	// get value
-	value := MustGet(v.obj, name)
+	value := MustGet(v.obj, v.field(name))
 
 	// prepare subject
 	sub := Subject{
@@ -97,6 +151,18 @@ func (v *Validator) Value(name string, optional bool, rules ...Rule) {
 		RValue: reflect.ValueOf(value),
 	}
 
+	// describe rules
+	if v.describe != nil {
+		field := v.field(name)
+		sub.describe = func(c Constraint) {
+			v.describe[field] = append(v.describe[field], c)
+		}
+		for _, rule := range rules {
+			_ = rule(sub)
+		}
+		return
+	}
+
 	// handle optionals
 	if optional {
 		// skip if nil
@@ -122,7 +188,7 @@ func (v *Validator) Value(name string, optional bool, rules ...Rule) {
 // provided rules.
 func (v *Validator) Items(name string, rules ...Rule) {
 	// get slice
-	slice := reflect.ValueOf(MustGet(v.obj, name))
+	slice := reflect.ValueOf(MustGet(v.obj, v.field(name)))
 
 	// execute rules for each item
 	v.Nest(name, func() {
@@ -162,6 +228,15 @@ func (v *Validator) Report(name string, err error) {
 	v.error[xo.W(err)] = path
 }
 
+func (v *Validator) field(name string) string {
+	// check prefix
+	if len(v.prefix) == 0 {
+		return name
+	}
+
+	return strings.Join(v.prefix, ".") + "." + name
+}
+
 // Error will return the validation error or nil of no errors have yet been
 // reported.
 func (v *Validator) Error() error {
@@ -177,6 +252,20 @@ func (v *Validator) Error() error {
 type Subject struct {
 	IValue interface{}
 	RValue reflect.Value
+
+	describe func(Constraint)
+}
+
+func (s *Subject) constrain(name string, value interface{}) bool {
+	// check description
+	if s.describe == nil {
+		return false
+	}
+
+	// describe constraint
+	s.describe(Constraint{Name: name, Value: value})
+
+	return true
 }
 
 // IsNil returns true if the value is nil or a typed nil (zero pointer).
@@ -364,6 +453,11 @@ func IsValid(sub Subject) error {
 // IsMinLen checks whether the value has at least the specified length.
 func IsMinLen(min int) Rule {
 	return func(sub Subject) error {
+		// describe
+		if sub.constrain("minLen", min) {
+			return nil
+		}
+
 		// unwrap
 		if !sub.Unwrap() {
 			return nil
@@ -381,6 +475,11 @@ func IsMinLen(min int) Rule {
 // IsMaxLen checks whether the value does not exceed the specified length.
 func IsMaxLen(max int) Rule {
 	return func(sub Subject) error {
+		// describe
+		if sub.constrain("maxLen", max) {
+			return nil
+		}
+
 		// unwrap
 		if !sub.Unwrap() {
 			return nil
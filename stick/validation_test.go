@@ -3,6 +3,7 @@ package stick
 import (
 	"io"
 	"reflect"
+	"strconv"
 	"testing"
 	"time"
 
@@ -95,6 +96,85 @@ func TestValidate(t *testing.T) {
 	assert.Equal(t, "Foo: error", err.Error())
 }
 
+func TestValidateNested(t *testing.T) {
+	obj := &nestedAccessible{
+		Items: []nestedItem{
+			{Name: "foo"},
+			{Name: ""},
+		},
+	}
+
+	err := Validate(obj, func(v *Validator) {
+		v.NestValue("Item", func() {
+			v.Value("Name", false, IsNotZero)
+			v.Items("Tags", IsNotZero)
+		})
+		for i := range obj.Items {
+			v.NestValue("Items."+strconv.Itoa(i), func() {
+				v.Value("Name", false, IsNotZero)
+			})
+		}
+	})
+	assert.Error(t, err)
+	assert.Equal(t, "Item.Name: zero; Items.1.Name: zero", err.Error())
+
+	obj.Item.Name = "bar"
+	obj.Item.Tags = []string{"a", ""}
+	err = Validate(obj, func(v *Validator) {
+		v.NestValue("Item", func() {
+			v.Value("Name", false, IsNotZero)
+			v.Items("Tags", IsNotZero)
+		})
+	})
+	assert.Error(t, err)
+	assert.Equal(t, "Item.Tags.1: zero", err.Error())
+
+	err = Validate(obj, func(v *Validator) {
+		v.Nest("Item", func() {
+			v.Value("Items", false, IsMinLen(3))
+		})
+	})
+	assert.Error(t, err)
+	assert.Equal(t, "Item.Items: too short", err.Error())
+}
+
+type describable struct {
+	String    string
+	OptString *string
+	Item      nestedItem
+	BasicAccess
+}
+
+func (d *describable) Validate() error {
+	return Validate(d, func(v *Validator) {
+		v.Value("String", false, IsNotZero, IsMinLen(2), IsMaxLen(5))
+		v.Value("OptString", true, IsMaxLen(10))
+		v.NestValue("Item", func() {
+			v.Value("Tags", false, IsMaxLen(3))
+		})
+	})
+}
+
+func TestDescribe(t *testing.T) {
+	obj := &describable{}
+	assert.Equal(t, map[string][]Constraint{
+		"String": {
+			{Name: "minLen", Value: 2},
+			{Name: "maxLen", Value: 5},
+		},
+		"OptString": {
+			{Name: "maxLen", Value: 10},
+		},
+		"Item.Tags": {
+			{Name: "maxLen", Value: 3},
+		},
+	}, Describe(obj))
+
+	err := obj.Validate()
+	assert.Error(t, err)
+	assert.Equal(t, "String: too short; String: zero", err.Error())
+}
+
 func TestValidateErrorIsolation(t *testing.T) {
 	err := Validate(nil, func(v *Validator) {
 		v.Report("Foo", io.EOF)
@@ -91,10 +91,35 @@ type barModel struct {
 	stick.NoValidation
 }
 
+type placeModel struct {
+	coal.Base `json:"-" bson:",inline" coal:"places"`
+	Name      string     `json:"name"`
+	Location  coal.Point `json:"location"`
+	stick.NoValidation
+}
+
+type venueAddress struct {
+	Street string `json:"street"`
+	City   string `json:"city"`
+}
+
+type venueRoom struct {
+	Name string  `json:"name"`
+	Post coal.ID `json:"post"`
+}
+
+type venueModel struct {
+	coal.Base `json:"-" bson:",inline" coal:"venues"`
+	Name      string       `json:"name"`
+	Address   venueAddress `json:"address"`
+	Rooms     []venueRoom  `json:"rooms"`
+	stick.NoValidation
+}
+
 var mongoStore = coal.MustConnect("mongodb://0.0.0.0/test-fire", xo.Panic)
 var lungoStore = coal.MustOpen(nil, "test-fire", xo.Panic)
 
-var modelList = []coal.Model{&postModel{}, &commentModel{}, &selectionModel{}, &noteModel{}, &fooModel{}, &barModel{}}
+var modelList = []coal.Model{&postModel{}, &commentModel{}, &selectionModel{}, &noteModel{}, &fooModel{}, &barModel{}, &placeModel{}, &venueModel{}}
 
 func withTester(t *testing.T, fn func(*testing.T, *Tester)) {
 	t.Run("Mongo", func(t *testing.T) {